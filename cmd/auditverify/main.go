@@ -0,0 +1,57 @@
+// Command auditverify walks the audit chain and reports the first event breaking it,
+// it exits with status 1 if the chain is broken and 2 if it can't be verified.
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/joho/godotenv"
+	"go-authentication/config"
+	"go-authentication/internal/repository"
+	"go-authentication/internal/service"
+	"go-authentication/pkg/logger"
+	"go-authentication/pkg/postgres"
+	stdLog "log"
+	"os"
+)
+
+func init() {
+	if err := godotenv.Load(".env"); err != nil {
+		stdLog.Fatal("can't set env file:", err)
+	}
+}
+
+func main() {
+	os.Exit(run())
+}
+
+// run verifies the chain and returns the exit status, so deferred calls run before the exit.
+func run() int {
+	cfg := config.MustLoad()
+	log := logger.SetupLogger(cfg.Logger)
+
+	pg, err := postgres.New(cfg.Postgres.URL, postgres.MaxPoolSize(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "can't connect to postgres:", err)
+		return 2
+	}
+	defer pg.Close()
+
+	chain := service.NewAuditChainService(cfg, log, repository.NewAuditRepo(log, pg))
+
+	r, err := chain.Verify(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "can't verify audit chain:", err)
+		return 2
+	}
+
+	fmt.Printf("unchained events: %d\nchained events verified: %d\ncheckpoints verified: %d\n",
+		r.Unchained, r.Checked, r.Checkpoints)
+
+	if !r.Intact() {
+		fmt.Printf("chain is broken at event %d: %s\n", r.BrokenAt, r.Reason)
+		return 1
+	}
+	fmt.Println("chain is intact")
+	return 0
+}
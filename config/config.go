@@ -12,20 +12,42 @@ import (
 
 type (
 	Config struct {
-		HTTP        `yaml:"http"`
-		Logger      `yaml:"logger"`
-		Postgres    `yaml:"postgres"`
-		AccessToken `yaml:"access_token"`
-		Session     `yaml:"session"`
-		MongoDB     `yaml:"mongodb"`
-		CSRFToken   `yaml:"csrf-token"`
-		Redis       `yaml:"redis"`
-		SocialAuth  `yaml:"social_auth"`
+		HTTP            `yaml:"http"`
+		Logger          `yaml:"logger"`
+		Postgres        `yaml:"postgres"`
+		AccessToken     `yaml:"access_token"`
+		Session         `yaml:"session"`
+		MongoDB         `yaml:"mongodb"`
+		CSRFToken       `yaml:"csrf-token"`
+		Redis           `yaml:"redis"`
+		SocialAuth      `yaml:"social_auth"`
+		GeoIP           `yaml:"geoip"`
+		Events          `yaml:"events"`
+		RememberMe      `yaml:"remember_me"`
+		SessionCache    `yaml:"session_cache"`
+		LoginThrottle   `yaml:"login_throttle"`
+		RateLimit       `yaml:"rate_limit"`
+		Signup          `yaml:"signup"`
+		PasswordHash    `yaml:"password_hash"`
+		PasswordPolicy  `yaml:"password_policy"`
+		PasswordHistory `yaml:"password_history"`
+		RBAC            `yaml:"rbac"`
+		Impersonation   `yaml:"impersonation"`
+		AuditLog        `yaml:"audit_log"`
+		Webhooks        `yaml:"webhooks"`
+		Outbox          `yaml:"outbox"`
+		AccountDeletion `yaml:"account_deletion"`
+		Mail            `yaml:"mail"`
+		LoginAlerts     `yaml:"login_alerts"`
+		PasswordReset   `yaml:"password_reset"`
 	}
 
 	HTTP struct {
 		Port             string `yaml:"port"`
 		CorsAllowOrigins string `yaml:"cors_allow_origins"`
+		// DebugAddr is an address of internal listener exposing runtime and cache metrics
+		// on /debug/vars, e.g. "127.0.0.1:6060". It must not be reachable publicly, empty disables it.
+		DebugAddr string `yaml:"debug_addr"`
 	}
 
 	Logger struct {
@@ -44,6 +66,204 @@ type (
 		//CookiePath     string        `yaml:"cookie_path"`
 		CookieSecure   bool `yaml:"cookie_secure"`
 		CookieHttpOnly bool `yaml:"cookie_httponly"`
+		// HashKey is a secret used to hash session tokens before storing them.
+		HashKey string `env-required:"true" env:"SESSION_HASH_KEY"`
+		// LegacyIDLookup enables lookup of sessions stored with raw token as id
+		// and migrates them to hashed id on first use.
+		LegacyIDLookup bool `yaml:"legacy_id_lookup"`
+		// Store is a session backend: "mongo" or "cookie".
+		// In cookie mode the session is encrypted into the cookie and only revocations are stored server side,
+		// so sessions can't be listed or looked up by handle: the session list and detail endpoints
+		// are not served and sessions of deleted accounts are not reconciled.
+		Store string `yaml:"store" env-default:"mongo"`
+		// CookieKeys are base64 encoded 32-byte AES keys used in cookie mode,
+		// the first key encrypts, the rest are only used to decrypt during rotation.
+		CookieKeys []string `env:"SESSION_COOKIE_KEYS" env-separator:","`
+		// Denylist is a storage of revoked sessions in cookie mode: "memory" or "redis".
+		Denylist string `yaml:"denylist" env-default:"memory"`
+	}
+
+	RememberMe struct {
+		RememberTTL       time.Duration `yaml:"ttl" env-default:"720h"`
+		RememberCookieKey string        `yaml:"cookie_key" env-default:"remember_token"`
+		// RememberReuseGrace is a period during which the replaced token is accepted without revoking the series,
+		// it covers concurrent requests of the same client.
+		RememberReuseGrace time.Duration `yaml:"reuse_grace" env-default:"10s"`
+	}
+
+	SessionCache struct {
+		// CacheSize is a max number of cached sessions, the cache is disabled if 0.
+		CacheSize int           `yaml:"size"`
+		CacheTTL  time.Duration `yaml:"ttl" env-default:"5s"`
+		// CacheInvalidation is a way to invalidate caches of other instances: "none" or "redis".
+		CacheInvalidation string `yaml:"invalidation" env-default:"none"`
+		CacheRedisChannel string `yaml:"redis_channel" env-default:"auth:session-cache"`
+	}
+
+	LoginThrottle struct {
+		// ThrottleStore is a storage of failed attempts: "memory" or "redis".
+		ThrottleStore string `yaml:"store" env-default:"memory"`
+		// AccountFreeAttempts is a number of failures of an account allowed without delay.
+		AccountFreeAttempts int `yaml:"account_free_attempts" env-default:"3"`
+		// AccountLockThreshold is a number of failures after which the account is locked, 0 disables locking.
+		AccountLockThreshold int           `yaml:"account_lock_threshold" env-default:"10"`
+		AccountLockDuration  time.Duration `yaml:"account_lock_duration" env-default:"15m"`
+		// IPFreeAttempts is a number of failures from an ip allowed without delay.
+		IPFreeAttempts int `yaml:"ip_free_attempts" env-default:"20"`
+		// BackoffBase is a delay after the first failure over free attempts, it doubles with every next failure.
+		BackoffBase time.Duration `yaml:"backoff_base" env-default:"1s"`
+		BackoffMax  time.Duration `yaml:"backoff_max" env-default:"5m"`
+		// AttemptsTTL is a period after the last failure when failures are forgotten.
+		AttemptsTTL time.Duration `yaml:"attempts_ttl" env-default:"1h"`
+	}
+
+	RateLimit struct {
+		// RateLimitStore is a storage of token buckets: "memory" or "redis".
+		RateLimitStore string `yaml:"store" env-default:"memory"`
+		// ClientIDHeader is a header identifying the client for rules keyed by client.
+		ClientIDHeader string `yaml:"client_id_header" env-default:"X-Client-ID"`
+		// Groups are rules by route group name, routes of a group without rule are not limited.
+		Groups map[string]RateLimitRule `yaml:"groups"`
+	}
+
+	Signup struct {
+		// SignupConcealExisting hides whether an email is registered: signup always responds 202
+		// and the owner of the existing account gets a notice instead of the conflict error.
+		SignupConcealExisting bool `yaml:"conceal_existing"`
+	}
+
+	PasswordHash struct {
+		// HashAlgorithm is used for new hashes: "argon2id" or "bcrypt",
+		// hashes of the other algorithm are still verified and replaced on successful login.
+		HashAlgorithm string `yaml:"algorithm" env-default:"argon2id"`
+		// Argon2Memory is a memory cost in KiB.
+		Argon2Memory      uint32 `yaml:"argon2_memory" env-default:"65536"`
+		Argon2Iterations  uint32 `yaml:"argon2_iterations" env-default:"3"`
+		Argon2Parallelism uint8  `yaml:"argon2_parallelism" env-default:"2"`
+		BcryptCost        int    `yaml:"bcrypt_cost" env-default:"11"`
+	}
+
+	PasswordPolicy struct {
+		PasswordMinLength int `yaml:"min_length" env-default:"8"`
+		// PasswordMaxLength can't exceed 64, longer passwords are rejected by the API.
+		PasswordMaxLength int `yaml:"max_length" env-default:"64"`
+		// PasswordMinScore is a min strength score from 0 (too guessable) to 4 (very unguessable), 0 disables the check.
+		PasswordMinScore int `yaml:"min_score" env-default:"2"`
+		// PasswordRejectUserInputs rejects passwords containing email or username.
+		PasswordRejectUserInputs bool `yaml:"reject_user_inputs" env-default:"true"`
+		// BreachedListPath is a path to the file of SHA-1 hashes or hash prefixes of breached passwords,
+		// the check is disabled if empty.
+		BreachedListPath string `yaml:"breached_list_path" env:"BREACHED_PASSWORDS_PATH"`
+	}
+
+	PasswordHistory struct {
+		// HistorySize is a number of latest passwords which can't be set again, 0 disables the check.
+		HistorySize int `yaml:"size" env-default:"5"`
+	}
+
+	RBAC struct {
+		// DefaultRoles are assigned to new accounts.
+		DefaultRoles []string `yaml:"default_roles" env-default:"user"`
+		// AdminEmail is an email of the account which gets admin role on start, seeding is disabled if empty.
+		AdminEmail string `yaml:"admin_email" env:"ADMIN_EMAIL"`
+	}
+
+	Impersonation struct {
+		// ImpersonationTTL is a fixed lifetime of sessions opened by admin on behalf of an account.
+		ImpersonationTTL time.Duration `yaml:"ttl" env-default:"15m"`
+	}
+
+	AuditLog struct {
+		// AuditChainKey is a secret used to sign checkpoints of the audit chain.
+		AuditChainKey string `env-required:"true" env:"AUDIT_CHAIN_KEY"`
+		// AuditCheckpointInterval is an interval of signing the chain head, 0 disables checkpoints.
+		AuditCheckpointInterval time.Duration `yaml:"checkpoint_interval" env-default:"10m"`
+	}
+
+	Webhooks struct {
+		// WebhookPollInterval is an interval of checking due deliveries, 0 disables sending.
+		WebhookPollInterval time.Duration `yaml:"poll_interval" env-default:"5s"`
+		// WebhookBatchSize is a max number of deliveries sent at once.
+		WebhookBatchSize int           `yaml:"batch_size" env-default:"50"`
+		WebhookTimeout   time.Duration `yaml:"timeout" env-default:"10s"`
+		// WebhookMaxAttempts is a number of attempts after which the delivery is failed.
+		WebhookMaxAttempts int `yaml:"max_attempts" env-default:"8"`
+		// WebhookBackoffBase is a delay after the first failed attempt, it doubles with every next failure.
+		WebhookBackoffBase time.Duration `yaml:"backoff_base" env-default:"30s"`
+		WebhookBackoffMax  time.Duration `yaml:"backoff_max" env-default:"6h"`
+		// WebhookAllowPrivate allows webhooks to loopback and private addresses, it is meant for local development.
+		WebhookAllowPrivate bool `yaml:"allow_private" env-default:"false"`
+	}
+
+	Outbox struct {
+		// OutboxPublisher publishes outbox events to other components: "log", "memory", "nats" or "kafka".
+		OutboxPublisher string `yaml:"publisher" env-default:"log"`
+		// OutboxPollInterval is an interval of checking pending events, 0 disables publishing.
+		OutboxPollInterval time.Duration `yaml:"poll_interval" env-default:"1s"`
+		OutboxBatchSize    int           `yaml:"batch_size" env-default:"100"`
+		// OutboxLease is how long claimed events are hidden from other relays, it must cover publishing of a batch.
+		OutboxLease time.Duration `yaml:"lease" env-default:"1m"`
+		// OutboxMaxAttempts is a number of failed attempts after which the event is parked and not published anymore.
+		OutboxMaxAttempts int `yaml:"max_attempts" env-default:"10"`
+		// OutboxRetention is how long dispatched events are kept.
+		OutboxRetention   time.Duration `yaml:"retention" env-default:"168h"`
+		NATSURL           string        `yaml:"nats_url" env:"NATS_URL"`
+		NATSSubjectPrefix string        `yaml:"nats_subject_prefix" env-default:"auth.events"`
+		NATSTimeout       time.Duration `yaml:"nats_timeout" env-default:"5s"`
+		// KafkaBrokers is a comma separated list of broker addresses.
+		KafkaBrokers string        `yaml:"kafka_brokers" env:"KAFKA_BROKERS"`
+		KafkaTopic   string        `yaml:"kafka_topic" env-default:"auth.events"`
+		KafkaTimeout time.Duration `yaml:"kafka_timeout" env-default:"10s"`
+	}
+
+	AccountDeletion struct {
+		// RevokeAttempts is a number of attempts to revoke sessions of the deleted account.
+		RevokeAttempts int `yaml:"revoke_attempts" env-default:"3"`
+		// RevokeBackoff is a delay before the second attempt, it doubles with every next one.
+		RevokeBackoff time.Duration `yaml:"revoke_backoff" env-default:"200ms"`
+		// OrphanCheckInterval is an interval of removing sessions of missing accounts, 0 disables it.
+		OrphanCheckInterval  time.Duration `yaml:"orphan_check_interval" env-default:"1h"`
+		OrphanCheckBatchSize int           `yaml:"orphan_check_batch_size" env-default:"500"`
+	}
+
+	Mail struct {
+		// MailTransport delivers emails: "console", "file" or "smtp".
+		MailTransport string `yaml:"transport" env-default:"console"`
+		MailFrom      string `yaml:"from" env-default:"Go Authentication <no-reply@localhost>"`
+		// MailLocale is a locale of emails to recipients with unknown locale.
+		MailLocale  string `yaml:"locale" env-default:"en"`
+		MailAppName string `yaml:"app_name" env-default:"Go Authentication"`
+		// MailBaseURL is a public url of the site, links in emails point to its pages
+		// /login, /password-reset?token= and /login-rejection?token=.
+		MailBaseURL string `yaml:"base_url" env-default:"http://localhost:3000"`
+		// MailDir is a directory of .eml files written by "file" transport.
+		MailDir       string `yaml:"dir" env-default:"./tmp/mail"`
+		MailQueueSize int    `yaml:"queue_size" env-default:"1000"`
+		MailWorkers   int    `yaml:"workers" env-default:"2"`
+		// MailMaxAttempts is a number of attempts after which the email is dropped.
+		MailMaxAttempts int `yaml:"max_attempts" env-default:"5"`
+		// MailBackoffBase is a delay after the first failed attempt, it doubles with every next failure.
+		MailBackoffBase time.Duration `yaml:"backoff_base" env-default:"10s"`
+		SMTPHost        string        `yaml:"smtp_host" env:"SMTP_HOST"`
+		SMTPPort        int           `yaml:"smtp_port" env:"SMTP_PORT" env-default:"587"`
+		SMTPUsername    string        `yaml:"smtp_username" env:"SMTP_USERNAME"`
+		SMTPPassword    string        `yaml:"smtp_password" env:"SMTP_PASSWORD"`
+		// SMTPSecurity is "starttls", "tls" or "none".
+		SMTPSecurity string        `yaml:"smtp_security" env-default:"starttls"`
+		SMTPTimeout  time.Duration `yaml:"smtp_timeout" env-default:"30s"`
+	}
+
+	LoginAlerts struct {
+		// LoginAlertsEnabled notifies the owner of login from a device the account hasn't used before,
+		// devices are remembered anyway.
+		LoginAlertsEnabled bool `yaml:"enabled" env-default:"true"`
+		// LoginRejectTTL is how long the "this wasn't me" link of the notification is valid.
+		LoginRejectTTL time.Duration `yaml:"reject_ttl" env-default:"72h"`
+	}
+
+	PasswordReset struct {
+		// PasswordResetTTL is how long the password reset link is valid.
+		PasswordResetTTL time.Duration `yaml:"ttl" env-default:"1h"`
 	}
 
 	CSRFToken struct {
@@ -64,12 +284,35 @@ type (
 		Password string `yaml:"password" env:"MONGO_PASS"`
 	}
 
+	GeoIP struct {
+		// DBPath is a path to MaxMind-format .mmdb city database, geolocation is disabled if empty.
+		DBPath string `yaml:"db_path" env:"GEOIP_DB_PATH"`
+	}
+
+	Events struct {
+		// Broker is a broker used to fan out events across instances: "memory" or "redis".
+		Broker       string `yaml:"broker" env-default:"memory"`
+		RedisChannel string `yaml:"redis_channel" env-default:"auth:events"`
+		// Heartbeat is an interval of keep-alive comments sent to event stream clients.
+		Heartbeat time.Duration `yaml:"heartbeat" env-default:"30s"`
+	}
+
 	Redis struct {
 		Addr     string `env-required:"true" env:"REDIS_ADDR"`
 		Password string `env-required:"true" env:"REDIS_PASSWORD"`
 	}
 )
 
+// RateLimitRule allows Limit requests per Period with bursts up to Limit.
+type RateLimitRule struct {
+	Limit  int           `yaml:"limit"`
+	Period time.Duration `yaml:"period"`
+	// Key is a key of the bucket: "ip", "account" or "client",
+	// account and client keys fall back to ip if the request has no account or client id.
+	// Groups keyed by account are also limited by ip before the session is looked up.
+	Key string `yaml:"key"`
+}
+
 type SocialAuth struct {
 	GitHubClientID     string `yaml:"github_client_id" env-required:"true" env:"GH_CLIENT_ID"`
 	GitHubClientSecret string `env-required:"true" env:"GH_CLIENT_SECRET"`
@@ -105,6 +348,11 @@ func (sa *SocialAuth) ClientSecrets() map[string]string {
 	}
 }
 
+// ListsSessions reports whether the session store can list sessions and look them up by handle.
+func (c *Config) ListsSessions() bool {
+	return c.Session.Store != "cookie"
+}
+
 func MustLoad() *Config {
 	var cfg Config
 
@@ -7,35 +7,67 @@ import (
 	"go-authentication/internal/apperrors"
 	"go-authentication/internal/domain"
 	"go-authentication/internal/service"
+	"go-authentication/pkg/ratelimit"
 	"go-authentication/pkg/utils"
+	"golang.org/x/text/language"
 	"log/slog"
 	"net/http"
 )
 
+// _maxLocaleLen is a length of the accounts.locale column.
+const _maxLocaleLen = 35
+
 type accountHandler struct {
 	log *slog.Logger
 	cfg *config.Config
 
 	accountService service.Account
 	authService    service.Auth
+	sessionService service.Session
+	deviceService  service.Devices
 }
 
-func newAccountHandler(handler *gin.RouterGroup, log *slog.Logger, cfg *config.Config, accService service.Account, sessionService service.Session, authService service.Auth) {
-	h := &accountHandler{log: log, cfg: cfg, accountService: accService, authService: authService}
+func newAccountHandler(
+	handler *gin.RouterGroup,
+	log *slog.Logger,
+	cfg *config.Config,
+	accService service.Account,
+	sessionService service.Session,
+	authService service.Auth,
+	deviceService service.Devices,
+	limiter ratelimit.Limiter) {
+
+	h := &accountHandler{
+		log:            log,
+		cfg:            cfg,
+		accountService: accService,
+		authService:    authService,
+		sessionService: sessionService,
+		deviceService:  deviceService,
+	}
+
+	rl := rateLimitMiddleware(log, cfg, limiter, "account")
 
 	g := handler.Group("/account")
 
-	authenticated := g.Group("/", sessionMiddleware(log, cfg, sessionService))
+	authenticated := g.Group("/", rl, sessionMiddleware(log, cfg, sessionService),
+		accountRateLimitMiddleware(log, cfg, limiter, "account"))
 	{
-		secure := authenticated.Group("/", tokenMiddleware(log, cfg, authService))
+		secure := authenticated.Group("/", denyImpersonationMiddleware(log), tokenMiddleware(log, cfg, authService))
 		{
 			secure.DELETE("", h.delete)
 		}
 
 		authenticated.GET("", h.get)
+		authenticated.GET("/activity", h.activity)
+		authenticated.GET("/devices", h.devices)
+		authenticated.PUT("/password", denyImpersonationMiddleware(log), h.changePassword)
 	}
 
-	g.POST("", h.create)
+	g.POST("", rl, h.create)
+	// links of emails lead to these, so they are called without a session
+	g.POST("/password/reset", rl, h.resetPassword)
+	g.POST("/devices/reject", rl, h.rejectLogin)
 }
 
 func (h *accountHandler) create(c *gin.Context) {
@@ -51,10 +83,14 @@ func (h *accountHandler) create(c *gin.Context) {
 		return
 	}
 
-	account := domain.Account{Email: r.Email, Username: r.Username, Password: r.Password}
+	account := domain.Account{Email: r.Email, Username: r.Username, Password: r.Password, Locale: requestLocale(c)}
 
 	_, err = h.accountService.Create(c.Request.Context(), account)
 	if err != nil {
+		if abortPasswordPolicy(c, err) {
+			l.Warn("password violates policy", slog.String("error", err.Error()))
+			return
+		}
 		if errors.Is(err, apperrors.ErrorAccountAlreadyExists) {
 			h.log.Warn("account already exists",
 				slog.String(utils.Operation, op),
@@ -67,6 +103,10 @@ func (h *accountHandler) create(c *gin.Context) {
 		return
 	}
 
+	if h.cfg.SignupConcealExisting {
+		c.Status(http.StatusAccepted)
+		return
+	}
 	c.Status(http.StatusCreated)
 }
 
@@ -98,6 +138,47 @@ func (h *accountHandler) get(c *gin.Context) {
 	c.JSON(http.StatusOK, acc)
 }
 
+func (h *accountHandler) activity(c *gin.Context) {
+	const op = "api.activity"
+	l := h.log.With(slog.String(utils.Operation, op))
+
+	var r activityListRequest
+
+	if err := c.ShouldBindQuery(&r); err != nil {
+		l.Error("can't bind activity query", slog.String("error", err.Error()))
+		c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse{Error: apperrors.ErrorValidate.Error()})
+		return
+	}
+
+	aid, err := getAccountID(c)
+	if err != nil {
+		l.Error("can't get account id", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	p := domain.NewPagination(r.Page, r.PerPage, "", true)
+
+	events, total, err := h.accountService.Activity(c.Request.Context(), aid, p)
+	if err != nil {
+		l.Error("can't get account activity", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	resp := activityListResponse{
+		Events:  make([]activityResponse, 0, len(events)),
+		Page:    p.Page,
+		PerPage: p.PerPage,
+		Total:   total,
+	}
+	for _, e := range events {
+		resp.Events = append(resp.Events, newActivityResponse(e))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
 func (h *accountHandler) delete(c *gin.Context) { //todo use soft delete instead
 	const op = "api.delete"
 	l := h.log.With(slog.String(utils.Operation, op))
@@ -124,3 +205,168 @@ func (h *accountHandler) delete(c *gin.Context) { //todo use soft delete instead
 		"message": "account was deleted",
 	})
 }
+
+func (h *accountHandler) changePassword(c *gin.Context) {
+	const op = "api.changePassword"
+	l := h.log.With(slog.String(utils.Operation, op))
+
+	var r passwordChangeRequest
+
+	if err := c.ShouldBindJSON(&r); err != nil {
+		l.Error("can't unmarshal password change request", slog.String("error", err.Error()))
+		c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse{Error: apperrors.ErrorValidate.Error()})
+		return
+	}
+
+	session, err := getSession(c)
+	if err != nil {
+		l.Warn("can't get session", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	err = h.accountService.ChangePassword(ctx, session.AccountID, session.Handle, r.CurrentPassword, r.NewPassword)
+	if err != nil {
+		if abortPasswordPolicy(c, err) {
+			l.Warn("password violates policy", slog.String("error", err.Error()))
+			return
+		}
+		if abortTooManyAttempts(c, err) {
+			l.Warn("password change throttled", slog.String("error", err.Error()))
+			return
+		}
+		if errors.Is(err, apperrors.ErrorAccountWrongPassword) {
+			l.Warn("wrong current password")
+			c.AbortWithStatusJSON(http.StatusForbidden, errorResponse{Error: apperrors.ErrorAccountWrongPassword.Error()})
+			return
+		}
+		l.Error("can't change password", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// other sessions and persistent logins could be opened with the old password
+	if err = h.sessionService.TerminateAll(ctx, session.AccountID, session.Handle); err != nil {
+		l.Error("can't terminate other sessions", slog.String("error", err.Error()))
+	}
+	setRememberCookie(c, h.cfg, "", -1)
+
+	rotated, err := h.sessionService.Rotate(ctx, session)
+	if err != nil {
+		l.Error("can't rotate session", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	setSessionCookie(c, h.cfg, rotated)
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *accountHandler) resetPassword(c *gin.Context) {
+	const op = "api.resetPassword"
+	l := h.log.With(slog.String(utils.Operation, op))
+
+	var r passwordResetRequest
+
+	if err := c.ShouldBindJSON(&r); err != nil {
+		l.Error("can't unmarshal password reset request", slog.String("error", err.Error()))
+		c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse{Error: apperrors.ErrorValidate.Error()})
+		return
+	}
+
+	if err := h.accountService.ResetPassword(c.Request.Context(), r.Token, r.Password); err != nil {
+		if abortPasswordPolicy(c, err) {
+			l.Warn("password violates policy", slog.String("error", err.Error()))
+			return
+		}
+		if errors.Is(err, apperrors.ErrorAccountTokenInvalid) {
+			l.Warn("invalid password reset token")
+			c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse{Error: apperrors.ErrorAccountTokenInvalid.Error()})
+			return
+		}
+		l.Error("can't reset password", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *accountHandler) devices(c *gin.Context) {
+	const op = "api.devices"
+	l := h.log.With(slog.String(utils.Operation, op))
+
+	aid, err := getAccountID(c)
+	if err != nil {
+		l.Error("can't get account id", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	devices, err := h.deviceService.List(c.Request.Context(), aid)
+	if err != nil {
+		l.Error("can't get devices", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, deviceListResponse{Devices: devices})
+}
+
+// rejectLogin is called from the link of the new device login alert.
+func (h *accountHandler) rejectLogin(c *gin.Context) {
+	const op = "api.rejectLogin"
+	l := h.log.With(slog.String(utils.Operation, op))
+
+	var r loginRejectRequest
+
+	if err := c.ShouldBindJSON(&r); err != nil {
+		l.Error("can't unmarshal login reject request", slog.String("error", err.Error()))
+		c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse{Error: apperrors.ErrorValidate.Error()})
+		return
+	}
+
+	if err := h.deviceService.RejectLogin(c.Request.Context(), r.Token); err != nil {
+		if errors.Is(err, apperrors.ErrorAccountTokenInvalid) {
+			l.Warn("invalid login rejection token")
+			c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse{Error: apperrors.ErrorAccountTokenInvalid.Error()})
+			return
+		}
+		l.Error("can't reject login", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// abortPasswordPolicy responds with violated rules of the password policy if err is caused by the policy.
+func abortPasswordPolicy(c *gin.Context, err error) bool {
+	var policyErr *apperrors.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+
+	c.AbortWithStatusJSON(http.StatusUnprocessableEntity, passwordPolicyResponse{
+		Error:      apperrors.ErrorPasswordPolicy.Error(),
+		Violations: policyErr.Violations,
+	})
+	return true
+}
+
+// requestLocale returns the language tag the client prefers most by Accept-Language header,
+// it is empty if the header is missing or malformed.
+func requestLocale(c *gin.Context) string {
+	tags, _, err := language.ParseAcceptLanguage(c.GetHeader("Accept-Language"))
+	if err != nil || len(tags) == 0 || tags[0] == language.Und {
+		return ""
+	}
+
+	locale := tags[0].String()
+	if len(locale) > _maxLocaleLen {
+		return ""
+	}
+	return locale
+}
@@ -0,0 +1,360 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go-authentication/config"
+	"go-authentication/internal/apperrors"
+	"go-authentication/internal/domain"
+	"go-authentication/internal/service"
+	"go-authentication/pkg/ratelimit"
+	"go-authentication/pkg/utils"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type adminHandler struct {
+	l   *slog.Logger
+	cfg *config.Config
+
+	admin service.Admin
+}
+
+func newAdminHandler(
+	handler *gin.RouterGroup,
+	l *slog.Logger,
+	cfg *config.Config,
+	sess service.Session,
+	roles service.Role,
+	admin service.Admin,
+	limiter ratelimit.Limiter) {
+
+	h := &adminHandler{l: l, cfg: cfg, admin: admin}
+
+	// admin privileges of the account are never available in impersonated sessions
+	g := handler.Group("/admin",
+		rateLimitMiddleware(l, cfg, limiter, "admin"),
+		sessionMiddleware(l, cfg, sess),
+		accountRateLimitMiddleware(l, cfg, limiter, "admin"),
+		denyImpersonationMiddleware(l))
+	{
+		accounts := g.Group("/accounts", requirePermission(l, roles, domain.PermissionAccountsAdmin))
+		{
+			accounts.GET("", h.accountList)
+
+			account := accounts.Group("/:accountID", accountParamMiddleware(l))
+			{
+				account.GET("", h.account)
+				account.POST("/lock", h.lock)
+				account.DELETE("/lock", h.unlock)
+				account.POST("/password-reset", h.forcePasswordReset)
+			}
+		}
+
+		g.POST("/accounts/:accountID/impersonate",
+			requirePermission(l, roles, domain.PermissionImpersonate),
+			accountParamMiddleware(l),
+			h.impersonate)
+
+		sessions := g.Group("/accounts/:accountID/sessions",
+			requirePermission(l, roles, domain.PermissionSessionsAdmin),
+			accountParamMiddleware(l))
+		{
+			if cfg.ListsSessions() {
+				sessions.GET("", h.sessionList)
+			}
+			sessions.DELETE("", h.terminateSessions)
+		}
+
+		r := g.Group("/accounts/:accountID/roles",
+			requirePermission(l, roles, domain.PermissionRolesAdmin),
+			accountParamMiddleware(l))
+		{
+			r.GET("", h.roleList)
+			r.POST("", h.assignRole)
+			r.DELETE(":role", h.revokeRole)
+		}
+	}
+}
+
+func (h *adminHandler) accountList(c *gin.Context) {
+	const op = "api.admin.accountList"
+	l := h.l.With(slog.String(utils.Operation, op))
+
+	var r adminAccountListRequest
+
+	if err := c.ShouldBindQuery(&r); err != nil {
+		l.Error("can't bind account list query", slog.String("error", err.Error()))
+		c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse{Error: apperrors.ErrorValidate.Error()})
+		return
+	}
+
+	sortBy := r.Sort
+	if sortBy == "createdAt" {
+		sortBy = ""
+	}
+	p := domain.NewPagination(r.Page, r.PerPage, sortBy, r.Order != "asc")
+	f := domain.AccountFilter{
+		Email:       r.Email,
+		Username:    r.Username,
+		CreatedFrom: r.CreatedFrom,
+		CreatedTo:   r.CreatedTo,
+	}
+
+	accounts, total, err := h.admin.SearchAccounts(c.Request.Context(), getActor(c), f, p)
+	if err != nil {
+		l.Error("can't search accounts", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, accountListResponse{
+		Accounts: accounts,
+		Page:     p.Page,
+		PerPage:  p.PerPage,
+		Total:    total,
+	})
+}
+
+func (h *adminHandler) account(c *gin.Context) {
+	const op = "api.admin.account"
+	l := h.l.With(slog.String(utils.Operation, op))
+
+	acc, err := h.admin.GetAccount(c.Request.Context(), getActor(c), c.Param("accountID"))
+	if err != nil {
+		if abortAccountNotFound(c, err) {
+			return
+		}
+		l.Error("can't get account", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, acc)
+}
+
+func (h *adminHandler) lock(c *gin.Context) {
+	const op = "api.admin.lock"
+	l := h.l.With(slog.String(utils.Operation, op))
+
+	if err := h.admin.Lock(c.Request.Context(), getActor(c), c.Param("accountID")); err != nil {
+		if abortAccountNotFound(c, err) {
+			return
+		}
+		l.Error("can't lock account", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *adminHandler) unlock(c *gin.Context) {
+	const op = "api.admin.unlock"
+	l := h.l.With(slog.String(utils.Operation, op))
+
+	if err := h.admin.Unlock(c.Request.Context(), getActor(c), c.Param("accountID")); err != nil {
+		if abortAccountNotFound(c, err) {
+			return
+		}
+		l.Error("can't unlock account", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *adminHandler) forcePasswordReset(c *gin.Context) {
+	const op = "api.admin.forcePasswordReset"
+	l := h.l.With(slog.String(utils.Operation, op))
+
+	if err := h.admin.ForcePasswordReset(c.Request.Context(), getActor(c), c.Param("accountID")); err != nil {
+		if abortAccountNotFound(c, err) {
+			return
+		}
+		l.Error("can't force password reset", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// impersonate replaces session cookie of the admin by a short-lived session of the account,
+// the admin session is ended, so the admin has to log in again after the impersonation.
+func (h *adminHandler) impersonate(c *gin.Context) {
+	const op = "api.admin.impersonate"
+	l := h.l.With(slog.String(utils.Operation, op))
+
+	aid := c.Param("accountID")
+	actor := getActor(c)
+
+	if aid == actor.AccountID {
+		c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse{Error: apperrors.ErrorValidate.Error()})
+		return
+	}
+
+	sid, err := getSessionID(c)
+	if err != nil {
+		l.Error("can't get session id", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	s, err := h.admin.Impersonate(c.Request.Context(), actor, sid, aid)
+	if err != nil {
+		if abortAccountNotFound(c, err) {
+			return
+		}
+		if errors.Is(err, apperrors.ErrorAccountLocked) {
+			c.AbortWithStatusJSON(http.StatusConflict, errorResponse{Error: apperrors.ErrorAccountLocked.Error()})
+			return
+		}
+		l.Error("can't impersonate account", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	l.Warn("impersonation started",
+		slog.String("account_id", aid),
+		slog.String("impersonator_id", actor.AccountID),
+		slog.String("session_handle", s.Handle))
+
+	setSessionCookie(c, h.cfg, s)
+	c.JSON(http.StatusOK, impersonateResponse{
+		SessionID: s.Handle,
+		AccountID: s.AccountID,
+		ExpiresAt: time.Unix(s.ExpiresAt, 0),
+	})
+}
+
+func (h *adminHandler) sessionList(c *gin.Context) {
+	const op = "api.admin.sessionList"
+	l := h.l.With(slog.String(utils.Operation, op))
+
+	var r sessionListRequest
+
+	if err := c.ShouldBindQuery(&r); err != nil {
+		l.Error("can't bind session list query", slog.String("error", err.Error()))
+		c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse{Error: apperrors.ErrorValidate.Error()})
+		return
+	}
+
+	p := domain.NewPagination(r.Page, r.PerPage, r.Sort, r.Order != "asc")
+
+	sessions, total, err := h.admin.Sessions(c.Request.Context(), getActor(c), c.Param("accountID"), p)
+	if err != nil {
+		l.Error("can't get sessions", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	resp := sessionListResponse{
+		Sessions: make([]sessionResponse, 0, len(sessions)),
+		Page:     p.Page,
+		PerPage:  p.PerPage,
+		Total:    total,
+	}
+	for _, s := range sessions {
+		resp.Sessions = append(resp.Sessions, newSessionResponse(s, ""))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *adminHandler) terminateSessions(c *gin.Context) {
+	const op = "api.admin.terminateSessions"
+	l := h.l.With(slog.String(utils.Operation, op))
+
+	if err := h.admin.TerminateSessions(c.Request.Context(), getActor(c), c.Param("accountID")); err != nil {
+		l.Error("can't terminate sessions", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *adminHandler) roleList(c *gin.Context) {
+	const op = "api.admin.roleList"
+	l := h.l.With(slog.String(utils.Operation, op))
+
+	roles, err := h.admin.Roles(c.Request.Context(), getActor(c), c.Param("accountID"))
+	if err != nil {
+		l.Error("can't get roles", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, roleListResponse{Roles: append([]string{}, roles...)})
+}
+
+func (h *adminHandler) assignRole(c *gin.Context) {
+	const op = "api.admin.assignRole"
+	l := h.l.With(slog.String(utils.Operation, op))
+
+	var r roleAssignRequest
+
+	if err := c.ShouldBindJSON(&r); err != nil {
+		l.Error("can't unmarshal role request", slog.String("error", err.Error()))
+		c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse{Error: apperrors.ErrorValidate.Error()})
+		return
+	}
+
+	err := h.admin.AssignRole(c.Request.Context(), getActor(c), c.Param("accountID"), r.Role)
+	if err != nil {
+		if abortAccountNotFound(c, err) {
+			return
+		}
+		if errors.Is(err, apperrors.ErrorRoleNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, errorResponse{Error: apperrors.ErrorRoleNotFound.Error()})
+			return
+		}
+		l.Error("can't assign role", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *adminHandler) revokeRole(c *gin.Context) {
+	const op = "api.admin.revokeRole"
+	l := h.l.With(slog.String(utils.Operation, op))
+
+	err := h.admin.RevokeRole(c.Request.Context(), getActor(c), c.Param("accountID"), c.Param("role"))
+	if err != nil {
+		if errors.Is(err, apperrors.ErrorRoleNotAssigned) {
+			c.AbortWithStatusJSON(http.StatusNotFound, errorResponse{Error: apperrors.ErrorRoleNotAssigned.Error()})
+			return
+		}
+		l.Error("can't revoke role", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// accountParamMiddleware responds 404 if the account id path parameter is not a valid id.
+func accountParamMiddleware(l *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := uuid.Parse(c.Param("accountID")); err != nil {
+			l.Warn("invalid account id", slog.String("account_id", c.Param("accountID")))
+			c.AbortWithStatusJSON(http.StatusNotFound, errorResponse{Error: apperrors.ErrorAccountNotFound.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+func abortAccountNotFound(c *gin.Context, err error) bool {
+	if !errors.Is(err, apperrors.ErrorAccountNotFound) {
+		return false
+	}
+	c.AbortWithStatusJSON(http.StatusNotFound, errorResponse{Error: apperrors.ErrorAccountNotFound.Error()})
+	return true
+}
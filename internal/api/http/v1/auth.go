@@ -6,9 +6,11 @@ import (
 	"go-authentication/config"
 	"go-authentication/internal/apperrors"
 	"go-authentication/internal/service"
+	"go-authentication/pkg/ratelimit"
 	"go-authentication/pkg/utils"
 	"log/slog"
 	"net/http"
+	"strconv"
 )
 
 type authHandler struct {
@@ -25,7 +27,8 @@ func newAuthHandler(
 	cfg *config.Config,
 	auth service.Auth,
 	//socAuth service.SocialAuth,
-	sess service.Session) {
+	sess service.Session,
+	limiter ratelimit.Limiter) {
 
 	h := &authHandler{
 		l:    log,
@@ -34,19 +37,22 @@ func newAuthHandler(
 		sess: sess,
 	}
 
+	rl := rateLimitMiddleware(log, cfg, limiter, "auth")
+
 	g := handler.Group("/auth")
 	{
-		g.POST("/login", h.login).Use(setCSRFTokenMiddleware(log, cfg))
+		g.POST("/login", rl, h.login).Use(setCSRFTokenMiddleware(log, cfg))
 
 		//social := g.Group("/social")
 		//{
 		//social.POST("/login", h.socialLogin).Use(setCSRFTokenMiddleware(log, cfg))
 		//}
 
-		authenticated := g.Group("/", csrfMiddleware(log, cfg), sessionMiddleware(log, cfg, sess))
+		authenticated := g.Group("/", rl, csrfMiddleware(log, cfg), sessionMiddleware(log, cfg, sess),
+			accountRateLimitMiddleware(log, cfg, limiter, "auth"))
 		{
 			authenticated.POST("logout", h.logout)
-			authenticated.GET("token", h.token)
+			authenticated.GET("token", denyImpersonationMiddleware(log), h.token)
 		}
 
 	}
@@ -80,25 +86,40 @@ func (h *authHandler) login(c *gin.Context) {
 			IP:        c.ClientIP(),
 		})
 	if err != nil {
+		if abortTooManyAttempts(c, err) {
+			l.Warn("login throttled", slog.String("error", err.Error()))
+			return
+		}
 		if errors.Is(err, apperrors.ErrorAccountNotFound) ||
 			errors.Is(err, apperrors.ErrorAccountWrongPassword) {
 			l.Warn("email or password incorrect")
 			c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse{Error: apperrors.ErrorLoginOrPasswordIncorrect.Error()})
+			return
+		}
+		if errors.Is(err, apperrors.ErrorAccountLocked) {
+			c.AbortWithStatusJSON(http.StatusForbidden, errorResponse{Error: apperrors.ErrorAccountLocked.Error()})
+			return
+		}
+		if errors.Is(err, apperrors.ErrorPasswordResetRequired) {
+			c.AbortWithStatusJSON(http.StatusForbidden, errorResponse{Error: apperrors.ErrorPasswordResetRequired.Error()})
+			return
 		}
 		l.Warn("cannot login", slog.String("error", err.Error()))
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 
-	c.SetCookie(
-		h.cfg.Session.CookieKey,
-		s.ID,
-		s.TTL,
-		apiPath,
-		h.cfg.Session.CookieDomain,
-		h.cfg.Session.CookieSecure,
-		h.cfg.Session.CookieHttpOnly,
-	)
+	if r.RememberMe {
+		rt, err := h.sess.Remember(c.Request.Context(), s.AccountID)
+		if err != nil {
+			// the session is created anyway, the client just won't be remembered
+			l.Error("can't create remember token", slog.String("error", err.Error()))
+		} else {
+			setRememberCookie(c, h.cfg, rt, int(h.cfg.RememberTTL.Seconds()))
+		}
+	}
+
+	setSessionCookie(c, h.cfg, s)
 	c.Status(http.StatusOK)
 }
 
@@ -113,13 +134,27 @@ func (h *authHandler) logout(c *gin.Context) {
 		return
 	}
 
-	if err = h.auth.Logout(c.Request.Context(), sid); err != nil {
+	aid, err := getAccountID(c)
+	if err != nil {
+		l.Warn("can't get account id", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if err = h.auth.Logout(c.Request.Context(), aid, sid); err != nil {
 		l.Warn("can't logout", slog.String("error", err.Error()))
 
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 
+	if rt, err := c.Cookie(h.cfg.RememberCookieKey); err == nil {
+		if err = h.sess.Forget(c.Request.Context(), rt); err != nil {
+			l.Warn("can't forget remember token", slog.String("error", err.Error()))
+		}
+		setRememberCookie(c, h.cfg, "", -1)
+	}
+
 	c.SetCookie( //todo why we set cookie anyway?
 		h.cfg.Session.CookieKey,
 		"",
@@ -145,23 +180,51 @@ func (h *authHandler) token(c *gin.Context) {
 		return
 	}
 
-	aid, err := getAccountID(c)
+	session, err := getSession(c)
 	if err != nil {
-		l.Warn("can't get account id", slog.String("error", err.Error()))
+		l.Warn("can't get session", slog.String("error", err.Error()))
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
 
-	t, err := h.auth.NewAccessToken(c.Request.Context(), aid, r.Password)
+	t, err := h.auth.NewAccessToken(c.Request.Context(), session, r.Password)
 	if err != nil {
 		l.Error("", slog.String("error", err.Error()))
-		if errors.Is(err, apperrors.ErrorAccountWrongPassword) {
+		if abortTooManyAttempts(c, err) {
+			return
+		}
+		if errors.Is(err, apperrors.ErrorAccountWrongPassword) ||
+			errors.Is(err, apperrors.ErrorAccountLocked) ||
+			errors.Is(err, apperrors.ErrorPasswordResetRequired) {
 			c.AbortWithStatus(http.StatusForbidden)
+			return
 		}
 
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
+
+	// the session is elevated by the access token, so its id is rotated
+	session, err = h.sess.Rotate(c.Request.Context(), session)
+	if err != nil {
+		l.Error("can't rotate session", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	setSessionCookie(c, h.cfg, session)
 	c.JSON(http.StatusOK, tokenResponse{AccessToken: t})
 	return
 }
+
+// abortTooManyAttempts responds with 429 and Retry-After header if err is a throttling error.
+func abortTooManyAttempts(c *gin.Context, err error) bool {
+	var tooMany *apperrors.TooManyAttemptsError
+	if !errors.As(err, &tooMany) {
+		return false
+	}
+
+	c.Header("Retry-After", strconv.Itoa(ceilSeconds(tooMany.RetryAfter)))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, errorResponse{Error: apperrors.ErrorTooManyLoginAttempts.Error()})
+	return true
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"go-authentication/config"
 	"go-authentication/internal/service"
+	"go-authentication/pkg/ratelimit"
 	"log/slog"
 )
 
@@ -16,10 +17,16 @@ func SetupHandlers(
 	acc service.Account,
 	sess service.Session,
 	auth service.Auth,
+	devices service.Devices,
+	roles service.Role,
+	admin service.Admin,
+	webhooks service.Webhook,
+	limiter ratelimit.Limiter,
 ) {
 
 	handler.Use(gin.Logger())
 	handler.Use(gin.Recovery())
+	handler.Use(actorMiddleware())
 
 	//handler.Static(fmt.Sprintf("%s/swagger/", apiPath), "third_party/swaggerui")
 
@@ -28,12 +35,15 @@ func SetupHandlers(
 			"message": "pong",
 		})
 	})
+
 	h := handler.Group(apiPath)
 
 	{
-		newAccountHandler(h, log, cfg, acc, sess, auth)
-		newAuthHandler(h, log, cfg, auth, sess)
-		newSessionHandler(h, log, cfg, sess, auth)
+		newAccountHandler(h, log, cfg, acc, sess, auth, devices, limiter)
+		newAuthHandler(h, log, cfg, auth, sess, limiter)
+		newSessionHandler(h, log, cfg, sess, auth, limiter)
+		newAdminHandler(h, log, cfg, sess, roles, admin, limiter)
+		newWebhookHandler(h, log, cfg, sess, roles, webhooks, limiter)
 	}
 
 }
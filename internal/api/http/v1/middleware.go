@@ -1,14 +1,21 @@
 package v1
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"go-authentication/config"
 	"go-authentication/internal/apperrors"
+	"go-authentication/internal/domain"
 	"go-authentication/internal/service"
+	"go-authentication/pkg/ratelimit"
 	"go-authentication/pkg/utils"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func sessionMiddleware(log *slog.Logger, cfg *config.Config, s service.Session) gin.HandlerFunc {
@@ -16,25 +23,41 @@ func sessionMiddleware(log *slog.Logger, cfg *config.Config, s service.Session)
 	l := log.With(slog.String(utils.Operation, op))
 
 	return func(c *gin.Context) {
-		sid, err := c.Cookie(cfg.CookieKey)
-		if err != nil {
-			l.Warn("session id is not passed", slog.String("error", err.Error()))
+		var session domain.Session
 
-			c.AbortWithStatus(http.StatusUnauthorized)
-			return
-		}
+		token, err := c.Cookie(cfg.CookieKey)
+		if err == nil {
+			session, err = s.Get(c.Request.Context(), token)
+			if err != nil && !errors.Is(err, apperrors.ErrorSessionNotFound) {
+				l.Error("can't get session", slog.String("error", err.Error()))
 
-		l.Debug("got session key from cookie", slog.String("sid", sid))
+				c.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+		}
 
-		session, err := s.Get(c.Request.Context(), sid)
+		// session is missing or expired, try to mint a new one from persistent login token
 		if err != nil {
-			l.Warn("session not found", slog.String("error", err.Error()))
-
-			c.AbortWithStatus(http.StatusForbidden)
-			return
+			var rerr error
+
+			session, rerr = restoreSession(c, cfg, s)
+			if rerr != nil {
+				l.Warn("session not found",
+					slog.String("error", err.Error()),
+					slog.String("restore error", rerr.Error()))
+
+				if token == "" {
+					c.AbortWithStatus(http.StatusUnauthorized)
+					return
+				}
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
 		}
 
-		l.Debug("got account id from session service", slog.String("aid", session.AccountID))
+		l.Debug("got account id from session service",
+			slog.String("aid", session.AccountID),
+			slog.String("session handle", session.Handle))
 
 		d := service.Device{
 			UserAgent: c.Request.UserAgent(), //c.Request.Header.Get("User-Agent")
@@ -49,12 +72,124 @@ func sessionMiddleware(log *slog.Logger, cfg *config.Config, s service.Session)
 			return
 		}
 
-		c.Set("sid", session.ID)
+		// session handle is used to refer to the current session, its id is never exposed
+		c.Set("sid", session.Handle)
 		c.Set("aid", session.AccountID)
+		c.Set("session", session)
+
+		actor := domain.ActorFromContext(c.Request.Context())
+		actor.AccountID, actor.ImpersonatorID = session.AccountID, session.ImpersonatorID
+		c.Request = c.Request.WithContext(domain.ContextWithActor(c.Request.Context(), actor))
+
+		c.Next()
+	}
+}
+
+// actorMiddleware puts the client of the request into the request context, so services can
+// attribute audit events, the account is added by sessionMiddleware once it is known.
+func actorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actor := domain.Actor{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+		c.Request = c.Request.WithContext(domain.ContextWithActor(c.Request.Context(), actor))
 		c.Next()
 	}
 }
 
+// restoreSession creates session using persistent login token from the cookie and passes new cookies to the client.
+func restoreSession(c *gin.Context, cfg *config.Config, s service.Session) (domain.Session, error) {
+	rt, err := c.Cookie(cfg.RememberCookieKey)
+	if err != nil {
+		return domain.Session{}, err
+	}
+
+	session, newRt, err := s.Restore(c.Request.Context(), rt, service.Device{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrorRememberTokenReused) ||
+			errors.Is(err, apperrors.ErrorRememberTokenNotFound) ||
+			errors.Is(err, apperrors.ErrorRememberTokenInvalid) {
+			setRememberCookie(c, cfg, "", -1)
+		}
+		return domain.Session{}, err
+	}
+
+	setSessionCookie(c, cfg, session)
+	if newRt != "" {
+		setRememberCookie(c, cfg, newRt, int(cfg.RememberTTL.Seconds()))
+	}
+	return session, nil
+}
+
+// rateLimitMiddleware limits requests of the route group by the rule from config, it is registered
+// before sessionMiddleware, so lookups of sessions are limited too, and limits by ip there.
+func rateLimitMiddleware(log *slog.Logger, cfg *config.Config, limiter ratelimit.Limiter, group string) gin.HandlerFunc {
+	const op = "rateLimitMiddleware"
+	l := log.With(slog.String(utils.Operation, op), slog.String("group", group))
+
+	rule, ok := cfg.RateLimit.Groups[group]
+	if !ok || limiter == nil || rule.Limit <= 0 || rule.Period <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	policy := fmt.Sprintf("%d;w=%d", rule.Limit, int(rule.Period.Seconds()))
+
+	return func(c *gin.Context) {
+		key := group + ":" + rateLimitKey(c, cfg, rule)
+
+		res, err := limiter.Allow(c.Request.Context(), key, rule.Limit, rule.Period)
+		if err != nil {
+			// the limiter store is unavailable, requests are not limited until it is back
+			l.Error("can't check rate limit", slog.String("error", err.Error()))
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Policy", policy)
+		c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+		if !res.Allowed {
+			l.Warn("rate limit exceeded", slog.String("key", key))
+
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, errorResponse{Error: apperrors.ErrorRateLimitExceeded.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// accountRateLimitMiddleware limits requests of the group by account once the session is resolved,
+// it is registered in addition to rateLimitMiddleware which is registered before the session lookup,
+// so it limits by ip there. It does nothing unless the group rule is keyed by account.
+func accountRateLimitMiddleware(log *slog.Logger, cfg *config.Config, limiter ratelimit.Limiter, group string) gin.HandlerFunc {
+	if cfg.RateLimit.Groups[group].Key != "account" {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return rateLimitMiddleware(log, cfg, limiter, group)
+}
+
+func rateLimitKey(c *gin.Context, cfg *config.Config, rule config.RateLimitRule) string {
+	switch rule.Key {
+	case "account":
+		if aid, err := getAccountID(c); err == nil {
+			return "account:" + aid
+		}
+	case "client":
+		if cid := c.GetHeader(cfg.RateLimit.ClientIDHeader); cid != "" {
+			return "client:" + cid
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
 func setCSRFTokenMiddleware(log *slog.Logger, cfg *config.Config) gin.HandlerFunc {
 	const op = "setCSRFTokenMiddleware"
 	l := log.With(slog.String(utils.Operation, op))
@@ -148,13 +283,19 @@ func tokenMiddleware(log *slog.Logger, cfg *config.Config, a service.Auth) gin.H
 			return
 		}
 
-		sub, err := a.ParseAccessToken(c.Request.Context(), t)
+		claims, err := a.ParseAccessToken(c.Request.Context(), t)
 		if err != nil {
 			l.Warn("access token is invalid", slog.String("error", err.Error()))
 			c.AbortWithStatus(http.StatusForbidden)
 			return
 		}
-		if aid != sub {
+		session, err := getSession(c)
+		if err != nil {
+			l.Warn("can't get session", slog.String("error", err.Error()))
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		if aid != claims.Subject || session.ImpersonatorID != claims.Impersonator {
 			l.Warn("access token is invalid")
 			c.AbortWithStatus(http.StatusForbidden)
 			return
@@ -163,6 +304,62 @@ func tokenMiddleware(log *slog.Logger, cfg *config.Config, a service.Auth) gin.H
 	}
 }
 
+// denyImpersonationMiddleware forbids sensitive routes to sessions opened by admin on behalf of the account,
+// it must be placed after sessionMiddleware.
+func denyImpersonationMiddleware(log *slog.Logger) gin.HandlerFunc {
+	const op = "denyImpersonationMiddleware"
+	l := log.With(slog.String(utils.Operation, op))
+
+	return func(c *gin.Context) {
+		session, err := getSession(c)
+		if err != nil {
+			l.Warn("can't get session", slog.String("error", err.Error()))
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		if session.Impersonated() {
+			l.Warn("sensitive route is requested in impersonated session",
+				slog.String("account_id", session.AccountID),
+				slog.String("impersonator_id", session.ImpersonatorID),
+				slog.String("path", c.FullPath()))
+
+			c.AbortWithStatusJSON(http.StatusForbidden, errorResponse{Error: apperrors.ErrorImpersonationForbidden.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// requirePermission allows the request only if the account from context has the permission,
+// it must be placed after sessionMiddleware.
+func requirePermission(log *slog.Logger, roles service.Role, permission string) gin.HandlerFunc {
+	const op = "requirePermission"
+	l := log.With(slog.String(utils.Operation, op), slog.String("permission", permission))
+
+	return func(c *gin.Context) {
+		aid, err := getAccountID(c)
+		if err != nil {
+			l.Warn("account id is empty", slog.String("error", err.Error()))
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		ok, err := roles.HasPermission(c.Request.Context(), aid, permission)
+		if err != nil {
+			l.Error("can't check permission", slog.String("error", err.Error()))
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			l.Warn("permission denied", slog.String("account_id", aid))
+			c.AbortWithStatusJSON(http.StatusForbidden, errorResponse{Error: apperrors.ErrorPermissionDenied.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
 func getAccountID(c *gin.Context) (string, error) {
 	aid := c.GetString("aid")
 	_, err := uuid.Parse(aid)
@@ -172,6 +369,12 @@ func getAccountID(c *gin.Context) (string, error) {
 	return aid, nil
 }
 
+// getActor returns the account performing the request and its client,
+// it must be called after sessionMiddleware.
+func getActor(c *gin.Context) domain.Actor {
+	return domain.ActorFromContext(c.Request.Context())
+}
+
 func getSessionID(c *gin.Context) (string, error) {
 	sid := c.GetString("sid")
 	if sid == "" {
@@ -179,3 +382,41 @@ func getSessionID(c *gin.Context) (string, error) {
 	}
 	return sid, nil
 }
+
+func getSession(c *gin.Context) (domain.Session, error) {
+	s, ok := c.Get("session")
+	if !ok {
+		return domain.Session{}, apperrors.ErrorContextSessionNotFound
+	}
+	session, ok := s.(domain.Session)
+	if !ok {
+		return domain.Session{}, apperrors.ErrorContextSessionNotFound
+	}
+	return session, nil
+}
+
+// setSessionCookie passes session token to the client, the cookie expires with the session.
+func setSessionCookie(c *gin.Context, cfg *config.Config, s domain.Session) {
+	c.SetCookie(
+		cfg.Session.CookieKey,
+		s.Token,
+		int(time.Until(time.Unix(s.ExpiresAt, 0)).Seconds()),
+		apiPath,
+		cfg.Session.CookieDomain,
+		cfg.Session.CookieSecure,
+		cfg.Session.CookieHttpOnly,
+	)
+}
+
+// setRememberCookie passes persistent login token to the client, negative maxAge deletes the cookie.
+func setRememberCookie(c *gin.Context, cfg *config.Config, token string, maxAge int) {
+	c.SetCookie(
+		cfg.RememberCookieKey,
+		token,
+		maxAge,
+		apiPath,
+		cfg.Session.CookieDomain,
+		cfg.Session.CookieSecure,
+		true,
+	)
+}
@@ -1,24 +1,203 @@
 package v1
 
+import (
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/passpolicy"
+	"time"
+)
+
 type errorResponse struct {
 	Error string `json:"error"`
 }
 
+// passwordPolicyResponse lists every rule of the password policy the password violates.
+type passwordPolicyResponse struct {
+	Error      string                 `json:"error"`
+	Violations []passpolicy.Violation `json:"violations"`
+}
+
 type accountCreateRequest struct {
 	Email    string `json:"email" binding:"required,email,lte=255"`
 	Username string `json:"username" binding:"required,alphanum,gte=4,lte=16"`
-	Password string `json:"password" binding:"required,gte=8,lte=64"`
+	// Password length is checked by the password policy, the binding bounds
+	// the work of the strength scorer and must not be lower than the policy max length.
+	Password string `json:"password" binding:"required,lte=64"`
+}
+
+type passwordChangeRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required,lte=64"`
+	NewPassword     string `json:"new_password" binding:"required,lte=64"`
+}
+
+type passwordResetRequest struct {
+	Token    string `json:"token" binding:"required,lte=128"`
+	Password string `json:"password" binding:"required,lte=64"`
+}
+
+type loginRejectRequest struct {
+	Token string `json:"token" binding:"required,lte=128"`
+}
+
+type deviceListResponse struct {
+	Devices []domain.KnownDevice `json:"devices"`
 }
 
 type loginRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required,lte=64"`
+	RememberMe bool   `json:"remember_me"`
+}
+
+type adminAccountListRequest struct {
+	Email       string    `form:"email" binding:"omitempty,lte=255"`
+	Username    string    `form:"username" binding:"omitempty,lte=16"`
+	CreatedFrom time.Time `form:"created_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedTo   time.Time `form:"created_to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Page        int       `form:"page" binding:"omitempty,gte=1"`
+	PerPage     int       `form:"per_page" binding:"omitempty,gte=1,lte=100"`
+	Sort        string    `form:"sort" binding:"omitempty,oneof=createdAt email username"`
+	Order       string    `form:"order" binding:"omitempty,oneof=asc desc"`
+}
+
+type accountListResponse struct {
+	Accounts []domain.Account `json:"accounts"`
+	Page     int              `json:"page"`
+	PerPage  int              `json:"perPage"`
+	Total    int64            `json:"total"`
+}
+
+type impersonateResponse struct {
+	SessionID string    `json:"sessionId"`
+	AccountID string    `json:"accountId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type webhookCreateRequest struct {
+	URL    string   `json:"url" binding:"required,url,lte=2048"`
+	Events []string `json:"events" binding:"required,min=1,dive,oneof=* account.created account.deleted session.created session.terminated password.changed"`
+}
+
+// webhookCreateResponse is the only response containing the webhook secret.
+type webhookCreateResponse struct {
+	domain.Webhook
+	Secret string `json:"secret"`
+}
+
+type webhookListResponse struct {
+	Webhooks []domain.Webhook `json:"webhooks"`
+}
+
+type webhookDeliveryListRequest struct {
+	Page    int `form:"page" binding:"omitempty,gte=1"`
+	PerPage int `form:"per_page" binding:"omitempty,gte=1,lte=100"`
+}
+
+type webhookDeliveryListResponse struct {
+	Deliveries []domain.WebhookDelivery `json:"deliveries"`
+	Page       int                      `json:"page"`
+	PerPage    int                      `json:"perPage"`
+	Total      int64                    `json:"total"`
+}
+
+type roleAssignRequest struct {
+	Role string `json:"role" binding:"required,lte=64"`
+}
+
+type roleListResponse struct {
+	Roles []string `json:"roles"`
 }
 
 type tokenRequest struct {
-	Password string `json:"password" binding:"required"`
+	Password string `json:"password" binding:"required,lte=64"`
 }
 
 type tokenResponse struct {
 	AccessToken string `json:"access_token"`
 }
+
+type sessionListRequest struct {
+	Page    int    `form:"page" binding:"omitempty,gte=1"`
+	PerPage int    `form:"per_page" binding:"omitempty,gte=1,lte=100"`
+	Sort    string `form:"sort" binding:"omitempty,oneof=createdAt expiresAt"`
+	Order   string `form:"order" binding:"omitempty,oneof=asc desc"`
+}
+
+type sessionResponse struct {
+	ID        string `json:"id"`
+	Provider  string `json:"provider"`
+	UserAgent string `json:"userAgent"`
+	IP        string `json:"ip"`
+	Browser   string `json:"browser"`
+	OS        string `json:"os"`
+	Device    string `json:"device"`
+	Country   string `json:"country,omitempty"`
+	City      string `json:"city,omitempty"`
+	// ImpersonatorID is an id of the admin who opened the session on behalf of the account.
+	ImpersonatorID string    `json:"impersonatorId,omitempty"`
+	Current        bool      `json:"current"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+type sessionListResponse struct {
+	Sessions []sessionResponse `json:"sessions"`
+	Page     int               `json:"page"`
+	PerPage  int               `json:"perPage"`
+	Total    int64             `json:"total"`
+}
+
+func newSessionResponse(s domain.Session, curSid string) sessionResponse {
+	return sessionResponse{
+		ID:             s.Handle,
+		Provider:       s.Provider,
+		UserAgent:      s.UserAgent,
+		IP:             s.IP,
+		Browser:        s.Device.Browser,
+		OS:             s.Device.OS,
+		Device:         s.Device.Type,
+		Country:        s.Location.Country,
+		City:           s.Location.City,
+		ImpersonatorID: s.ImpersonatorID,
+		Current:        s.Handle == curSid,
+		ExpiresAt:      time.Unix(s.ExpiresAt, 0),
+		CreatedAt:      s.CreatedAt,
+	}
+}
+
+type activityListRequest struct {
+	Page    int `form:"page" binding:"omitempty,gte=1"`
+	PerPage int `form:"per_page" binding:"omitempty,gte=1,lte=100"`
+}
+
+type activityResponse struct {
+	Type      string `json:"type"`
+	Result    string `json:"result"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"userAgent"`
+	// ByOther is set if the action was performed by an admin rather than the account owner.
+	ByOther   bool      `json:"byOther"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type activityListResponse struct {
+	Events  []activityResponse `json:"events"`
+	Page    int                `json:"page"`
+	PerPage int                `json:"perPage"`
+	Total   int64              `json:"total"`
+}
+
+func newActivityResponse(e domain.AuditEvent) activityResponse {
+	return activityResponse{
+		Type:      e.Type,
+		Result:    e.Result,
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		ByOther:   e.ByOther(),
+		CreatedAt: e.CreatedAt,
+	}
+}
+
+type eventResponse struct {
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"createdAt"`
+}
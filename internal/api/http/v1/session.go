@@ -5,10 +5,14 @@ import (
 	"github.com/gin-gonic/gin"
 	"go-authentication/config"
 	"go-authentication/internal/apperrors"
+	"go-authentication/internal/domain"
 	"go-authentication/internal/service"
+	"go-authentication/pkg/ratelimit"
 	"go-authentication/pkg/utils"
+	"io"
 	"log/slog"
 	"net/http"
+	"time"
 )
 
 type sessionHandler struct {
@@ -22,19 +26,27 @@ func newSessionHandler(
 	l *slog.Logger,
 	cfg *config.Config,
 	sess service.Session,
-	auth service.Auth) {
+	auth service.Auth,
+	limiter ratelimit.Limiter) {
 
 	h := &sessionHandler{l: l, cfg: cfg, sess: sess}
 	g := handler.Group("/session")
 	{
-		authenticated := g.Group("/", sessionMiddleware(l, cfg, sess))
+		authenticated := g.Group("/",
+			rateLimitMiddleware(l, cfg, limiter, "session"),
+			sessionMiddleware(l, cfg, sess),
+			accountRateLimitMiddleware(l, cfg, limiter, "session"))
 		{
-			secure := authenticated.Group("/", tokenMiddleware(l, cfg, auth))
+			secure := authenticated.Group("/", denyImpersonationMiddleware(l), tokenMiddleware(l, cfg, auth))
 			{
 				secure.DELETE(":sessionID", h.terminate)
 				secure.DELETE("", h.terminateAll)
 			}
-			authenticated.GET(":sessionID", h.get)
+			authenticated.GET("events", h.events)
+			if cfg.ListsSessions() {
+				authenticated.GET("", h.list)
+				authenticated.GET(":sessionID", h.get)
+			}
 		}
 	}
 }
@@ -51,12 +63,24 @@ func (h *sessionHandler) terminate(c *gin.Context) {
 		return
 	}
 
-	err = h.sess.Terminate(c.Request.Context(), curSid, c.Param("sessionID"))
+	aid, err := getAccountID(c)
+	if err != nil {
+		l.Error("can't get account id", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	err = h.sess.Terminate(c.Request.Context(), aid, curSid, c.Param("sessionID"))
 	if err != nil {
 		if errors.Is(err, apperrors.ErrorCurrentSessionTerminating) {
 			c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse{Error: apperrors.ErrorCurrentSessionTerminating.Error()})
 			return
 		}
+		if errors.Is(err, apperrors.ErrorSessionNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, errorResponse{Error: apperrors.ErrorSessionNotFound.Error()})
+			return
+		}
+		l.Error("can't terminate session", slog.String("error", err.Error()))
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
@@ -84,7 +108,7 @@ func (h *sessionHandler) terminateAll(c *gin.Context) {
 		return
 	}
 
-	err = h.sess.TerminateAll(c.Request.Context(), curSid, aid)
+	err = h.sess.TerminateAll(c.Request.Context(), aid, curSid)
 	if err != nil {
 		l.Error("can't terminate sessions", slog.String("error", err.Error()))
 		c.AbortWithStatus(http.StatusInternalServerError)
@@ -97,10 +121,65 @@ func (h *sessionHandler) terminateAll(c *gin.Context) {
 	return
 }
 
+func (h *sessionHandler) list(c *gin.Context) {
+	const op = "api.list"
+	l := h.l.With(slog.String(utils.Operation, op))
+
+	var r sessionListRequest
+
+	if err := c.ShouldBindQuery(&r); err != nil {
+		l.Error("can't bind session list query", slog.String("error", err.Error()))
+		c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse{Error: apperrors.ErrorValidate.Error()})
+		return
+	}
+
+	curSid, err := getSessionID(c)
+	if err != nil {
+		l.Error("can't get session id", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	aid, err := getAccountID(c)
+	if err != nil {
+		l.Error("can't get account id", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	p := domain.NewPagination(r.Page, r.PerPage, r.Sort, r.Order != "asc")
+
+	sessions, total, err := h.sess.List(c.Request.Context(), aid, p)
+	if err != nil {
+		l.Error("can't get sessions", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	resp := sessionListResponse{
+		Sessions: make([]sessionResponse, 0, len(sessions)),
+		Page:     p.Page,
+		PerPage:  p.PerPage,
+		Total:    total,
+	}
+	for _, s := range sessions {
+		resp.Sessions = append(resp.Sessions, newSessionResponse(s, curSid))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
 func (h *sessionHandler) get(c *gin.Context) {
 	const op = "api.get"
 	l := h.l.With(slog.String(utils.Operation, op))
 
+	curSid, err := getSessionID(c)
+	if err != nil {
+		l.Error("can't get session id", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
 	aid, err := getAccountID(c)
 	if err != nil {
 		l.Error("can't get account id", slog.String("error", err.Error()))
@@ -108,12 +187,75 @@ func (h *sessionHandler) get(c *gin.Context) {
 		return
 	}
 
-	sessions, err := h.sess.GetAll(c.Request.Context(), aid)
+	s, err := h.sess.GetByAccount(c.Request.Context(), aid, c.Param("sessionID"))
 	if err != nil {
-		l.Error("can't get sessions", slog.String("error", err.Error()))
+		if errors.Is(err, apperrors.ErrorSessionNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, errorResponse{Error: apperrors.ErrorSessionNotFound.Error()})
+			return
+		}
+		l.Error("can't get session", slog.String("error", err.Error()))
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-	c.AbortWithStatusJSON(http.StatusOK, sessions)
 
+	c.JSON(http.StatusOK, newSessionResponse(s, curSid))
+}
+
+func (h *sessionHandler) events(c *gin.Context) {
+	const op = "api.events"
+	l := h.l.With(slog.String(utils.Operation, op))
+
+	curSid, err := getSessionID(c)
+	if err != nil {
+		l.Error("can't get session id", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	aid, err := getAccountID(c)
+	if err != nil {
+		l.Error("can't get account id", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	events, err := h.sess.Subscribe(ctx, aid, curSid)
+	if err != nil {
+		l.Error("can't subscribe to events", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// the stream lives longer than the server write timeout
+	if err = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		l.Warn("can't reset write deadline", slog.String("error", err.Error()))
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(h.cfg.Events.Heartbeat)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(e.Type, eventResponse{Type: e.Type, CreatedAt: e.CreatedAt})
+
+			// terminated session or deleted account can't be used anymore
+			return e.Type == domain.EventPasswordChanged
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": ping\n\n")
+			return err == nil
+		case <-ctx.Done():
+			return false
+		}
+	})
 }
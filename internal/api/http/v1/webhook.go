@@ -0,0 +1,178 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go-authentication/config"
+	"go-authentication/internal/apperrors"
+	"go-authentication/internal/domain"
+	"go-authentication/internal/service"
+	"go-authentication/pkg/ratelimit"
+	"go-authentication/pkg/utils"
+	"log/slog"
+	"net/http"
+)
+
+type webhookHandler struct {
+	l   *slog.Logger
+	cfg *config.Config
+
+	webhooks service.Webhook
+}
+
+func newWebhookHandler(
+	handler *gin.RouterGroup,
+	l *slog.Logger,
+	cfg *config.Config,
+	sess service.Session,
+	roles service.Role,
+	webhooks service.Webhook,
+	limiter ratelimit.Limiter) {
+
+	h := &webhookHandler{l: l, cfg: cfg, webhooks: webhooks}
+
+	g := handler.Group("/admin/webhooks",
+		rateLimitMiddleware(l, cfg, limiter, "admin"),
+		sessionMiddleware(l, cfg, sess),
+		accountRateLimitMiddleware(l, cfg, limiter, "admin"),
+		denyImpersonationMiddleware(l),
+		requirePermission(l, roles, domain.PermissionWebhooksAdmin))
+	{
+		g.GET("", h.list)
+		g.POST("", h.create)
+
+		w := g.Group("/:webhookID", webhookParamMiddleware(l))
+		{
+			w.GET("", h.get)
+			w.DELETE("", h.delete)
+			w.GET("/deliveries", h.deliveries)
+		}
+	}
+}
+
+func (h *webhookHandler) create(c *gin.Context) {
+	const op = "api.webhook.create"
+	l := h.l.With(slog.String(utils.Operation, op))
+
+	var r webhookCreateRequest
+
+	if err := c.ShouldBindJSON(&r); err != nil {
+		l.Error("can't unmarshal webhook request", slog.String("error", err.Error()))
+		c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse{Error: apperrors.ErrorValidate.Error()})
+		return
+	}
+
+	w, err := h.webhooks.Create(c.Request.Context(), r.URL, r.Events)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrorWebhookURLForbidden) {
+			l.Warn("webhook url is forbidden", slog.String("error", err.Error()))
+			c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse{Error: apperrors.ErrorWebhookURLForbidden.Error()})
+			return
+		}
+		l.Error("can't create webhook", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusCreated, webhookCreateResponse{Webhook: w, Secret: w.Secret})
+}
+
+func (h *webhookHandler) list(c *gin.Context) {
+	const op = "api.webhook.list"
+	l := h.l.With(slog.String(utils.Operation, op))
+
+	webhooks, err := h.webhooks.List(c.Request.Context())
+	if err != nil {
+		l.Error("can't get webhooks", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhookListResponse{Webhooks: append([]domain.Webhook{}, webhooks...)})
+}
+
+func (h *webhookHandler) get(c *gin.Context) {
+	const op = "api.webhook.get"
+	l := h.l.With(slog.String(utils.Operation, op))
+
+	w, err := h.webhooks.Get(c.Request.Context(), c.Param("webhookID"))
+	if err != nil {
+		if abortWebhookNotFound(c, err) {
+			return
+		}
+		l.Error("can't get webhook", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, w)
+}
+
+func (h *webhookHandler) delete(c *gin.Context) {
+	const op = "api.webhook.delete"
+	l := h.l.With(slog.String(utils.Operation, op))
+
+	if err := h.webhooks.Delete(c.Request.Context(), c.Param("webhookID")); err != nil {
+		if abortWebhookNotFound(c, err) {
+			return
+		}
+		l.Error("can't delete webhook", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *webhookHandler) deliveries(c *gin.Context) {
+	const op = "api.webhook.deliveries"
+	l := h.l.With(slog.String(utils.Operation, op))
+
+	var r webhookDeliveryListRequest
+
+	if err := c.ShouldBindQuery(&r); err != nil {
+		l.Error("can't bind delivery list query", slog.String("error", err.Error()))
+		c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse{Error: apperrors.ErrorValidate.Error()})
+		return
+	}
+
+	p := domain.NewPagination(r.Page, r.PerPage, "", true)
+
+	deliveries, total, err := h.webhooks.Deliveries(c.Request.Context(), c.Param("webhookID"), p)
+	if err != nil {
+		if abortWebhookNotFound(c, err) {
+			return
+		}
+		l.Error("can't get webhook deliveries", slog.String("error", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhookDeliveryListResponse{
+		Deliveries: deliveries,
+		Page:       p.Page,
+		PerPage:    p.PerPage,
+		Total:      total,
+	})
+}
+
+// webhookParamMiddleware responds 404 if the webhook id path parameter is not a valid id.
+func webhookParamMiddleware(l *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := uuid.Parse(c.Param("webhookID")); err != nil {
+			l.Warn("invalid webhook id", slog.String("webhook_id", c.Param("webhookID")))
+			c.AbortWithStatusJSON(http.StatusNotFound, errorResponse{Error: apperrors.ErrorWebhookNotFound.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+func abortWebhookNotFound(c *gin.Context, err error) bool {
+	if !errors.Is(err, apperrors.ErrorWebhookNotFound) {
+		return false
+	}
+	c.AbortWithStatusJSON(http.StatusNotFound, errorResponse{Error: apperrors.ErrorWebhookNotFound.Error()})
+	return true
+}
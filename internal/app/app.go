@@ -1,22 +1,41 @@
 package app
 
 import (
+	"context"
+	"expvar"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/segmentio/kafka-go"
 	"go-authentication/config"
 	v1 "go-authentication/internal/api/http/v1"
+	"go-authentication/internal/broker"
+	"go-authentication/internal/mailer"
+	"go-authentication/internal/notifier"
+	"go-authentication/internal/publisher"
 	"go-authentication/internal/repository"
 	"go-authentication/internal/service"
 	"go-authentication/pkg/JWT"
+	"go-authentication/pkg/geoip"
 	"go-authentication/pkg/httpserver"
 	"go-authentication/pkg/logger"
+	"go-authentication/pkg/mail"
 	"go-authentication/pkg/mongodb"
+	"go-authentication/pkg/passpolicy"
+	"go-authentication/pkg/password"
 	"go-authentication/pkg/postgres"
+	"go-authentication/pkg/ratelimit"
+	"go-authentication/pkg/redis"
+	"go-authentication/pkg/sealer"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	//"sso/pkg/postgres"
 	"go-authentication/pkg/utils"
+	"go-authentication/pkg/webhook"
+	"strings"
 	"syscall"
 )
 
@@ -40,39 +59,315 @@ func Run(cfg *config.Config) {
 	}
 	defer pg.Close()
 
-	//MongoDB
-	mCl, err := mongodb.NewClient(cfg.MongoDB.URI, cfg.MongoDB.Username, cfg.MongoDB.Password)
-	if err != nil {
-		l.Error("can't connect to mongodb",
-			slog.String("error", err.Error()))
-		return
+	// ctx is canceled on shutdown to stop background workers
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Redis is connected on first use, only if some component is configured to use it
+	var rCl *goredis.Client
+	redisClient := func() (*goredis.Client, error) {
+		if rCl != nil {
+			return rCl, nil
+		}
+		var err error
+		rCl, err = redis.NewClient(cfg.Redis.Addr, cfg.Redis.Password)
+		return rCl, err
 	}
-	mDB := mCl.Database(cfg.MongoDB.DbName)
+	defer func() {
+		if rCl != nil {
+			rCl.Close()
+		}
+	}()
 
 	// Repositories
 	accountRepo := repository.NewAccountRepo(log, pg)
-	sessionRepo := repository.NewSessionRepo(mDB, log)
+	rememberTokenRepo := repository.NewRememberTokenRepo(log, pg)
+	passwordHistoryRepo := repository.NewPasswordHistoryRepo(log, pg)
+	roleRepo := repository.NewRoleRepo(log, pg)
+	auditRepo := repository.NewAuditRepo(log, pg)
+	webhookRepo := repository.NewWebhookRepo(log, pg)
+	outboxRepo := repository.NewOutboxRepo(log, pg)
+	deviceRepo := repository.NewDeviceRepo(log, pg)
+	accountTokenRepo := repository.NewAccountTokenRepo(log, pg)
+
+	var sessionRepo service.SessionRepo
+	switch cfg.Session.Store {
+	case "cookie":
+		s, err := sealer.New(cfg.Session.CookieKeys...)
+		if err != nil {
+			l.Error("can't create session sealer", slog.String("error", err.Error()))
+			return
+		}
+
+		var denylist repository.Denylist
+		switch cfg.Session.Denylist {
+		case "redis":
+			rc, err := redisClient()
+			if err != nil {
+				l.Error("can't connect to redis", slog.String("error", err.Error()))
+				return
+			}
+			denylist = repository.NewRedisDenylist(rc, "session-denylist:")
+		default:
+			denylist = repository.NewMemoryDenylist()
+		}
+
+		sessionRepo = repository.NewCookieSessionRepo(log, s, denylist, cfg.Session.TTL)
+	default:
+		//MongoDB
+		mCl, err := mongodb.NewClient(cfg.MongoDB.URI, cfg.MongoDB.Username, cfg.MongoDB.Password)
+		if err != nil {
+			l.Error("can't connect to mongodb",
+				slog.String("error", err.Error()))
+			return
+		}
+		mDB := mCl.Database(cfg.MongoDB.DbName)
+
+		mongoSessions := repository.NewSessionRepo(mDB, log, cfg.Session)
+		if err = mongoSessions.EnsureIndexes(ctx); err != nil {
+			l.Error("can't create session indexes", slog.String("error", err.Error()))
+			return
+		}
+		sessionRepo = mongoSessions
+	}
+
+	// Session cache
+	if cfg.SessionCache.CacheSize > 0 {
+		var bus repository.SessionCacheBus
+		if cfg.SessionCache.CacheInvalidation == "redis" {
+			rc, err := redisClient()
+			if err != nil {
+				l.Error("can't connect to redis", slog.String("error", err.Error()))
+				return
+			}
+			bus = repository.NewRedisCacheBus(rc, cfg.SessionCache.CacheRedisChannel)
+		}
+
+		cache := repository.NewSessionCache(ctx, log, sessionRepo,
+			cfg.SessionCache.CacheSize, cfg.SessionCache.CacheTTL, bus)
+		expvar.Publish("session_cache", expvar.Func(func() any { return cache.Stats() }))
+
+		sessionRepo = cache
+	}
+
+	// GeoIP
+	var geo service.GeoLocator
+	if cfg.GeoIP.DBPath != "" {
+		resolver, err := geoip.New(cfg.GeoIP.DBPath)
+		if err != nil {
+			l.Error("can't open geoip database", slog.String("error", err.Error()))
+			return
+		}
+		defer resolver.Close()
+		geo = resolver
+	}
+
+	// Events
+	var events service.EventBroker
+	switch cfg.Events.Broker {
+	case "redis":
+		rc, err := redisClient()
+		if err != nil {
+			l.Error("can't connect to redis", slog.String("error", err.Error()))
+			return
+		}
+
+		rb, err := broker.NewRedisBroker(ctx, log, rc, cfg.Events.RedisChannel)
+		if err != nil {
+			l.Error("can't create redis broker", slog.String("error", err.Error()))
+			return
+		}
+		defer rb.Close()
+		events = rb
+	default:
+		events = broker.NewMemoryBroker(log)
+	}
+
+	// Password hashing
+	argon2id := password.Argon2id{
+		Memory:      cfg.PasswordHash.Argon2Memory,
+		Iterations:  cfg.PasswordHash.Argon2Iterations,
+		Parallelism: cfg.PasswordHash.Argon2Parallelism,
+	}
+	bcrypt := password.Bcrypt{Cost: cfg.PasswordHash.BcryptCost}
+
+	var hasher *password.Hasher
+	switch cfg.PasswordHash.HashAlgorithm {
+	case "bcrypt":
+		hasher = password.New(bcrypt, argon2id)
+	default:
+		hasher = password.New(argon2id, bcrypt)
+	}
+
+	// Password policy
+	policy := passpolicy.Policy{
+		MinLength:        cfg.PasswordMinLength,
+		MaxLength:        cfg.PasswordMaxLength,
+		MinScore:         cfg.PasswordMinScore,
+		RejectUserInputs: cfg.PasswordRejectUserInputs,
+	}
+	if cfg.BreachedListPath != "" {
+		policy.Breached, err = passpolicy.LoadBreachedList(cfg.BreachedListPath)
+		if err != nil {
+			l.Error("can't load breached passwords", slog.String("error", err.Error()))
+			return
+		}
+		l.Info("breached passwords loaded", slog.Int("count", policy.Breached.Len()))
+	}
+
+	// Mail
+	templates, err := mailer.LoadTemplates(cfg.MailLocale)
+	if err != nil {
+		l.Error("can't load email templates", slog.String("error", err.Error()))
+		return
+	}
+
+	var transport service.Mailer
+	switch cfg.MailTransport {
+	case "smtp":
+		client := mail.NewSMTP(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPSecurity, cfg.SMTPTimeout)
+		transport = mailer.NewSMTPMailer(client, cfg.MailFrom)
+	case "file":
+		transport, err = mailer.NewFileMailer(cfg.MailFrom, cfg.MailDir)
+		if err != nil {
+			l.Error("can't create file mailer", slog.String("error", err.Error()))
+			return
+		}
+	default:
+		transport = mailer.NewConsoleMailer(cfg.MailFrom, os.Stdout)
+	}
+
+	mailQueue := mailer.NewQueue(log, transport, mailer.QueueOptions{
+		Size:        cfg.MailQueueSize,
+		Workers:     cfg.MailWorkers,
+		MaxAttempts: cfg.MailMaxAttempts,
+		BackoffBase: cfg.MailBackoffBase,
+		Timeout:     cfg.SMTPTimeout,
+	})
+	go mailQueue.Run(ctx)
+
+	accountNotifier := notifier.NewEmailNotifier(mailQueue, templates, cfg.MailLocale, cfg.MailAppName, cfg.MailBaseURL)
+
+	var attempts service.LoginAttemptStore
+	switch cfg.LoginThrottle.ThrottleStore {
+	case "redis":
+		rc, err := redisClient()
+		if err != nil {
+			l.Error("can't connect to redis", slog.String("error", err.Error()))
+			return
+		}
+		attempts = repository.NewRedisLoginAttempts(rc, "login-attempts:")
+	default:
+		attempts = repository.NewMemoryLoginAttempts()
+	}
 
 	// Services
-	accountService := service.NewAccountService(cfg, log, accountRepo, sessionRepo)
-	sessionService := service.NewSessionService(cfg, sessionRepo)
+	accountService := service.NewAccountService(
+		cfg, log, accountRepo, sessionRepo, events, accountNotifier, hasher, attempts, policy, passwordHistoryRepo, roleRepo, auditRepo, outboxRepo,
+		accountTokenRepo, rememberTokenRepo, pg)
+	sessionService := service.NewSessionService(cfg, log, sessionRepo, rememberTokenRepo, events, geo, auditRepo, outboxRepo)
+	deviceService := service.NewDeviceService(
+		cfg, log, deviceRepo, accountTokenRepo, accountNotifier, sessionService, accountService, auditRepo, pg)
+	roleService := service.NewRoleService(cfg, log, roleRepo, accountRepo)
+	adminService := service.NewAdminService(cfg, log, accountRepo, accountService, roleRepo, sessionService, auditRepo)
+
+	webhookService := service.NewWebhookService(
+		cfg, log, webhookRepo, webhook.NewClient(cfg.Webhooks.WebhookTimeout, cfg.Webhooks.WebhookAllowPrivate), auditRepo)
+
+	// Outbox, webhooks are always fed from it
+	var eventPublisher service.EventPublisher
+	switch cfg.Outbox.OutboxPublisher {
+	case "nats":
+		nc, err := nats.Connect(cfg.Outbox.NATSURL, nats.Name("go-authentication"), nats.Timeout(cfg.Outbox.NATSTimeout))
+		if err != nil {
+			l.Error("can't connect to nats", slog.String("error", err.Error()))
+			return
+		}
+		defer nc.Close()
+		eventPublisher = publisher.NewNATSPublisher(nc, cfg.Outbox.NATSSubjectPrefix, cfg.Outbox.NATSTimeout)
+	case "kafka":
+		kw := &kafka.Writer{
+			Addr:         kafka.TCP(strings.Split(cfg.Outbox.KafkaBrokers, ",")...),
+			Topic:        cfg.Outbox.KafkaTopic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			WriteTimeout: cfg.Outbox.KafkaTimeout,
+		}
+		defer kw.Close()
+		eventPublisher = publisher.NewKafkaPublisher(kw)
+	case "memory":
+		eventPublisher = publisher.NewMemoryPublisher()
+	default:
+		eventPublisher = publisher.NewLogPublisher(log)
+	}
+	outboxRelay := service.NewOutboxRelay(cfg, log, outboxRepo, webhookService, eventPublisher)
+
+	sessionReconciler := service.NewSessionReconciler(cfg, log, accountRepo, sessionRepo)
+
+	auditChainService := service.NewAuditChainService(cfg, log, auditRepo)
+	go auditChainService.Run(ctx)
+	go webhookService.Run(ctx)
+	go outboxRelay.Run(ctx)
+	if cfg.ListsSessions() {
+		go sessionReconciler.Run(ctx)
+	} else {
+		l.Info("session store can't list sessions, reconciliation of orphaned sessions is disabled")
+	}
+
+	if err = roleService.SeedAdmin(ctx); err != nil {
+		l.Error("can't seed admin", slog.String("error", err.Error()))
+		return
+	}
 
 	jwt, err := JWT.New(cfg.AccessToken.SigningKey, cfg.AccessToken.TTL)
 	if err != nil {
 		l.Error("can't create jwt token", slog.String("error", err.Error()))
 		return
 	}
-	authService := service.NewAuthService(log, jwt, accountService, sessionService)
+
+	authService := service.NewAuthService(cfg, log, jwt, accountService, sessionService, deviceService, attempts, hasher, roleService, auditRepo)
+
+	// Rate limiter
+	var limiter ratelimit.Limiter
+	switch cfg.RateLimit.RateLimitStore {
+	case "redis":
+		rc, err := redisClient()
+		if err != nil {
+			l.Error("can't connect to redis", slog.String("error", err.Error()))
+			return
+		}
+		limiter = ratelimit.NewRedis(rc, "rate-limit:")
+	default:
+		limiter = ratelimit.NewMemory()
+	}
 
 	// Handlers v1
 	handler := gin.New()
-	v1.SetupHandlers(handler, log, cfg, accountService, sessionService, authService)
+	v1.SetupHandlers(handler, log, cfg, accountService, sessionService, authService, deviceService, roleService, adminService, webhookService, limiter)
 
 	// HTTP Server
 	httpServer := httpserver.New(handler, httpserver.Port(cfg.HTTP.Port))
 	l.Info("server is up and running",
 		slog.String("port", cfg.HTTP.Port))
 
+	// Debug server, kept off the public listener
+	var debugNotify <-chan error
+	if cfg.HTTP.DebugAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/debug/vars", expvar.Handler())
+
+		debugServer := httpserver.New(mux, httpserver.Addr(cfg.HTTP.DebugAddr))
+		defer func() {
+			if err := debugServer.Shutdown(); err != nil {
+				l.Error(fmt.Sprintf("app - Run - debugServer.Shutdown: %s", err.Error()))
+			}
+		}()
+		debugNotify = debugServer.Notify()
+
+		l.Info("debug server is up and running",
+			slog.String("addr", cfg.HTTP.DebugAddr))
+	}
+
 	// Waiting signal
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, syscall.SIGTERM, syscall.SIGINT)
@@ -84,6 +379,9 @@ func Run(cfg *config.Config) {
 	case err := <-httpServer.Notify():
 		l.Error("http server got error, shutting down...",
 			slog.String("error", err.Error()))
+	case err := <-debugNotify:
+		l.Error("debug server got error, shutting down...",
+			slog.String("error", err.Error()))
 	}
 
 	// Shutdown
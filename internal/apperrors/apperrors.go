@@ -1,6 +1,12 @@
 package apperrors
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"go-authentication/pkg/passpolicy"
+	"strings"
+	"time"
+)
 
 // account errors
 var (
@@ -8,26 +14,97 @@ var (
 	ErrorAccountNotFound             = errors.New("account not found")
 	ErrorAccountPasswordNotGenerated = errors.New("password hash generation error")
 	ErrorAccountWrongPassword        = errors.New("wrong password")
+	ErrorPasswordPolicy              = errors.New("password doesn't satisfy the password policy")
+	ErrorAccountLocked               = errors.New("account is locked")
+	ErrorPasswordResetRequired       = errors.New("password reset is required")
 	ErrorValidate                    = errors.New("some fields are incorrect")
 	ErrorContextAccountIdNotFount    = errors.New("account id in context not found")
 )
 
+// PasswordPolicyError is returned when password violates the policy, it matches ErrorPasswordPolicy.
+type PasswordPolicyError struct {
+	Violations []passpolicy.Violation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	codes := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		codes = append(codes, v.Code)
+	}
+	return fmt.Sprintf("%s: %s", ErrorPasswordPolicy, strings.Join(codes, ", "))
+}
+
+func (e *PasswordPolicyError) Is(target error) bool {
+	return target == ErrorPasswordPolicy
+}
+
 // auth errors
 var (
 	ErrorLoginOrPasswordIncorrect = errors.New("wrong login or password")
+	ErrorTooManyLoginAttempts     = errors.New("too many login attempts, try again later")
 )
 
+// TooManyAttemptsError is returned when login is throttled, it matches ErrorTooManyLoginAttempts.
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("%s: retry after %s", ErrorTooManyLoginAttempts, e.RetryAfter)
+}
+
+func (e *TooManyAttemptsError) Is(target error) bool {
+	return target == ErrorTooManyLoginAttempts
+}
+
 // session errors
 var (
 	ErrorSessionNotCreated         = errors.New("error occurred while creating session")
+	ErrorSessionNotFound           = errors.New("session not found")
+	ErrorSessionAlreadyExists      = errors.New("session already exists")
+	ErrorSessionStoreUnsupported   = errors.New("operation is not supported by session store")
 	ErrorSessionDeviceMismatch     = errors.New("device doesn't match with device of current session")
 	ErrorContextSessionNotFound    = errors.New("session id not found in context ")
 	ErrorCurrentSessionTerminating = errors.New("current session cannot be terminated, use logout instead")
 )
 
+// remember token errors
+var (
+	ErrorRememberTokenNotCreated = errors.New("error occurred while creating remember token")
+	ErrorRememberTokenNotFound   = errors.New("remember token not found")
+	ErrorRememberTokenInvalid    = errors.New("remember token is invalid")
+	ErrorRememberTokenReused     = errors.New("remember token was already used, series revoked")
+)
+
+// account token errors
+var (
+	ErrorAccountTokenNotCreated = errors.New("error occurred while creating token")
+	ErrorAccountTokenInvalid    = errors.New("token is invalid, expired or already used")
+)
+
+// rbac errors
+var (
+	ErrorRoleNotFound           = errors.New("role not found")
+	ErrorRoleNotAssigned        = errors.New("role is not assigned to the account")
+	ErrorPermissionDenied       = errors.New("permission denied")
+	ErrorImpersonationForbidden = errors.New("action is not allowed in impersonated session")
+)
+
+// webhook errors
+var (
+	ErrorWebhookNotFound     = errors.New("webhook not found")
+	ErrorWebhookURLForbidden = errors.New("webhook url must be http(s) and resolve to public addresses")
+)
+
+// http errors
+var (
+	ErrorRateLimitExceeded = errors.New("rate limit exceeded, try again later")
+)
+
 // jwt errors
 var (
 	ErrNoSigningKey         = errors.New("empty signing key")
 	ErrNoClaims             = errors.New("error getting claims from token")
 	ErrUnexpectedSignMethod = errors.New("unexpected signing method")
+	ErrRolesChanged         = errors.New("roles of the subject changed since the token was issued")
 )
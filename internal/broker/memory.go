@@ -0,0 +1,74 @@
+package broker
+
+import (
+	"context"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/utils"
+	"log/slog"
+	"sync"
+)
+
+// _subscriberBuffer is a number of events buffered for a slow subscriber before new events are dropped.
+const _subscriberBuffer = 16
+
+// memoryBroker delivers events to subscribers of the current process only.
+type memoryBroker struct {
+	log *slog.Logger
+
+	mu   sync.RWMutex
+	subs map[string]map[chan domain.Event]struct{}
+}
+
+func NewMemoryBroker(log *slog.Logger) *memoryBroker {
+	return &memoryBroker{log: log, subs: make(map[string]map[chan domain.Event]struct{})}
+}
+
+// Publish delivers event to local subscribers of the event account.
+func (b *memoryBroker) Publish(_ context.Context, e domain.Event) error {
+	b.deliver(e)
+	return nil
+}
+
+func (b *memoryBroker) deliver(e domain.Event) {
+	const op = "broker.memory.deliver"
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch := range b.subs[e.AccountID] {
+		select {
+		case ch <- e:
+		default:
+			b.log.Warn("subscriber is too slow, event dropped",
+				slog.String(utils.Operation, op),
+				slog.String("type", e.Type))
+		}
+	}
+}
+
+// Subscribe returns channel of events of given account, the channel is closed when ctx is done.
+func (b *memoryBroker) Subscribe(ctx context.Context, aid string) (<-chan domain.Event, error) {
+	ch := make(chan domain.Event, _subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subs[aid] == nil {
+		b.subs[aid] = make(map[chan domain.Event]struct{})
+	}
+	b.subs[aid][ch] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		b.mu.Lock()
+		delete(b.subs[aid], ch)
+		if len(b.subs[aid]) == 0 {
+			delete(b.subs, aid)
+		}
+		b.mu.Unlock()
+
+		close(ch)
+	}()
+
+	return ch, nil
+}
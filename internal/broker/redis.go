@@ -0,0 +1,85 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/utils"
+	"log/slog"
+)
+
+// redisBroker publishes events to redis channel shared by all instances,
+// each instance listens to the channel and delivers events to its own subscribers.
+type redisBroker struct {
+	log     *slog.Logger
+	client  *redis.Client
+	channel string
+
+	local  *memoryBroker
+	pubsub *redis.PubSub
+}
+
+// NewRedisBroker subscribes to the channel and starts delivering received events to local subscribers.
+func NewRedisBroker(ctx context.Context, log *slog.Logger, client *redis.Client, channel string) (*redisBroker, error) {
+	const op = "broker.redis.new"
+
+	pubsub := client.Subscribe(ctx, channel)
+	// wait for subscription confirmation
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	b := &redisBroker{
+		log:     log,
+		client:  client,
+		channel: channel,
+		local:   NewMemoryBroker(log),
+		pubsub:  pubsub,
+	}
+
+	go b.listen()
+
+	return b, nil
+}
+
+func (b *redisBroker) listen() {
+	const op = "broker.redis.listen"
+	l := b.log.With(slog.String(utils.Operation, op))
+
+	for msg := range b.pubsub.Channel() {
+		var e domain.Event
+		if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+			l.Error("can't unmarshal event", slog.String("error", err.Error()))
+			continue
+		}
+		b.local.deliver(e)
+	}
+}
+
+// Publish sends event to all instances subscribed to the channel.
+func (b *redisBroker) Publish(ctx context.Context, e domain.Event) error {
+	const op = "broker.redis.publish"
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = b.client.Publish(ctx, b.channel, payload).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Subscribe returns channel of events of given account, the channel is closed when ctx is done.
+func (b *redisBroker) Subscribe(ctx context.Context, aid string) (<-chan domain.Event, error) {
+	return b.local.Subscribe(ctx, aid)
+}
+
+// Close stops listening to the channel.
+func (b *redisBroker) Close() error {
+	return b.pubsub.Close()
+}
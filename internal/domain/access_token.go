@@ -0,0 +1,10 @@
+package domain
+
+// AccessClaims are claims of the access token.
+type AccessClaims struct {
+	// Subject is an account id.
+	Subject string
+	Roles   []string
+	// Impersonator is an id of the admin account if the token is issued from an impersonated session.
+	Impersonator string
+}
@@ -1,42 +1,64 @@
 package domain
 
 import (
+	"errors"
 	"fmt"
 	"go-authentication/internal/apperrors"
+	"go-authentication/pkg/passpolicy"
+	"go-authentication/pkg/password"
 	"go-authentication/pkg/utils"
-	"golang.org/x/crypto/bcrypt"
 	"time"
 )
 
 type Account struct {
-	ID           string    `json:"id"`
-	Email        string    `json:"email"`
-	Username     string    `json:"username"`
-	Password     string    `json:"-"`
-	PasswordHash string    `json:"-"`
-	CreatedAt    time.Time `json:"createdAt"`
-	UpdatedAt    time.Time `json:"updatedAt"`
+	ID           string `json:"id"`
+	Email        string `json:"email"`
+	Username     string `json:"username"`
+	Password     string `json:"-"`
+	PasswordHash string `json:"-"`
+	// LockedAt is a time the account was locked by admin, nil if it is not locked.
+	LockedAt *time.Time `json:"lockedAt,omitempty"`
+	// PasswordResetRequired forbids login until the password is reset.
+	PasswordResetRequired bool `json:"passwordResetRequired"`
+	// Locale is a BCP 47 language tag of emails to the account, empty for the default locale.
+	Locale    string    `json:"locale,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
 }
 
-func (a *Account) GenPasswordHash() error {
+// AccountFilter is a filter of account search, zero fields are not applied.
+type AccountFilter struct {
+	// Email and Username match accounts containing them case-insensitively.
+	Email       string
+	Username    string
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+}
 
-	// the argument 11 represents the "cost" factor,
-	//indicating the number of iterations performed during password hashing.
-	//Typically, recommended values for cost range from 10 to 14,
-	//depending on security and performance requirements
-	b, err := bcrypt.GenerateFromPassword([]byte(a.Password), 11)
+func (a *Account) GenPasswordHash(h *password.Hasher) error {
+	hash, err := h.Hash(a.Password)
 	if err != nil {
-		return fmt.Errorf("bcrypt.GenerateFromPassword: %w", apperrors.ErrorAccountPasswordNotGenerated)
+		if errors.Is(err, password.ErrTooLong) {
+			// the limit of the algorithm is not known to the password policy
+			return &apperrors.PasswordPolicyError{Violations: []passpolicy.Violation{{
+				Code:    passpolicy.CodeTooLong,
+				Message: err.Error(),
+			}}}
+		}
+		return fmt.Errorf("%s: %w", err.Error(), apperrors.ErrorAccountPasswordNotGenerated)
 	}
 
-	a.PasswordHash = string(b)
+	a.PasswordHash = hash
 	return nil
 }
 
-func (a *Account) CompareHashAndPassword() error {
-	err := bcrypt.CompareHashAndPassword([]byte(a.PasswordHash), []byte(a.Password))
+func (a *Account) CompareHashAndPassword(h *password.Hasher) error {
+	err := h.VerifyPadded(a.Password, a.PasswordHash)
 	if err != nil {
-		return fmt.Errorf("bcrypt.CompareHashAndPassword: %w", apperrors.ErrorAccountWrongPassword)
+		if errors.Is(err, password.ErrMismatch) {
+			return fmt.Errorf("%s: %w", err.Error(), apperrors.ErrorAccountWrongPassword)
+		}
+		return err
 	}
 	return nil
 }
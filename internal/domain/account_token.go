@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"go-authentication/internal/apperrors"
+	"go-authentication/pkg/utils"
+	"time"
+)
+
+const _accountTokenLength = 32
+
+// Account token purposes.
+const (
+	TokenPasswordReset = "password_reset"
+	// TokenLoginRejection lets the owner reject a login from a new device.
+	TokenLoginRejection = "login_rejection"
+)
+
+// AccountToken is a one-time token sent to the account owner, only its hash is stored.
+type AccountToken struct {
+	Hash      string
+	Purpose   string
+	AccountID string
+	// SessionID is a handle of the session the token refers to, if any.
+	SessionID string
+	// DeviceID is a fingerprint of the device the token refers to, if any.
+	DeviceID  string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+
+	// Token is a raw token sent to the owner, never persisted.
+	Token string
+}
+
+func NewAccountToken(hashKey, purpose, aid string, ttl time.Duration) (AccountToken, error) {
+	token, err := utils.UniqueString(_accountTokenLength)
+	if err != nil {
+		return AccountToken{}, apperrors.ErrorAccountTokenNotCreated
+	}
+
+	now := time.Now()
+
+	return AccountToken{
+		Hash:      HashAccountToken(hashKey, token),
+		Purpose:   purpose,
+		AccountID: aid,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+		Token:     token,
+	}, nil
+}
+
+// HashAccountToken returns HMAC-SHA256 of the token which is used to look it up.
+func HashAccountToken(hashKey, token string) string {
+	return utils.HMACSHA256(hashKey, token)
+}
@@ -0,0 +1,135 @@
+package domain
+
+import (
+	"context"
+	"go-authentication/pkg/utils"
+	"time"
+)
+
+// Audit event types of account owner actions.
+const (
+	AuditLoginSucceeded     = "auth.login.succeeded"
+	AuditLoginFailed        = "auth.login.failed"
+	AuditLogout             = "auth.logout"
+	AuditAccessTokenIssued  = "auth.token.issued"
+	AuditSessionTerminated  = "session.terminated"
+	AuditSessionsTerminated = "session.terminated_all"
+	AuditSessionRestored    = "session.restored"
+	AuditRememberTokenReuse = "session.remember_token_reused"
+	AuditAccountCreated     = "account.created"
+	AuditAccountDeleted     = "account.deleted"
+	AuditPasswordChanged    = "account.password_changed"
+	AuditPasswordResetSent  = "account.password_reset.sent"
+	AuditPasswordReset      = "account.password_reset"
+	AuditNewDeviceLogin     = "auth.login.new_device"
+	AuditLoginRejected      = "auth.login.rejected"
+)
+
+// Audit event types of admin actions.
+const (
+	AuditAdminAccountsSearched    = "admin.accounts.searched"
+	AuditAdminAccountViewed       = "admin.account.viewed"
+	AuditAdminAccountLocked       = "admin.account.locked"
+	AuditAdminAccountUnlocked     = "admin.account.unlocked"
+	AuditAdminPasswordResetForced = "admin.password_reset.forced"
+	AuditAdminSessionsViewed      = "admin.sessions.viewed"
+	AuditAdminSessionsTerminated  = "admin.sessions.terminated"
+	AuditAdminImpersonated        = "admin.impersonated"
+	AuditAdminRolesViewed         = "admin.roles.viewed"
+	AuditAdminRoleAssigned        = "admin.role.assigned"
+	AuditAdminRoleRevoked         = "admin.role.revoked"
+	AuditAdminWebhookCreated      = "admin.webhook.created"
+	AuditAdminWebhookDeleted      = "admin.webhook.deleted"
+)
+
+// AuditAdminViews are types of events recorded when an admin only reads account data,
+// they aren't shown in the activity of the account.
+var AuditAdminViews = []string{AuditAdminAccountViewed, AuditAdminSessionsViewed, AuditAdminRolesViewed}
+
+// Lengths of the client fields of the event are bound by the audit_events columns.
+const (
+	_auditIPMaxLen        = 64
+	_auditUserAgentMaxLen = 512
+)
+
+// Audit event results.
+const (
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+// Actor is an account which performs the action and its client.
+type Actor struct {
+	// AccountID is empty if the client is not authenticated.
+	AccountID string
+	// ImpersonatorID is an id of the admin acting on behalf of AccountID.
+	ImpersonatorID string
+	IP             string
+	UserAgent      string
+}
+
+type actorKey struct{}
+
+// ContextWithActor returns context carrying the actor of the request.
+func ContextWithActor(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, a)
+}
+
+// ActorFromContext returns the actor of the request, it is empty for background jobs.
+func ActorFromContext(ctx context.Context) Actor {
+	a, _ := ctx.Value(actorKey{}).(Actor)
+	return a
+}
+
+// AuditEvent is an append-only record of a security relevant action.
+type AuditEvent struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+	// ActorID is an account performing the action, empty if it is unknown.
+	ActorID string `json:"actorId,omitempty"`
+	// TargetID is an account affected by the action.
+	TargetID  string         `json:"targetId,omitempty"`
+	IP        string         `json:"ip"`
+	UserAgent string         `json:"userAgent"`
+	Result    string         `json:"result"`
+	Details   map[string]any `json:"details,omitempty"`
+	CreatedAt time.Time      `json:"createdAt"`
+	// PrevHash and Hash link the event to the previous one, see ChainHash.
+	PrevHash string `json:"-"`
+	Hash     string `json:"-"`
+}
+
+// NewAuditEvent creates successful event of the actor affecting account targetID,
+// actions in impersonated sessions are attributed to the impersonator.
+func NewAuditEvent(typ string, actor Actor, targetID string) AuditEvent {
+	e := AuditEvent{
+		Type:      typ,
+		ActorID:   actor.AccountID,
+		TargetID:  targetID,
+		IP:        utils.Truncate(actor.IP, _auditIPMaxLen),
+		UserAgent: utils.Truncate(actor.UserAgent, _auditUserAgentMaxLen),
+		Result:    AuditResultSuccess,
+		Details:   make(map[string]any),
+		CreatedAt: time.Now(),
+	}
+	if actor.ImpersonatorID != "" {
+		e.ActorID = actor.ImpersonatorID
+		e.Details["impersonating"] = actor.AccountID
+	}
+	return e
+}
+
+// ByOther reports whether the action was performed by someone else than the target account,
+// actions of unauthenticated clients are attributed to the target.
+func (e AuditEvent) ByOther() bool {
+	return e.ActorID != "" && e.ActorID != e.TargetID
+}
+
+// WithResult sets result of the event by the error of the action.
+func (e AuditEvent) WithResult(err error) AuditEvent {
+	if err != nil {
+		e.Result = AuditResultFailure
+		e.Details["error"] = err.Error()
+	}
+	return e
+}
@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go-authentication/pkg/utils"
+	"time"
+)
+
+// ChainHash returns hash of the event linked to hash prev of the previous event,
+// changing any stored field of the event or the order of events changes the hash.
+func (e AuditEvent) ChainHash(prev string) (string, error) {
+	details := e.Details
+	if details == nil {
+		// stored as empty object, so it is read back as empty map
+		details = map[string]any{}
+	}
+
+	b, err := json.Marshal(struct {
+		Prev      string         `json:"prev"`
+		Type      string         `json:"type"`
+		ActorID   string         `json:"actorId"`
+		TargetID  string         `json:"targetId"`
+		IP        string         `json:"ip"`
+		UserAgent string         `json:"userAgent"`
+		Result    string         `json:"result"`
+		Details   map[string]any `json:"details"`
+		CreatedAt string         `json:"createdAt"`
+	}{
+		Prev:      prev,
+		Type:      e.Type,
+		ActorID:   e.ActorID,
+		TargetID:  e.TargetID,
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		Result:    e.Result,
+		Details:   details,
+		// postgres keeps microseconds only
+		CreatedAt: e.CreatedAt.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditCheckpoint is a signed head of the audit chain, it proves the chain up to EventID
+// existed in this form, since the chain can't be rebuilt without the signing key.
+type AuditCheckpoint struct {
+	ID        int64
+	EventID   int64
+	Hash      string
+	Signature string
+	CreatedAt time.Time
+}
+
+// NewAuditCheckpoint signs head of the chain: event eventID with chain hash.
+func NewAuditCheckpoint(key string, eventID int64, hash string) AuditCheckpoint {
+	return AuditCheckpoint{
+		EventID:   eventID,
+		Hash:      hash,
+		Signature: utils.HMACSHA256(key, checkpointMessage(eventID, hash)),
+		CreatedAt: time.Now(),
+	}
+}
+
+// Valid reports whether the checkpoint is signed with key.
+func (c AuditCheckpoint) Valid(key string) bool {
+	expected := utils.HMACSHA256(key, checkpointMessage(c.EventID, c.Hash))
+	return hmac.Equal([]byte(expected), []byte(c.Signature))
+}
+
+func checkpointMessage(eventID int64, hash string) string {
+	return fmt.Sprintf("%d:%s", eventID, hash)
+}
+
+// AuditChainReport is a result of the audit chain verification.
+type AuditChainReport struct {
+	// Unchained is a number of events written before the chain was introduced.
+	Unchained int64
+	// Checked is a number of verified chained events.
+	Checked int64
+	// Checkpoints is a number of verified checkpoints.
+	Checkpoints int
+	// BrokenAt is an id of the first event breaking the chain, 0 if the chain is intact.
+	BrokenAt int64
+	// Reason describes how the chain is broken.
+	Reason string
+}
+
+// Intact reports whether no broken event is found.
+func (r AuditChainReport) Intact() bool {
+	return r.Reason == ""
+}
@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"go-authentication/pkg/utils"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// KnownDevice is a device the account has logged in from.
+type KnownDevice struct {
+	AccountID string `json:"-"`
+	// Fingerprint identifies the device among devices of the account.
+	Fingerprint string    `json:"id"`
+	Browser     string    `json:"browser"`
+	OS          string    `json:"os"`
+	IP          string    `json:"ip"`
+	FirstSeenAt time.Time `json:"firstSeenAt"`
+	LastSeenAt  time.Time `json:"lastSeenAt"`
+}
+
+// _maxDeviceNameLen is a length of browser and OS columns of known devices.
+const _maxDeviceNameLen = 64
+
+// NewKnownDevice describes the client of the session. Browser and OS parsed from
+// arbitrary long user agents are truncated before fingerprinting, so they fit the storage.
+func NewKnownDevice(hashKey string, s Session) KnownDevice {
+	now := time.Now()
+
+	s.Device.Browser = utils.Truncate(s.Device.Browser, _maxDeviceNameLen)
+	s.Device.OS = utils.Truncate(s.Device.OS, _maxDeviceNameLen)
+
+	return KnownDevice{
+		AccountID:   s.AccountID,
+		Fingerprint: DeviceFingerprint(hashKey, s),
+		Browser:     s.Device.Browser,
+		OS:          s.Device.OS,
+		IP:          s.IP,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	}
+}
+
+// DeviceFingerprint returns keyed hash of browser, OS and network of the session client.
+// The address is reduced to /24 for IPv4 and /64 for IPv6, so reconnecting within
+// the same network doesn't make the device look new, versions are ignored for the same reason.
+func DeviceFingerprint(hashKey string, s Session) string {
+	network := s.IP
+	if addr, err := netip.ParseAddr(s.IP); err == nil {
+		addr = addr.Unmap()
+		bits := 64
+		if addr.Is4() {
+			bits = 24
+		}
+		if p, err := addr.Prefix(bits); err == nil {
+			network = p.String()
+		}
+	}
+
+	return utils.HMACSHA256(hashKey, withoutVersion(s.Device.Browser)+"|"+withoutVersion(s.Device.OS)+"|"+network)
+}
+
+// withoutVersion strips major version appended to browser or OS name, e.g. "Chrome 120".
+func withoutVersion(name string) string {
+	if i := strings.LastIndexByte(name, ' '); i > 0 && strings.Trim(name[i+1:], "0123456789") == "" {
+		return name[:i]
+	}
+	return name
+}
@@ -0,0 +1,12 @@
+package domain
+
+// Email is a message rendered from a template for a single recipient.
+type Email struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	// Template is a name and version of the template the email is rendered from, e.g. "already_registered.v1".
+	Template string
+	Locale   string
+}
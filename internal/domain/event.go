@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Event types pushed to connected clients.
+const (
+	EventSessionTerminated = "session.terminated"
+	EventPasswordChanged   = "password.changed"
+	EventAccountDeleted    = "account.deleted"
+)
+
+// Event types delivered only through the outbox.
+const (
+	EventAccountCreated = "account.created"
+	EventSessionCreated = "session.created"
+)
+
+// Event is a notification about a change of account or its sessions.
+type Event struct {
+	// ID identifies the event, it is kept when the event is published again, so consumers can drop duplicates.
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	AccountID string `json:"accountId"`
+	// SessionID is a handle of the affected session, empty if all sessions of the account are affected.
+	SessionID string `json:"sessionId,omitempty"`
+	// ExceptSessionID is a handle of the session which is not affected.
+	ExceptSessionID string    `json:"exceptSessionId,omitempty"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// OutboxEntry is an event claimed from the outbox for publishing.
+type OutboxEntry struct {
+	ID    int64
+	Event Event
+	// Attempts is a number of failed attempts to publish the event.
+	Attempts int
+}
+
+func NewEvent(typ, aid string) Event {
+	return Event{ID: uuid.NewString(), Type: typ, AccountID: aid, CreatedAt: time.Now()}
+}
+
+// Targets reports whether event affects session sid of account aid.
+func (e Event) Targets(aid, sid string) bool {
+	if e.AccountID != aid {
+		return false
+	}
+	if e.ExceptSessionID != "" && e.ExceptSessionID == sid {
+		return false
+	}
+	return e.SessionID == "" || e.SessionID == sid
+}
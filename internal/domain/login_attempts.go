@@ -0,0 +1,10 @@
+package domain
+
+import "time"
+
+// LoginAttempts is a state of failed login attempts of an account or an ip.
+type LoginAttempts struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
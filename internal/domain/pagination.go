@@ -0,0 +1,30 @@
+package domain
+
+const (
+	DefaultPerPage = 20
+	MaxPerPage     = 100
+)
+
+// Pagination describes a single page of a sorted listing.
+type Pagination struct {
+	Page     int
+	PerPage  int
+	SortBy   string
+	SortDesc bool
+}
+
+// NewPagination returns pagination with defaults applied to zero or out of range values.
+func NewPagination(page, perPage int, sortBy string, desc bool) Pagination {
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > MaxPerPage {
+		perPage = DefaultPerPage
+	}
+	return Pagination{Page: page, PerPage: perPage, SortBy: sortBy, SortDesc: desc}
+}
+
+// Offset returns number of records to skip.
+func (p Pagination) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"go-authentication/internal/apperrors"
+	"go-authentication/pkg/utils"
+	"strings"
+	"time"
+)
+
+const (
+	_rememberSelectorLength  = 16
+	_rememberValidatorLength = 32
+)
+
+// RememberToken is a long-lived persistent login token used to mint new sessions.
+// The selector identifies the series of tokens and never changes,
+// the validator is a secret which is replaced on every use, only its hash is stored.
+type RememberToken struct {
+	Selector      string
+	AccountID     string
+	ValidatorHash string
+	// PrevValidatorHash is a hash of the validator replaced at RotatedAt.
+	PrevValidatorHash string
+	RotatedAt         time.Time
+	ExpiresAt         time.Time
+	CreatedAt         time.Time
+
+	// Validator is a raw validator passed to the client, never persisted.
+	Validator string
+}
+
+func NewRememberToken(hashKey, aid string, ttl time.Duration) (RememberToken, error) {
+	selector, err := utils.UniqueString(_rememberSelectorLength)
+	if err != nil {
+		return RememberToken{}, apperrors.ErrorRememberTokenNotCreated
+	}
+
+	now := time.Now()
+
+	t := RememberToken{
+		Selector:  selector,
+		AccountID: aid,
+		RotatedAt: now,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if err = t.newValidator(hashKey); err != nil {
+		return RememberToken{}, err
+	}
+	return t, nil
+}
+
+// Rotate replaces validator keeping the hash of the previous one.
+func (t *RememberToken) Rotate(hashKey string) error {
+	t.PrevValidatorHash = t.ValidatorHash
+	t.RotatedAt = time.Now()
+	return t.newValidator(hashKey)
+}
+
+func (t *RememberToken) newValidator(hashKey string) error {
+	v, err := utils.UniqueString(_rememberValidatorLength)
+	if err != nil {
+		return apperrors.ErrorRememberTokenNotCreated
+	}
+	t.Validator = v
+	t.ValidatorHash = utils.HMACSHA256(hashKey, v)
+	return nil
+}
+
+// String returns token passed to the client in form "selector:validator".
+func (t RememberToken) String() string {
+	return t.Selector + ":" + t.Validator
+}
+
+// ParseRememberToken splits token passed by the client into selector and validator.
+func ParseRememberToken(token string) (selector, validator string, err error) {
+	selector, validator, ok := strings.Cut(token, ":")
+	if !ok || len(selector) != _rememberSelectorLength || len(validator) != _rememberValidatorLength {
+		return "", "", apperrors.ErrorRememberTokenInvalid
+	}
+	return selector, validator, nil
+}
@@ -0,0 +1,16 @@
+package domain
+
+// Roles created by migrations.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Permissions created by migrations.
+const (
+	PermissionSessionsAdmin = "sessions:admin"
+	PermissionAccountsAdmin = "accounts:admin"
+	PermissionRolesAdmin    = "roles:admin"
+	PermissionImpersonate   = "accounts:impersonate"
+	PermissionWebhooksAdmin = "webhooks:admin"
+)
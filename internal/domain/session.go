@@ -1,24 +1,56 @@
 package domain
 
 import (
+	"github.com/google/uuid"
 	"go-authentication/internal/apperrors"
 	"go-authentication/pkg/utils"
 	"time"
 )
 
+const (
+	// ProviderRememberMe is a provider of sessions created from persistent login token.
+	ProviderRememberMe = "remember_me"
+	// ProviderImpersonation is a provider of sessions opened by admin on behalf of the account.
+	ProviderImpersonation = "impersonation"
+)
+
 type Session struct {
-	ID        string    `json:"id" bson:"_id"`
-	AccountID string    `json:"accountId" bson:"accountId"`
-	Provider  string    `json:"provider" bson:"provider"`
-	UserAgent string    `json:"userAgent" bson:"userAgent"`
-	IP        string    `json:"ip" bson:"ip"`
-	TTL       int       `json:"ttl" bson:"ttl"`
-	ExpiresAt int64     `json:"expiresAt" bson:"expiresAt"`
+	// ID is a keyed hash of the session token, it is used as a lookup key in storage.
+	ID string `json:"-" bson:"_id"`
+	// Token is a raw session token passed to the client in the cookie, never persisted.
+	Token string `json:"-" bson:"-"`
+	// Handle is a public identifier of the session used by session management API.
+	Handle    string   `json:"id" bson:"handle"`
+	AccountID string   `json:"accountId" bson:"accountId"`
+	Provider  string   `json:"provider" bson:"provider"`
+	UserAgent string   `json:"userAgent" bson:"userAgent"`
+	IP        string   `json:"ip" bson:"ip"`
+	Device    Device   `json:"device" bson:"device"`
+	Location  Location `json:"location" bson:"location"`
+	// ImpersonatorID is an id of the admin account which opened the session on behalf of the account.
+	ImpersonatorID string `json:"impersonatorId,omitempty" bson:"impersonatorId,omitempty"`
+	TTL            int    `json:"ttl" bson:"ttl"`
+	// ExpiresAt is a unix time of the session expiration, session stores keep it in their own format.
+	ExpiresAt int64     `json:"expiresAt" bson:"-"`
 	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
 }
 
-func NewSession(aid, provider, userAgent, ip string, ttl time.Duration) (Session, error) {
-	id, err := utils.UniqueString(32) // todo isn't uuid better?
+// Device is a human-readable description of the client parsed from User-Agent.
+type Device struct {
+	Browser string `json:"browser" bson:"browser"`
+	OS      string `json:"os" bson:"os"`
+	Type    string `json:"type" bson:"type"`
+}
+
+// Location is an approximate location of the client resolved from IP.
+type Location struct {
+	Country string `json:"country,omitempty" bson:"country,omitempty"`
+	City    string `json:"city,omitempty" bson:"city,omitempty"`
+}
+
+// NewSession creates session with a new random token, the token is hashed with hashKey to get session ID.
+func NewSession(hashKey, aid, provider, userAgent, ip string, ttl time.Duration) (Session, error) {
+	token, err := utils.UniqueString(32)
 	if err != nil {
 		return Session{}, apperrors.ErrorSessionNotCreated
 	}
@@ -26,7 +58,9 @@ func NewSession(aid, provider, userAgent, ip string, ttl time.Duration) (Session
 	now := time.Now()
 
 	return Session{
-		ID:        id,
+		ID:        HashSessionToken(hashKey, token),
+		Token:     token,
+		Handle:    uuid.NewString(),
 		AccountID: aid,
 		Provider:  provider,
 		UserAgent: userAgent,
@@ -36,3 +70,30 @@ func NewSession(aid, provider, userAgent, ip string, ttl time.Duration) (Session
 		CreatedAt: now,
 	}, nil
 }
+
+// Rotated returns copy of the session with a new token and id, the handle and metadata are kept.
+func (s Session) Rotated(hashKey string) (Session, error) {
+	token, err := utils.UniqueString(32)
+	if err != nil {
+		return Session{}, apperrors.ErrorSessionNotCreated
+	}
+
+	s.Token = token
+	s.ID = HashSessionToken(hashKey, token)
+	return s, nil
+}
+
+// Expired reports whether the session lifetime is over.
+func (s Session) Expired() bool {
+	return time.Now().Unix() >= s.ExpiresAt
+}
+
+// Impersonated reports whether the session is opened by admin on behalf of the account.
+func (s Session) Impersonated() bool {
+	return s.ImpersonatorID != ""
+}
+
+// HashSessionToken returns HMAC-SHA256 of session token which is used as session ID.
+func HashSessionToken(hashKey, token string) string {
+	return utils.HMACSHA256(hashKey, token)
+}
@@ -0,0 +1,88 @@
+package domain
+
+import (
+	"encoding/json"
+	"go-authentication/pkg/utils"
+	"slices"
+	"time"
+)
+
+// WebhookAllEvents subscribes webhook to every event type.
+const WebhookAllEvents = "*"
+
+// WebhookEvents are event types available for webhook subscriptions.
+var WebhookEvents = []string{
+	EventAccountCreated,
+	EventAccountDeleted,
+	EventSessionCreated,
+	EventSessionTerminated,
+	EventPasswordChanged,
+}
+
+const _webhookSecretLength = 32
+
+// Webhook is a subscription of an external system to events.
+type Webhook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Secret signs payloads, it is shown only once when the webhook is created.
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// NewWebhook creates active webhook with random secret.
+func NewWebhook(url string, events []string) (Webhook, error) {
+	secret, err := utils.UniqueString(_webhookSecretLength)
+	if err != nil {
+		return Webhook{}, err
+	}
+	return Webhook{URL: url, Secret: secret, Events: events, Active: true}, nil
+}
+
+// Subscribed reports whether the webhook receives events of given type.
+func (w Webhook) Subscribed(typ string) bool {
+	return slices.Contains(w.Events, typ) || slices.Contains(w.Events, WebhookAllEvents)
+}
+
+// Webhook delivery statuses.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	// WebhookDeliveryFailed is a delivery which is not retried anymore.
+	WebhookDeliveryFailed = "failed"
+)
+
+// WebhookDelivery is an event queued for sending to a webhook.
+type WebhookDelivery struct {
+	ID            int64           `json:"id"`
+	WebhookID     string          `json:"webhookId"`
+	EventID       string          `json:"eventId"`
+	EventType     string          `json:"eventType"`
+	Payload       json.RawMessage `json:"-"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt time.Time       `json:"nextAttemptAt"`
+	LastError     string          `json:"lastError,omitempty"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	DeliveredAt   *time.Time      `json:"deliveredAt,omitempty"`
+
+	// URL and Secret of the webhook are set only for deliveries claimed for sending.
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// WebhookPayload is a body of the webhook request.
+type WebhookPayload struct {
+	// ID identifies the event, it is the same in retries and redeliveries, so receivers can drop duplicates.
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"createdAt"`
+	Data      Event     `json:"data"`
+}
+
+func NewWebhookPayload(e Event) WebhookPayload {
+	return WebhookPayload{ID: e.ID, Type: e.Type, CreatedAt: e.CreatedAt, Data: e}
+}
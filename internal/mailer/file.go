@@ -0,0 +1,62 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"go-authentication/internal/domain"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// fileMailer writes emails as .eml files to a directory or to a writer, it is used for local development.
+type fileMailer struct {
+	from string
+	dir  string
+
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewFileMailer writes every email to a separate .eml file in dir, which is created if missing.
+func NewFileMailer(from, dir string) (*fileMailer, error) {
+	const op = "mailer.NewFileMailer"
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &fileMailer{from: from, dir: dir}, nil
+}
+
+// NewConsoleMailer writes emails to out, e.g. os.Stdout.
+func NewConsoleMailer(from string, out io.Writer) *fileMailer {
+	return &fileMailer{from: from, out: out}
+}
+
+func (m *fileMailer) Send(_ context.Context, e domain.Email) error {
+	const op = "mailer.file.Send"
+
+	b, err := message(m.from, e).Bytes()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if m.out != nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if _, err = fmt.Fprintf(m.out, "----- email to %s -----\n%s\n", e.To, b); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	}
+
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + e.Template + ".eml"
+	if err = os.WriteFile(filepath.Join(m.dir, name), b, 0o640); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"context"
+	"go-authentication/internal/domain"
+	"slices"
+	"sync"
+)
+
+// memoryMailer captures sent emails in memory, it is used in tests.
+type memoryMailer struct {
+	mu     sync.Mutex
+	emails []domain.Email
+}
+
+func NewMemoryMailer() *memoryMailer {
+	return &memoryMailer{}
+}
+
+func (m *memoryMailer) Send(_ context.Context, e domain.Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.emails = append(m.emails, e)
+	return nil
+}
+
+// Emails returns all sent emails in the order of sending.
+func (m *memoryMailer) Emails() []domain.Email {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.emails)
+}
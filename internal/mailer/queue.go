@@ -0,0 +1,161 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/utils"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var ErrQueueFull = errors.New("email queue is full")
+
+type sender interface {
+	Send(ctx context.Context, e domain.Email) error
+}
+
+type queuedEmail struct {
+	email    domain.Email
+	attempts int
+}
+
+// QueueOptions configure the queue.
+type QueueOptions struct {
+	Size    int
+	Workers int
+	// MaxAttempts is a number of attempts after which the email is dropped.
+	MaxAttempts int
+	// BackoffBase is a delay after the first failed attempt, it doubles with every next failure.
+	BackoffBase time.Duration
+	// Timeout limits every attempt.
+	Timeout time.Duration
+}
+
+// queue sends emails in background through the wrapped mailer and retries failed ones.
+// Emails are kept in memory only, those waiting when the queue stops are lost.
+type queue struct {
+	log  *slog.Logger
+	next sender
+	opts QueueOptions
+
+	ch chan queuedEmail
+	// retries are pending delayed retries, they are canceled on stop
+	retries sync.WaitGroup
+	done    chan struct{}
+}
+
+func NewQueue(log *slog.Logger, next sender, opts QueueOptions) *queue {
+	return &queue{
+		log:  log,
+		next: next,
+		opts: opts,
+		ch:   make(chan queuedEmail, opts.Size),
+		done: make(chan struct{}),
+	}
+}
+
+// Send queues the email without waiting for it to be sent.
+func (q *queue) Send(_ context.Context, e domain.Email) error {
+	const op = "mailer.queue.Send"
+
+	select {
+	case q.ch <- queuedEmail{email: e}:
+		return nil
+	default:
+		return fmt.Errorf("%s: %w", op, ErrQueueFull)
+	}
+}
+
+// Run sends queued emails by workers until ctx is canceled.
+func (q *queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range q.opts.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+
+	close(q.done)
+	q.retries.Wait()
+
+	if n := len(q.ch); n > 0 {
+		q.log.Warn("emails are dropped on shutdown",
+			slog.String(utils.Operation, "mailer.queue.Run"),
+			slog.Int("count", n))
+	}
+}
+
+func (q *queue) work(ctx context.Context) {
+	for {
+		select {
+		case m := <-q.ch:
+			q.send(ctx, m)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (q *queue) send(ctx context.Context, m queuedEmail) {
+	const op = "mailer.queue.send"
+	l := q.log.With(
+		slog.String(utils.Operation, op),
+		slog.String("template", m.email.Template))
+
+	sendCtx, cancel := context.WithTimeout(ctx, q.opts.Timeout)
+	err := q.next.Send(sendCtx, m.email)
+	cancel()
+	if err == nil {
+		return
+	}
+
+	m.attempts++
+	if m.attempts >= q.opts.MaxAttempts {
+		l.Error("email is not sent, giving up",
+			slog.Int("attempts", m.attempts),
+			slog.String("error", err.Error()))
+		return
+	}
+
+	delay := q.backoff(m.attempts)
+	l.Warn("email is not sent, retrying",
+		slog.Int("attempts", m.attempts),
+		slog.Duration("delay", delay),
+		slog.String("error", err.Error()))
+
+	q.retries.Add(1)
+	go func() {
+		defer q.retries.Done()
+
+		t := time.NewTimer(delay)
+		defer t.Stop()
+
+		select {
+		case <-t.C:
+		case <-q.done:
+			l.Warn("email retry is dropped on shutdown")
+			return
+		}
+
+		select {
+		case q.ch <- m:
+		default:
+			l.Error("email retry is dropped", slog.String("error", ErrQueueFull.Error()))
+		}
+	}()
+}
+
+// backoff returns delay after given number of failed attempts.
+func (q *queue) backoff(attempts int) time.Duration {
+	delay := q.opts.BackoffBase
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+	}
+	return delay
+}
@@ -0,0 +1,153 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"go-authentication/internal/domain"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errSMTPDown = errors.New("smtp is down")
+
+// flakySender fails the first failures attempts and then passes emails to the memory mailer.
+type flakySender struct {
+	*memoryMailer
+
+	mu       sync.Mutex
+	failures int
+	attempts int
+}
+
+func (s *flakySender) Send(ctx context.Context, e domain.Email) error {
+	s.mu.Lock()
+	s.attempts++
+	fail := s.attempts <= s.failures
+	s.mu.Unlock()
+
+	if fail {
+		return errSMTPDown
+	}
+	return s.memoryMailer.Send(ctx, e)
+}
+
+func (s *flakySender) Attempts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.attempts
+}
+
+func testQueue(next sender, size int) *queue {
+	return NewQueue(slog.New(slog.NewTextHandler(io.Discard, nil)), next, QueueOptions{
+		Size:        size,
+		Workers:     2,
+		MaxAttempts: 3,
+		BackoffBase: time.Millisecond,
+		Timeout:     time.Second,
+	})
+}
+
+// runQueue runs the queue until the test ends.
+func runQueue(t *testing.T, q *queue) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(stopped)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition is not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestQueueSend(t *testing.T) {
+	m := NewMemoryMailer()
+	q := testQueue(m, 10)
+	runQueue(t, q)
+
+	if err := q.Send(context.Background(), domain.Email{To: "bob@example.com"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	waitFor(t, func() bool { return len(m.Emails()) == 1 })
+	if to := m.Emails()[0].To; to != "bob@example.com" {
+		t.Errorf("email is sent to %s, want bob@example.com", to)
+	}
+}
+
+func TestQueueRetriesFailedEmail(t *testing.T) {
+	s := &flakySender{memoryMailer: NewMemoryMailer(), failures: 2}
+	q := testQueue(s, 10)
+	runQueue(t, q)
+
+	if err := q.Send(context.Background(), domain.Email{To: "bob@example.com"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	waitFor(t, func() bool { return len(s.Emails()) == 1 })
+	if n := s.Attempts(); n != 3 {
+		t.Errorf("%d attempts, want 3", n)
+	}
+}
+
+func TestQueueGivesUpAfterMaxAttempts(t *testing.T) {
+	s := &flakySender{memoryMailer: NewMemoryMailer(), failures: 100}
+	q := testQueue(s, 10)
+	runQueue(t, q)
+
+	if err := q.Send(context.Background(), domain.Email{To: "bob@example.com"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	waitFor(t, func() bool { return s.Attempts() >= 3 })
+	// wait longer than the next backoff to catch extra attempts
+	time.Sleep(20 * time.Millisecond)
+
+	if n := s.Attempts(); n != 3 {
+		t.Errorf("%d attempts, want 3", n)
+	}
+	if n := len(s.Emails()); n != 0 {
+		t.Errorf("%d emails sent, want 0", n)
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	q := testQueue(NewMemoryMailer(), 1)
+
+	if err := q.Send(context.Background(), domain.Email{}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if err := q.Send(context.Background(), domain.Email{}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Send() error = %v, want %v", err, ErrQueueFull)
+	}
+}
+
+func TestQueueBackoff(t *testing.T) {
+	q := &queue{opts: QueueOptions{BackoffBase: time.Second}}
+
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second} {
+		if got := q.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/mail"
+)
+
+// smtpMailer sends emails through an SMTP server.
+type smtpMailer struct {
+	client *mail.SMTP
+	from   string
+}
+
+func NewSMTPMailer(client *mail.SMTP, from string) *smtpMailer {
+	return &smtpMailer{client: client, from: from}
+}
+
+func (m *smtpMailer) Send(ctx context.Context, e domain.Email) error {
+	const op = "mailer.smtp.Send"
+
+	if err := m.client.Send(ctx, message(m.from, e)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func message(from string, e domain.Email) mail.Message {
+	return mail.Message{
+		From:    from,
+		To:      []string{e.To},
+		Subject: e.Subject,
+		Text:    e.Text,
+		HTML:    e.HTML,
+		Headers: map[string]string{"X-Template": e.Template},
+	}
+}
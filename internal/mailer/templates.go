@@ -0,0 +1,161 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"go-authentication/internal/domain"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Template names, the latest version of a template is used unless a version is requested.
+const (
+	TemplateAlreadyRegistered = "already_registered"
+	TemplateNewDeviceLogin    = "new_device_login"
+	TemplatePasswordReset     = "password_reset"
+)
+
+var ErrTemplateNotFound = errors.New("email template not found")
+
+// _templates are laid out as templates/<name>/v<version>/<locale>.{txt,html}, the txt
+// template defines "subject" and the plaintext body, the html one is the HTML body.
+//
+//go:embed templates
+var _templates embed.FS
+
+type templateKey struct {
+	name    string
+	version int
+	locale  string
+}
+
+type localized struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// Templates renders emails from versioned localized templates.
+type Templates struct {
+	defaultLocale string
+	latest        map[string]int
+	set           map[templateKey]localized
+}
+
+// LoadTemplates parses embedded templates, every version of a template must exist in the default locale.
+func LoadTemplates(defaultLocale string) (*Templates, error) {
+	const op = "mailer.LoadTemplates"
+
+	t := &Templates{
+		defaultLocale: defaultLocale,
+		latest:        make(map[string]int),
+		set:           make(map[templateKey]localized),
+	}
+
+	files, err := fs.Glob(_templates, "templates/*/v*/*.txt")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, f := range files {
+		k, err := parseTemplatePath(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		var l localized
+		if l.text, err = texttemplate.New(path.Base(f)).Option("missingkey=error").ParseFS(_templates, f); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if l.text.Lookup("subject") == nil {
+			return nil, fmt.Errorf("%s: %s doesn't define subject", op, f)
+		}
+
+		htmlFile := strings.TrimSuffix(f, ".txt") + ".html"
+		if _, err = fs.Stat(_templates, htmlFile); err == nil {
+			if l.html, err = htmltemplate.New(path.Base(htmlFile)).Option("missingkey=error").ParseFS(_templates, htmlFile); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		t.set[k] = l
+		t.latest[k.name] = max(t.latest[k.name], k.version)
+	}
+
+	for k := range t.set {
+		if _, ok := t.set[templateKey{k.name, k.version, defaultLocale}]; !ok {
+			return nil, fmt.Errorf("%s: %s.v%d lacks default locale %s", op, k.name, k.version, defaultLocale)
+		}
+	}
+	return t, nil
+}
+
+// parseTemplatePath parses "templates/<name>/v<version>/<locale>.txt".
+func parseTemplatePath(p string) (templateKey, error) {
+	parts := strings.Split(p, "/")
+	if len(parts) != 4 {
+		return templateKey{}, fmt.Errorf("bad template path %s", p)
+	}
+
+	version, err := strconv.Atoi(strings.TrimPrefix(parts[2], "v"))
+	if err != nil {
+		return templateKey{}, fmt.Errorf("bad template version in %s", p)
+	}
+	return templateKey{name: parts[1], version: version, locale: strings.TrimSuffix(parts[3], ".txt")}, nil
+}
+
+// Render renders the latest version of the template, see RenderVersion.
+func (t *Templates) Render(name, locale string, data any) (domain.Email, error) {
+	return t.RenderVersion(name, t.latest[name], locale, data)
+}
+
+// RenderVersion renders given version of the template in the locale, it falls back to the language
+// of the locale, e.g. "pt" for "pt-BR", and then to the default locale. Recipient is not set.
+func (t *Templates) RenderVersion(name string, version int, locale string, data any) (domain.Email, error) {
+	const op = "mailer.Templates.Render"
+
+	l, locale, ok := t.lookup(name, version, locale)
+	if !ok {
+		return domain.Email{}, fmt.Errorf("%s: %w: %s.v%d", op, ErrTemplateNotFound, name, version)
+	}
+
+	var subject, text bytes.Buffer
+	if err := l.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return domain.Email{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := l.text.Execute(&text, data); err != nil {
+		return domain.Email{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	e := domain.Email{
+		Subject:  strings.TrimSpace(subject.String()),
+		Text:     text.String(),
+		Template: name + ".v" + strconv.Itoa(version),
+		Locale:   locale,
+	}
+
+	if l.html != nil {
+		var html bytes.Buffer
+		if err := l.html.Execute(&html, data); err != nil {
+			return domain.Email{}, fmt.Errorf("%s: %w", op, err)
+		}
+		e.HTML = html.String()
+	}
+	return e, nil
+}
+
+func (t *Templates) lookup(name string, version int, locale string) (localized, string, bool) {
+	lang, _, _ := strings.Cut(locale, "-")
+
+	for _, loc := range []string{locale, lang, t.defaultLocale} {
+		if l, ok := t.set[templateKey{name, version, loc}]; ok {
+			return l, loc, true
+		}
+	}
+	return localized{}, "", false
+}
@@ -0,0 +1,107 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"go-authentication/internal/domain"
+	"go-authentication/internal/mailer"
+	"go-authentication/internal/service"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// _timeLayout formats times in emails, they are in UTC since the recipient time zone is unknown.
+const _timeLayout = "2006-01-02 15:04 MST"
+
+// emailNotifier sends account notifications by email.
+type emailNotifier struct {
+	mailer    service.Mailer
+	templates *mailer.Templates
+	// locale is used for recipients with unknown locale.
+	locale  string
+	appName string
+	baseURL string
+}
+
+func NewEmailNotifier(m service.Mailer, t *mailer.Templates, locale, appName, baseURL string) *emailNotifier {
+	return &emailNotifier{mailer: m, templates: t, locale: locale, appName: appName, baseURL: baseURL}
+}
+
+func (n *emailNotifier) AlreadyRegistered(ctx context.Context, acc domain.Account) error {
+	const op = "notifier.email.AlreadyRegistered"
+
+	if err := n.send(ctx, acc, mailer.TemplateAlreadyRegistered, map[string]any{"Email": acc.Email}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (n *emailNotifier) NewDeviceLogin(
+	ctx context.Context,
+	acc domain.Account,
+	s domain.Session,
+	rejectToken string,
+	expiresAt time.Time) error {
+
+	const op = "notifier.email.NewDeviceLogin"
+
+	location := strings.Join(nonEmpty(s.Location.City, s.Location.Country), ", ")
+
+	err := n.send(ctx, acc, mailer.TemplateNewDeviceLogin, map[string]any{
+		"Browser":   s.Device.Browser,
+		"OS":        s.Device.OS,
+		"IP":        s.IP,
+		"Location":  location,
+		"Time":      s.CreatedAt.UTC().Format(_timeLayout),
+		"RejectURL": n.baseURL + "/login-rejection?token=" + url.QueryEscape(rejectToken),
+		"ExpiresAt": expiresAt.UTC().Format(_timeLayout),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (n *emailNotifier) PasswordReset(ctx context.Context, acc domain.Account, token string, expiresAt time.Time) error {
+	const op = "notifier.email.PasswordReset"
+
+	err := n.send(ctx, acc, mailer.TemplatePasswordReset, map[string]any{
+		"ResetURL":  n.baseURL + "/password-reset?token=" + url.QueryEscape(token),
+		"ExpiresAt": expiresAt.UTC().Format(_timeLayout),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// send renders the template in the locale of the account with data extended by common fields
+// and sends it to the account email.
+func (n *emailNotifier) send(ctx context.Context, acc domain.Account, template string, data map[string]any) error {
+	data["AppName"] = n.appName
+	data["BaseURL"] = n.baseURL
+
+	locale := acc.Locale
+	if locale == "" {
+		locale = n.locale
+	}
+
+	e, err := n.templates.Render(template, locale, data)
+	if err != nil {
+		return err
+	}
+	e.To = acc.Email
+
+	return n.mailer.Send(ctx, e)
+}
+
+func nonEmpty(values ...string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,47 @@
+package notifier
+
+import (
+	"context"
+	"go-authentication/internal/domain"
+	"go-authentication/internal/mailer"
+	"testing"
+	"time"
+)
+
+func TestEmailNotifierLocale(t *testing.T) {
+	templates, err := mailer.LoadTemplates("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{locale: "ru", want: "ru"},
+		{locale: "ru-RU", want: "ru"},
+		{locale: "de", want: "en"},
+		{locale: "", want: "en"},
+	}
+
+	for _, tt := range tests {
+		m := mailer.NewMemoryMailer()
+		n := NewEmailNotifier(m, templates, "en", "App", "https://example.com")
+
+		acc := domain.Account{Email: "bob@example.com", Locale: tt.locale}
+		if err = n.PasswordReset(context.Background(), acc, "token", time.Now()); err != nil {
+			t.Fatalf("PasswordReset() error = %v", err)
+		}
+
+		emails := m.Emails()
+		if len(emails) != 1 {
+			t.Fatalf("%d emails sent, want 1", len(emails))
+		}
+		if emails[0].Locale != tt.want {
+			t.Errorf("locale %q: email is rendered in %q, want %q", tt.locale, emails[0].Locale, tt.want)
+		}
+		if emails[0].To != acc.Email {
+			t.Errorf("email is sent to %s, want %s", emails[0].To, acc.Email)
+		}
+	}
+}
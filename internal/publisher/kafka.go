@@ -0,0 +1,52 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"go-authentication/internal/domain"
+)
+
+// Kafka message headers.
+const (
+	KafkaHeaderEventID   = "event-id"
+	KafkaHeaderEventType = "event-type"
+)
+
+// KafkaWriter is the part of *kafka.Writer used by the publisher.
+type KafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// kafkaPublisher publishes events as JSON to the topic of the writer, events are keyed
+// by the account id, so events of an account land in one partition and keep their order.
+type kafkaPublisher struct {
+	w KafkaWriter
+}
+
+func NewKafkaPublisher(w KafkaWriter) *kafkaPublisher {
+	return &kafkaPublisher{w: w}
+}
+
+func (p *kafkaPublisher) Publish(ctx context.Context, e domain.Event) error {
+	const op = "publisher.kafka.Publish"
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = p.w.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(e.AccountID),
+		Value: b,
+		Headers: []kafka.Header{
+			{Key: KafkaHeaderEventID, Value: []byte(e.ID)},
+			{Key: KafkaHeaderEventType, Value: []byte(e.Type)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/segmentio/kafka-go"
+	"go-authentication/internal/domain"
+	"testing"
+)
+
+type fakeKafkaWriter struct {
+	msgs []kafka.Message
+	err  error
+}
+
+func (w *fakeKafkaWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.msgs = append(w.msgs, msgs...)
+	return nil
+}
+
+func TestKafkaPublisher(t *testing.T) {
+	w := &fakeKafkaWriter{}
+	e := domain.NewEvent(domain.EventSessionCreated, "account-id")
+
+	if err := NewKafkaPublisher(w).Publish(context.Background(), e); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	if len(w.msgs) != 1 {
+		t.Fatalf("written %d messages, want 1", len(w.msgs))
+	}
+	m := w.msgs[0]
+
+	if string(m.Key) != "account-id" {
+		t.Errorf("key = %s, want account id", m.Key)
+	}
+	headers := make(map[string]string)
+	for _, h := range m.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	if headers[KafkaHeaderEventID] != e.ID || headers[KafkaHeaderEventType] != e.Type {
+		t.Errorf("headers = %v", headers)
+	}
+
+	var got domain.Event
+	if err := json.Unmarshal(m.Value, &got); err != nil || got.ID != e.ID || got.AccountID != e.AccountID {
+		t.Errorf("value = %s, err = %v", m.Value, err)
+	}
+}
+
+func TestKafkaPublisherError(t *testing.T) {
+	errBroker := errors.New("not enough replicas")
+	w := &fakeKafkaWriter{err: errBroker}
+
+	err := NewKafkaPublisher(w).Publish(context.Background(), domain.NewEvent(domain.EventSessionCreated, "account-id"))
+	if !errors.Is(err, errBroker) {
+		t.Fatalf("Publish() = %v, want %v", err, errBroker)
+	}
+}
@@ -0,0 +1,28 @@
+package publisher
+
+import (
+	"context"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/utils"
+	"log/slog"
+)
+
+// logPublisher writes events to the log, it is used while no message broker is configured.
+type logPublisher struct {
+	log *slog.Logger
+}
+
+func NewLogPublisher(log *slog.Logger) *logPublisher {
+	return &logPublisher{log: log}
+}
+
+func (p *logPublisher) Publish(_ context.Context, e domain.Event) error {
+	const op = "publisher.log.Publish"
+
+	p.log.Info("event published",
+		slog.String(utils.Operation, op),
+		slog.String("event_id", e.ID),
+		slog.String("type", e.Type),
+		slog.String("account_id", e.AccountID))
+	return nil
+}
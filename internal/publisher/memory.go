@@ -0,0 +1,34 @@
+package publisher
+
+import (
+	"context"
+	"go-authentication/internal/domain"
+	"slices"
+	"sync"
+)
+
+// memoryPublisher keeps published events in memory, it is used to inspect events locally.
+type memoryPublisher struct {
+	mu     sync.Mutex
+	events []domain.Event
+}
+
+func NewMemoryPublisher() *memoryPublisher {
+	return &memoryPublisher{}
+}
+
+func (p *memoryPublisher) Publish(_ context.Context, e domain.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = append(p.events, e)
+	return nil
+}
+
+// Events returns all published events in the order of publishing.
+func (p *memoryPublisher) Events() []domain.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return slices.Clone(p.events)
+}
@@ -0,0 +1,30 @@
+package publisher
+
+import (
+	"context"
+	"go-authentication/internal/domain"
+	"testing"
+)
+
+func TestMemoryPublisherKeepsOrder(t *testing.T) {
+	p := NewMemoryPublisher()
+
+	var want []string
+	for _, typ := range []string{domain.EventAccountCreated, domain.EventSessionCreated, domain.EventAccountDeleted} {
+		e := domain.NewEvent(typ, "account-id")
+		want = append(want, e.ID)
+		if err := p.Publish(context.Background(), e); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+
+	got := p.Events()
+	if len(got) != len(want) {
+		t.Fatalf("got %d events, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].ID != want[i] {
+			t.Errorf("event %d = %s, want %s", i, got[i].ID, want[i])
+		}
+	}
+}
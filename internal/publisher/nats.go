@@ -0,0 +1,49 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-authentication/internal/domain"
+	"time"
+)
+
+// NATSConn is the part of *nats.Conn used by the publisher.
+type NATSConn interface {
+	Publish(subject string, data []byte) error
+	FlushWithContext(ctx context.Context) error
+}
+
+// natsPublisher publishes events as JSON to NATS subject "<prefix>.<event type>".
+type natsPublisher struct {
+	conn    NATSConn
+	prefix  string
+	timeout time.Duration
+}
+
+func NewNATSPublisher(conn NATSConn, prefix string, timeout time.Duration) *natsPublisher {
+	return &natsPublisher{conn: conn, prefix: prefix, timeout: timeout}
+}
+
+// Publish returns after the server has received the event, core NATS doesn't persist it,
+// so it is lost if no subscriber is connected.
+func (p *natsPublisher) Publish(ctx context.Context, e domain.Event) error {
+	const op = "publisher.nats.Publish"
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err = p.conn.Publish(p.prefix+"."+e.Type, b); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// the flush waits for PONG, the server handles messages in order, so the event is received
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	if err = p.conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
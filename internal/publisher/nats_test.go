@@ -0,0 +1,130 @@
+package publisher
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"go-authentication/internal/domain"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type natsMsg struct {
+	subject string
+	data    []byte
+}
+
+// serveNATS accepts one client on l and speaks enough of the NATS protocol to take publishes.
+func serveNATS(t *testing.T, l net.Listener, msgs chan<- natsMsg) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	_, _ = fmt.Fprint(conn, `INFO {"server_id":"test","version":"2.10.0","proto":1,"max_payload":1048576}`+"\r\n")
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "PING":
+			_, _ = fmt.Fprint(conn, "PONG\r\n")
+		case "PUB":
+			n, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				t.Errorf("bad PUB line %q", line)
+				return
+			}
+			data := make([]byte, n+2)
+			if _, err = io.ReadFull(r, data); err != nil {
+				return
+			}
+			msgs <- natsMsg{subject: fields[1], data: data[:n]}
+		}
+	}
+}
+
+func TestNATSPublisher(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	msgs := make(chan natsMsg, 1)
+	go serveNATS(t, l, msgs)
+
+	nc, err := nats.Connect("nats://"+l.Addr().String(), nats.Timeout(time.Second))
+	if err != nil {
+		t.Fatalf("can't connect: %v", err)
+	}
+	defer nc.Close()
+
+	e := domain.NewEvent(domain.EventAccountCreated, "account-id")
+	if err = NewNATSPublisher(nc, "auth.events", time.Second).Publish(context.Background(), e); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	// the publish returns after the flush, the message is already received
+	select {
+	case m := <-msgs:
+		if m.subject != "auth.events.account.created" {
+			t.Errorf("subject = %s", m.subject)
+		}
+		var got domain.Event
+		if err = json.Unmarshal(m.data, &got); err != nil || got.ID != e.ID {
+			t.Errorf("data = %s, err = %v", m.data, err)
+		}
+	default:
+		t.Fatal("message isn't received by the server")
+	}
+}
+
+type fakeNATSConn struct {
+	publishErr, flushErr error
+	deadline             bool
+}
+
+func (c *fakeNATSConn) Publish(string, []byte) error {
+	return c.publishErr
+}
+
+func (c *fakeNATSConn) FlushWithContext(ctx context.Context) error {
+	_, c.deadline = ctx.Deadline()
+	return c.flushErr
+}
+
+func TestNATSPublisherErrors(t *testing.T) {
+	errConn := errors.New("connection closed")
+	e := domain.NewEvent(domain.EventAccountCreated, "account-id")
+
+	for _, conn := range []*fakeNATSConn{{publishErr: errConn}, {flushErr: errConn}} {
+		if err := NewNATSPublisher(conn, "auth.events", time.Second).Publish(context.Background(), e); !errors.Is(err, errConn) {
+			t.Errorf("Publish() = %v, want %v", err, errConn)
+		}
+	}
+
+	conn := &fakeNATSConn{}
+	if err := NewNATSPublisher(conn, "auth.events", time.Second).Publish(context.Background(), e); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if !conn.deadline {
+		t.Error("flush is not bounded by the timeout")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -13,6 +14,7 @@ import (
 	"go-authentication/pkg/postgres"
 	"go-authentication/pkg/utils"
 	"log/slog"
+	"strings"
 )
 
 const _accTable = "accounts"
@@ -29,15 +31,14 @@ func NewAccountRepo(log *slog.Logger, db *postgres.Postgres) *accountRepo {
 	}
 }
 
-// Create ...
 func (r *accountRepo) Create(ctx context.Context, acc domain.Account) (string, error) {
 	const op = "repository.accountRepo.Create"
 	l := r.log.With(slog.String(utils.Operation, op))
 
 	sql, args, err := r.pg.Builder.
 		Insert(_accTable).
-		Columns("username, email, password").
-		Values(acc.Username, acc.Email, acc.PasswordHash).
+		Columns("username, email, password, locale").
+		Values(acc.Username, acc.Email, acc.PasswordHash, acc.Locale).
 		Suffix("RETURNING id").
 		ToSql()
 	if err != nil {
@@ -47,20 +48,17 @@ func (r *accountRepo) Create(ctx context.Context, acc domain.Account) (string, e
 		return "", fmt.Errorf("%s : %w", op, err)
 	}
 
-	//aid, err := ar.db.Pool.Exec(ctx, sql, args...)
 	var aid string
 
-	if err = r.pg.Pool.QueryRow(ctx, sql, args...).Scan(&aid); err != nil {
+	if err = r.pg.DB(ctx).QueryRow(ctx, sql, args...).Scan(&aid); err != nil {
 		var pgErr *pgconn.PgError
 
-		if errors.As(err, &pgErr) {
-			if pgErr.Code == pgerrcode.UniqueViolation {
-				l.Error("queryrow uniq violation", slog.String("error", err.Error()))
-				return "", fmt.Errorf("%s: %w", op, apperrors.ErrorAccountAlreadyExists)
-			}
-			l.Error("queryrow error", slog.String("error", err.Error()))
-			return "", fmt.Errorf("%s : %w", op, err)
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			l.Error("queryrow uniq violation", slog.String("error", err.Error()))
+			return "", fmt.Errorf("%s: %w", op, apperrors.ErrorAccountAlreadyExists)
 		}
+		l.Error("queryrow error", slog.String("error", err.Error()))
+		return "", fmt.Errorf("%s : %w", op, err)
 	}
 	return aid, nil
 }
@@ -71,7 +69,7 @@ func (r *accountRepo) FindByID(ctx context.Context, aid string) (domain.Account,
 	l := r.log.With(slog.String(utils.Operation, op))
 
 	sql, args, err := r.pg.Builder.
-		Select("username", "email", "password", "created_at", "updated_at").
+		Select("username", "email", "password", "locked_at", "password_reset_required", "locale", "created_at", "updated_at").
 		From(_accTable).
 		Where(squirrel.Eq{"id": aid}).
 		ToSql()
@@ -85,10 +83,13 @@ func (r *accountRepo) FindByID(ctx context.Context, aid string) (domain.Account,
 
 	var acc = domain.Account{ID: aid}
 
-	if err = r.pg.Pool.QueryRow(ctx, sql, args...).Scan(
+	if err = r.pg.DB(ctx).QueryRow(ctx, sql, args...).Scan(
 		&acc.Username,
 		&acc.Email,
 		&acc.PasswordHash,
+		&acc.LockedAt,
+		&acc.PasswordResetRequired,
+		&acc.Locale,
 		&acc.CreatedAt,
 		&acc.UpdatedAt,
 	); err != nil {
@@ -111,7 +112,7 @@ func (r *accountRepo) FindByEmail(ctx context.Context, email string) (domain.Acc
 	l := r.log.With(slog.String(utils.Operation, op))
 
 	sql, args, err := r.pg.Builder.
-		Select("id", "username", "password", "created_at", "updated_at").
+		Select("id", "username", "password", "locked_at", "password_reset_required", "locale", "created_at", "updated_at").
 		From(_accTable).
 		Where(squirrel.Eq{"email": email}).
 		ToSql()
@@ -127,10 +128,13 @@ func (r *accountRepo) FindByEmail(ctx context.Context, email string) (domain.Acc
 		Email: email,
 	}
 
-	if err = r.pg.Pool.QueryRow(ctx, sql, args...).Scan(
+	if err = r.pg.DB(ctx).QueryRow(ctx, sql, args...).Scan(
 		&acc.ID,
 		&acc.Username,
 		&acc.PasswordHash,
+		&acc.LockedAt,
+		&acc.PasswordResetRequired,
+		&acc.Locale,
 		&acc.CreatedAt,
 		&acc.UpdatedAt,
 	); err != nil {
@@ -146,7 +150,219 @@ func (r *accountRepo) FindByEmail(ctx context.Context, email string) (domain.Acc
 	return acc, nil
 }
 
-// Delete ...
+// FindAll returns a page of accounts matching the filter and total number of matching accounts.
+func (r *accountRepo) FindAll(ctx context.Context, f domain.AccountFilter, p domain.Pagination) ([]domain.Account, int64, error) {
+	const op = "repository.accountRepo.FindAll"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	where := squirrel.And{}
+	if f.Email != "" {
+		where = append(where, squirrel.ILike{"email": "%" + escapeLike(f.Email) + "%"})
+	}
+	if f.Username != "" {
+		where = append(where, squirrel.ILike{"username": "%" + escapeLike(f.Username) + "%"})
+	}
+	if !f.CreatedFrom.IsZero() {
+		where = append(where, squirrel.GtOrEq{"created_at": f.CreatedFrom})
+	}
+	if !f.CreatedTo.IsZero() {
+		where = append(where, squirrel.Lt{"created_at": f.CreatedTo})
+	}
+
+	sql, args, err := r.pg.Builder.
+		Select("count(*)").
+		From(_accTable).
+		Where(where).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad count query", slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s : %w", op, err)
+	}
+
+	var total int64
+	if err = r.pg.DB(ctx).QueryRow(ctx, sql, args...).Scan(&total); err != nil {
+		l.Error("bad queryRow or scan", slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s : %w", op, err)
+	}
+
+	order := "desc"
+	if !p.SortDesc {
+		order = "asc"
+	}
+
+	sql, args, err = r.pg.Builder.
+		Select("id", "username", "email", "locked_at", "password_reset_required", "locale", "created_at", "updated_at").
+		From(_accTable).
+		Where(where).
+		OrderBy(accountSortColumn(p.SortBy)+" "+order, "id").
+		Limit(uint64(p.PerPage)).
+		Offset(uint64(p.Offset())).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad select query", slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s : %w", op, err)
+	}
+
+	rows, err := r.pg.DB(ctx).Query(ctx, sql, args...)
+	if err != nil {
+		l.Error("db.query", slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s : %w", op, err)
+	}
+	defer rows.Close()
+
+	accounts := make([]domain.Account, 0, p.PerPage)
+	for rows.Next() {
+		var acc domain.Account
+		if err = rows.Scan(
+			&acc.ID,
+			&acc.Username,
+			&acc.Email,
+			&acc.LockedAt,
+			&acc.PasswordResetRequired,
+			&acc.Locale,
+			&acc.CreatedAt,
+			&acc.UpdatedAt,
+		); err != nil {
+			return nil, 0, fmt.Errorf("%s : %w", op, err)
+		}
+		accounts = append(accounts, acc)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%s : %w", op, err)
+	}
+
+	return accounts, total, nil
+}
+
+// SetLocked locks or unlocks the account.
+func (r *accountRepo) SetLocked(ctx context.Context, aid string, locked bool) error {
+	const op = "repository.accountRepo.SetLocked"
+
+	var lockedAt any
+	if locked {
+		lockedAt = squirrel.Expr("current_timestamp")
+	}
+
+	if err := r.update(ctx, aid, map[string]any{"locked_at": lockedAt}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// SetPasswordResetRequired sets or clears the flag which forbids login to the account until its password is reset.
+func (r *accountRepo) SetPasswordResetRequired(ctx context.Context, aid string, required bool) error {
+	const op = "repository.accountRepo.SetPasswordResetRequired"
+
+	if err := r.update(ctx, aid, map[string]any{"password_reset_required": required}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// update sets columns of the account and its update time.
+func (r *accountRepo) update(ctx context.Context, aid string, columns map[string]any) error {
+	l := r.log.With(slog.String(utils.Operation, "repository.accountRepo.update"))
+
+	sql, args, err := r.pg.Builder.
+		Update(_accTable).
+		SetMap(columns).
+		Set("updated_at", squirrel.Expr("current_timestamp")).
+		Where(squirrel.Eq{"id": aid}).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad update query",
+			slog.String("sql", sql),
+			slog.String("error", err.Error()))
+		return err
+	}
+
+	ct, err := r.pg.DB(ctx).Exec(ctx, sql, args...)
+	if err != nil {
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return apperrors.ErrorAccountNotFound
+	}
+	return nil
+}
+
+func accountSortColumn(sortBy string) string {
+	switch sortBy {
+	case "email":
+		return "email"
+	case "username":
+		return "username"
+	default:
+		return "created_at"
+	}
+}
+
+// escapeLike escapes wildcards of LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// UpdatePassword sets new password chosen by the owner and clears required password reset.
+func (r *accountRepo) UpdatePassword(ctx context.Context, aid, hash string) error {
+	const op = "repository.accountRepo.UpdatePassword"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Update(_accTable).
+		Set("password", hash).
+		Set("password_reset_required", false).
+		Set("updated_at", squirrel.Expr("current_timestamp")).
+		Where(squirrel.Eq{"id": aid}).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad update query",
+			slog.String("sql", sql),
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	ct, err := r.pg.DB(ctx).Exec(ctx, sql, args...)
+	if err != nil {
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	if ct.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, apperrors.ErrorAccountNotFound)
+	}
+	return nil
+}
+
+// UpdatePasswordHash replaces hash of the same password, e.g. made with outdated parameters.
+func (r *accountRepo) UpdatePasswordHash(ctx context.Context, aid, hash string) error {
+	const op = "repository.accountRepo.UpdatePasswordHash"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Update(_accTable).
+		Set("password", hash).
+		Set("updated_at", squirrel.Expr("current_timestamp")).
+		Where(squirrel.Eq{"id": aid}).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad update query",
+			slog.String("sql", sql),
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	ct, err := r.pg.DB(ctx).Exec(ctx, sql, args...)
+	if err != nil {
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	if ct.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, apperrors.ErrorAccountNotFound)
+	}
+	return nil
+}
+
+// Delete deletes the account, persistent login tokens and roles of the account are deleted by cascade.
 func (r *accountRepo) Delete(ctx context.Context, aid string) error {
 	const op = "repository.accountRepo.Delete"
 	l := r.log.With(slog.String(utils.Operation, op))
@@ -164,13 +380,75 @@ func (r *accountRepo) Delete(ctx context.Context, aid string) error {
 		return fmt.Errorf("%s : %w", op, err)
 	}
 
-	ct, err := r.pg.Pool.Exec(ctx, sql, args...)
+	ct, err := r.pg.DB(ctx).Exec(ctx, sql, args...)
 	r.log.Debug("returned result",
 		slog.Int64("count", ct.RowsAffected()),
 		slog.String("string", ct.String()))
 	if err != nil {
-		l.Error("pool.exec", slog.String("error", err.Error()))
+		l.Error("db.exec", slog.String("error", err.Error()))
 		return fmt.Errorf("%s : %w", op, err)
 	}
-	return err
+	if ct.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, apperrors.ErrorAccountNotFound)
+	}
+	return nil
+}
+
+// FindMissing returns those of ids which don't belong to any account, malformed ids are missing too.
+func (r *accountRepo) FindMissing(ctx context.Context, ids []string) ([]string, error) {
+	const op = "repository.accountRepo.FindMissing"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	// malformed ids are dropped before the query, so it can use the primary key index
+	valid := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if u, err := uuid.Parse(id); err == nil {
+			valid = append(valid, u.String())
+		}
+	}
+
+	sql, args, err := r.pg.Builder.
+		Select("id::text").
+		From(_accTable).
+		Where("id = ANY(?::uuid[])", valid).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad select query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+
+	rows, err := r.pg.DB(ctx).Query(ctx, sql, args...)
+	if err != nil {
+		l.Error("db.query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+	defer rows.Close()
+
+	found := make(map[string]struct{}, len(ids))
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			l.Error("rows.scan", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("%s : %w", op, err)
+		}
+		found[id] = struct{}{}
+	}
+	if err = rows.Err(); err != nil {
+		l.Error("rows.err", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+
+	var missing []string
+	for _, id := range ids {
+		// found ids are in the canonical form
+		u, err := uuid.Parse(id)
+		if err != nil {
+			missing = append(missing, id)
+			continue
+		}
+		if _, ok := found[u.String()]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	return missing, nil
 }
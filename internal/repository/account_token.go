@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"go-authentication/internal/apperrors"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/postgres"
+	"go-authentication/pkg/utils"
+	"log/slog"
+)
+
+const _accountTokenTable = "account_tokens"
+
+type accountTokenRepo struct {
+	log *slog.Logger
+	pg  *postgres.Postgres
+}
+
+func NewAccountTokenRepo(log *slog.Logger, db *postgres.Postgres) *accountTokenRepo {
+	return &accountTokenRepo{log: log, pg: db}
+}
+
+func (r *accountTokenRepo) Create(ctx context.Context, t domain.AccountToken) error {
+	const op = "repository.accountTokenRepo.Create"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Insert(_accountTokenTable).
+		Columns("token_hash", "purpose", "account_id", "session_id", "device_id", "expires_at", "created_at").
+		Values(t.Hash, t.Purpose, t.AccountID, t.SessionID, t.DeviceID, t.ExpiresAt, t.CreatedAt).
+		ToSql()
+	if err != nil {
+		l.Error("pg.builder: bad insert query", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	if _, err = r.pg.DB(ctx).Exec(ctx, sql, args...); err != nil {
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	return nil
+}
+
+// Use marks the token with given hash and purpose used and returns it,
+// the token can be used only once and only before it expires.
+func (r *accountTokenRepo) Use(ctx context.Context, purpose, hash string) (domain.AccountToken, error) {
+	const op = "repository.accountTokenRepo.Use"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Update(_accountTokenTable).
+		Set("used_at", squirrel.Expr("current_timestamp")).
+		Where(squirrel.Eq{"token_hash": hash, "purpose": purpose, "used_at": nil}).
+		Where(squirrel.Expr("expires_at > current_timestamp")).
+		Suffix("RETURNING account_id, session_id, device_id, expires_at, used_at, created_at").
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad update query", slog.String("error", err.Error()))
+		return domain.AccountToken{}, fmt.Errorf("%s : %w", op, err)
+	}
+
+	t := domain.AccountToken{Hash: hash, Purpose: purpose}
+
+	if err = r.pg.DB(ctx).QueryRow(ctx, sql, args...).Scan(
+		&t.AccountID,
+		&t.SessionID,
+		&t.DeviceID,
+		&t.ExpiresAt,
+		&t.UsedAt,
+		&t.CreatedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			l.Warn("account token not found")
+			return domain.AccountToken{}, fmt.Errorf("%s: %w", op, apperrors.ErrorAccountTokenInvalid)
+		}
+		l.Error("bad queryRow or scan", slog.String("error", err.Error()))
+		return domain.AccountToken{}, fmt.Errorf("%s : %w", op, err)
+	}
+	return t, nil
+}
+
+// DeleteAll deletes all tokens of the account with given purpose.
+func (r *accountTokenRepo) DeleteAll(ctx context.Context, aid, purpose string) error {
+	const op = "repository.accountTokenRepo.DeleteAll"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Delete(_accountTokenTable).
+		Where(squirrel.Eq{"account_id": aid, "purpose": purpose}).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad delete query", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	if _, err = r.pg.DB(ctx).Exec(ctx, sql, args...); err != nil {
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/postgres"
+	"go-authentication/pkg/utils"
+	"log/slog"
+)
+
+const (
+	_auditTable           = "audit_events"
+	_auditCheckpointTable = "audit_checkpoints"
+	// _auditChainLock is a key of the advisory lock serializing writers of the chain.
+	_auditChainLock = 7_142_001
+)
+
+type auditRepo struct {
+	log *slog.Logger
+	pg  *postgres.Postgres
+}
+
+func NewAuditRepo(log *slog.Logger, db *postgres.Postgres) *auditRepo {
+	return &auditRepo{log: log, pg: db}
+}
+
+// Create appends the event to the audit log and links it to the last event of the chain.
+func (r *auditRepo) Create(ctx context.Context, e domain.AuditEvent) error {
+	const op = "repository.auditRepo.Create"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	details, err := json.Marshal(e.Details)
+	if err != nil {
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	err = r.pg.WithinTx(ctx, func(ctx context.Context) error {
+		db := r.pg.DB(ctx)
+
+		// writers are serialized, so every event is linked to the one inserted right before it
+		if _, err := db.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", _auditChainLock); err != nil {
+			l.Error("can't lock audit chain", slog.String("error", err.Error()))
+			return err
+		}
+
+		sql, args, err := r.pg.Builder.
+			Select("coalesce(hash, '')").
+			From(_auditTable).
+			OrderBy("id desc").
+			Limit(1).
+			ToSql()
+		if err != nil {
+			l.Error("builder - bad select last hash query", slog.String("error", err.Error()))
+			return err
+		}
+
+		if err = db.QueryRow(ctx, sql, args...).Scan(&e.PrevHash); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			l.Error("bad queryRow or scan", slog.String("error", err.Error()))
+			return err
+		}
+
+		if e.Hash, err = e.ChainHash(e.PrevHash); err != nil {
+			return err
+		}
+
+		sql, args, err = r.pg.Builder.
+			Insert(_auditTable).
+			Columns("type", "actor_id", "target_id", "ip", "user_agent", "result", "details", "created_at", "prev_hash", "hash").
+			Values(e.Type, nullable(e.ActorID), nullable(e.TargetID), e.IP, e.UserAgent, e.Result, details, e.CreatedAt,
+				nullable(e.PrevHash), e.Hash).
+			ToSql()
+		if err != nil {
+			l.Error("pg.builder: bad insert query",
+				slog.String("error", err.Error()))
+			return err
+		}
+
+		if _, err = db.Exec(ctx, sql, args...); err != nil {
+			l.Error("db.exec", slog.String("error", err.Error()))
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	return nil
+}
+
+// Head returns the last chained event, ok is false if there is none.
+func (r *auditRepo) Head(ctx context.Context) (domain.AuditEvent, bool, error) {
+	const op = "repository.auditRepo.Head"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Select("id", "hash").
+		From(_auditTable).
+		Where(squirrel.NotEq{"hash": nil}).
+		OrderBy("id desc").
+		Limit(1).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad select query", slog.String("error", err.Error()))
+		return domain.AuditEvent{}, false, fmt.Errorf("%s : %w", op, err)
+	}
+
+	var e domain.AuditEvent
+	if err = r.pg.DB(ctx).QueryRow(ctx, sql, args...).Scan(&e.ID, &e.Hash); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.AuditEvent{}, false, nil
+		}
+		l.Error("bad queryRow or scan", slog.String("error", err.Error()))
+		return domain.AuditEvent{}, false, fmt.Errorf("%s : %w", op, err)
+	}
+	return e, true, nil
+}
+
+// FindAfter returns up to limit events with id greater than afterID in the order of the chain.
+func (r *auditRepo) FindAfter(ctx context.Context, afterID int64, limit int) ([]domain.AuditEvent, error) {
+	const op = "repository.auditRepo.FindAfter"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Select("id", "type", "coalesce(actor_id::text, '')", "coalesce(target_id::text, '')", "ip", "user_agent",
+			"result", "details", "created_at", "coalesce(prev_hash, '')", "coalesce(hash, '')").
+		From(_auditTable).
+		Where(squirrel.Gt{"id": afterID}).
+		OrderBy("id").
+		Limit(uint64(limit)).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad select query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+
+	rows, err := r.pg.DB(ctx).Query(ctx, sql, args...)
+	if err != nil {
+		l.Error("db.query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+	defer rows.Close()
+
+	events := make([]domain.AuditEvent, 0, limit)
+	for rows.Next() {
+		var e domain.AuditEvent
+		if err = rows.Scan(
+			&e.ID,
+			&e.Type,
+			&e.ActorID,
+			&e.TargetID,
+			&e.IP,
+			&e.UserAgent,
+			&e.Result,
+			&e.Details,
+			&e.CreatedAt,
+			&e.PrevHash,
+			&e.Hash,
+		); err != nil {
+			return nil, fmt.Errorf("%s : %w", op, err)
+		}
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+
+	return events, nil
+}
+
+// CreateCheckpoint ...
+func (r *auditRepo) CreateCheckpoint(ctx context.Context, c domain.AuditCheckpoint) error {
+	const op = "repository.auditRepo.CreateCheckpoint"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Insert(_auditCheckpointTable).
+		Columns("event_id", "hash", "signature", "created_at").
+		Values(c.EventID, c.Hash, c.Signature, c.CreatedAt).
+		ToSql()
+	if err != nil {
+		l.Error("pg.builder: bad insert query", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	if _, err = r.pg.DB(ctx).Exec(ctx, sql, args...); err != nil {
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	return nil
+}
+
+// FindCheckpoints returns all checkpoints in the order of the chain.
+func (r *auditRepo) FindCheckpoints(ctx context.Context) ([]domain.AuditCheckpoint, error) {
+	const op = "repository.auditRepo.FindCheckpoints"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Select("id", "event_id", "hash", "signature", "created_at").
+		From(_auditCheckpointTable).
+		OrderBy("event_id", "id").
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad select query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+
+	rows, err := r.pg.DB(ctx).Query(ctx, sql, args...)
+	if err != nil {
+		l.Error("db.query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+	defer rows.Close()
+
+	var checkpoints []domain.AuditCheckpoint
+	for rows.Next() {
+		var c domain.AuditCheckpoint
+		if err = rows.Scan(&c.ID, &c.EventID, &c.Hash, &c.Signature, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s : %w", op, err)
+		}
+		checkpoints = append(checkpoints, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+
+	return checkpoints, nil
+}
+
+// nullable converts empty string to NULL.
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// FindByTarget returns a page of events affecting account aid, newest first, and total number of them,
+// events of admins viewing the account are skipped.
+func (r *auditRepo) FindByTarget(ctx context.Context, aid string, p domain.Pagination) ([]domain.AuditEvent, int64, error) {
+	const op = "repository.auditRepo.FindByTarget"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Select("count(*)").
+		From(_auditTable).
+		Where(squirrel.Eq{"target_id": aid}).
+		Where(squirrel.NotEq{"type": domain.AuditAdminViews}).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad count query", slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s : %w", op, err)
+	}
+
+	var total int64
+	if err = r.pg.DB(ctx).QueryRow(ctx, sql, args...).Scan(&total); err != nil {
+		l.Error("bad queryRow or scan", slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s : %w", op, err)
+	}
+
+	sql, args, err = r.pg.Builder.
+		Select("id", "type", "coalesce(actor_id::text, '')", "ip", "user_agent", "result", "details", "created_at").
+		From(_auditTable).
+		Where(squirrel.Eq{"target_id": aid}).
+		Where(squirrel.NotEq{"type": domain.AuditAdminViews}).
+		OrderBy("id desc").
+		Limit(uint64(p.PerPage)).
+		Offset(uint64(p.Offset())).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad select query", slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s : %w", op, err)
+	}
+
+	rows, err := r.pg.DB(ctx).Query(ctx, sql, args...)
+	if err != nil {
+		l.Error("db.query", slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s : %w", op, err)
+	}
+	defer rows.Close()
+
+	events := make([]domain.AuditEvent, 0, p.PerPage)
+	for rows.Next() {
+		e := domain.AuditEvent{TargetID: aid}
+		if err = rows.Scan(
+			&e.ID,
+			&e.Type,
+			&e.ActorID,
+			&e.IP,
+			&e.UserAgent,
+			&e.Result,
+			&e.Details,
+			&e.CreatedAt,
+		); err != nil {
+			return nil, 0, fmt.Errorf("%s : %w", op, err)
+		}
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%s : %w", op, err)
+	}
+
+	return events, total, nil
+}
@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-authentication/internal/apperrors"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/sealer"
+	"go-authentication/pkg/utils"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// _sessionAAD binds sealed tokens to their purpose, so a token sealed for another purpose can't be used as a session.
+var _sessionAAD = []byte("session")
+
+// Denylist stores revoked keys until they expire.
+type Denylist interface {
+	Add(ctx context.Context, key, value string, ttl time.Duration) error
+	Get(ctx context.Context, key string) (value string, found bool, err error)
+}
+
+// cookieSessionRepo keeps session in the encrypted cookie itself,
+// only revocations are stored server side in the denylist.
+type cookieSessionRepo struct {
+	log      *slog.Logger
+	sealer   *sealer.Sealer
+	denylist Denylist
+	// ttl is the max lifetime of a session, revocations are kept for that long.
+	ttl time.Duration
+}
+
+func NewCookieSessionRepo(log *slog.Logger, s *sealer.Sealer, d Denylist, ttl time.Duration) *cookieSessionRepo {
+	return &cookieSessionRepo{log: log, sealer: s, denylist: d, ttl: ttl}
+}
+
+// sealedSession is a session payload stored in the cookie.
+type sealedSession struct {
+	ID        string          `json:"i"`
+	Handle    string          `json:"h"`
+	AccountID string          `json:"a"`
+	Provider  string          `json:"p"`
+	UserAgent string          `json:"ua"`
+	IP        string          `json:"ip"`
+	Device    domain.Device   `json:"d"`
+	Location  domain.Location `json:"l"`
+	// Impersonator is omitted for regular sessions to keep the cookie small.
+	Impersonator string    `json:"im,omitempty"`
+	TTL          int       `json:"t"`
+	ExpiresAt    int64     `json:"e"`
+	CreatedAt    time.Time `json:"c"`
+}
+
+func sessionDenyKey(aid, handle string) string {
+	return "session:" + aid + ":" + handle
+}
+
+func idDenyKey(id string) string {
+	return "id:" + id
+}
+
+func accountDenyKey(aid string) string {
+	return "account:" + aid
+}
+
+// Create seals session into the token.
+func (r *cookieSessionRepo) Create(_ context.Context, session domain.Session) (domain.Session, error) {
+	const op = "repository.cookieSession.create"
+
+	b, err := json.Marshal(sealedSession{
+		ID:           session.ID,
+		Handle:       session.Handle,
+		AccountID:    session.AccountID,
+		Provider:     session.Provider,
+		UserAgent:    session.UserAgent,
+		IP:           session.IP,
+		Device:       session.Device,
+		Location:     session.Location,
+		Impersonator: session.ImpersonatorID,
+		TTL:          session.TTL,
+		ExpiresAt:    session.ExpiresAt,
+		CreatedAt:    session.CreatedAt,
+	})
+	if err != nil {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := r.sealer.Seal(b, _sessionAAD)
+	if err != nil {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	session.Token = token
+	return session, nil
+}
+
+// FindByToken opens the token and checks the session is neither expired nor revoked.
+func (r *cookieSessionRepo) FindByToken(ctx context.Context, token string) (domain.Session, error) {
+	const op = "repository.cookieSession.findByToken"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	b, err := r.sealer.Open(token, _sessionAAD)
+	if err != nil {
+		l.Warn("can't open session token", slog.String("error", err.Error()))
+		return domain.Session{}, fmt.Errorf("%s: %w", op, apperrors.ErrorSessionNotFound)
+	}
+
+	var ss sealedSession
+	if err = json.Unmarshal(b, &ss); err != nil {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if time.Now().Unix() >= ss.ExpiresAt {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, apperrors.ErrorSessionNotFound)
+	}
+
+	revoked, err := r.revoked(ctx, ss)
+	if err != nil {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if revoked {
+		l.Debug("session is revoked", slog.String("handle", ss.Handle))
+		return domain.Session{}, fmt.Errorf("%s: %w", op, apperrors.ErrorSessionNotFound)
+	}
+
+	return domain.Session{
+		ID:             ss.ID,
+		Token:          token,
+		Handle:         ss.Handle,
+		AccountID:      ss.AccountID,
+		Provider:       ss.Provider,
+		UserAgent:      ss.UserAgent,
+		IP:             ss.IP,
+		Device:         ss.Device,
+		Location:       ss.Location,
+		ImpersonatorID: ss.Impersonator,
+		TTL:            ss.TTL,
+		ExpiresAt:      ss.ExpiresAt,
+		CreatedAt:      ss.CreatedAt,
+	}, nil
+}
+
+func (r *cookieSessionRepo) revoked(ctx context.Context, ss sealedSession) (bool, error) {
+	if _, found, err := r.denylist.Get(ctx, idDenyKey(ss.ID)); err != nil || found {
+		return found, err
+	}
+
+	if _, found, err := r.denylist.Get(ctx, sessionDenyKey(ss.AccountID, ss.Handle)); err != nil || found {
+		return found, err
+	}
+
+	v, found, err := r.denylist.Get(ctx, accountDenyKey(ss.AccountID))
+	if err != nil || !found {
+		return false, err
+	}
+
+	// value is "<revoked before, unix nano>:<except handle>"
+	before, except, _ := strings.Cut(v, ":")
+	nano, err := strconv.ParseInt(before, 10, 64)
+	if err != nil {
+		return false, err
+	}
+
+	return ss.Handle != except && !ss.CreatedAt.After(time.Unix(0, nano)), nil
+}
+
+// FindByHandle is not supported, sessions are not stored server side.
+func (r *cookieSessionRepo) FindByHandle(_ context.Context, _, _ string) (domain.Session, error) {
+	return domain.Session{}, apperrors.ErrorSessionStoreUnsupported
+}
+
+// FindAll is not supported, sessions are not stored server side.
+func (r *cookieSessionRepo) FindAll(_ context.Context, _ string, _ domain.Pagination) ([]domain.Session, int64, error) {
+	return nil, 0, apperrors.ErrorSessionStoreUnsupported
+}
+
+// AccountIDs is not supported, sessions are not stored server side.
+func (r *cookieSessionRepo) AccountIDs(_ context.Context, _ string, _ int) ([]string, error) {
+	return nil, apperrors.ErrorSessionStoreUnsupported
+}
+
+// Delete revokes session with given handle of the account.
+func (r *cookieSessionRepo) Delete(ctx context.Context, aid, handle string) error {
+	const op = "repository.cookieSession.delete"
+
+	if err := r.denylist.Add(ctx, sessionDenyKey(aid, handle), "", r.ttl); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// DeleteAll revokes all sessions of the account created until now except the session with given handle.
+func (r *cookieSessionRepo) DeleteAll(ctx context.Context, aid, exceptHandle string) error {
+	const op = "repository.cookieSession.deleteAll"
+
+	v := strconv.FormatInt(time.Now().UnixNano(), 10) + ":" + exceptHandle
+
+	if err := r.denylist.Add(ctx, accountDenyKey(aid), v, r.ttl); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Rotate revokes the token with oldID and seals session s into a new token.
+func (r *cookieSessionRepo) Rotate(ctx context.Context, oldID string, s domain.Session) (domain.Session, error) {
+	const op = "repository.cookieSession.rotate"
+
+	ttl := time.Until(time.Unix(s.ExpiresAt, 0))
+	if ttl <= 0 {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, apperrors.ErrorSessionNotFound)
+	}
+
+	if err := r.denylist.Add(ctx, idDenyKey(oldID), "", ttl); err != nil {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rotated, err := r.Create(ctx, s)
+	if err != nil {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return rotated, nil
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+type denyEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// memoryDenylist keeps denied keys in memory of the current process.
+type memoryDenylist struct {
+	mu      sync.Mutex
+	entries map[string]denyEntry
+}
+
+func NewMemoryDenylist() *memoryDenylist {
+	return &memoryDenylist{entries: make(map[string]denyEntry)}
+}
+
+func (d *memoryDenylist) Add(_ context.Context, key, value string, ttl time.Duration) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+
+	// drop expired entries to keep the list small
+	for k, e := range d.entries {
+		if now.After(e.expiresAt) {
+			delete(d.entries, k)
+		}
+	}
+
+	d.entries[key] = denyEntry{value: value, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (d *memoryDenylist) Get(_ context.Context, key string) (string, bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	e, ok := d.entries[key]
+	if !ok || time.Now().After(e.expiresAt) {
+		return "", false, nil
+	}
+	return e.value, true, nil
+}
+
+// redisDenylist keeps denied keys in redis shared by all instances.
+type redisDenylist struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisDenylist(client *redis.Client, prefix string) *redisDenylist {
+	return &redisDenylist{client: client, prefix: prefix}
+}
+
+func (d *redisDenylist) Add(ctx context.Context, key, value string, ttl time.Duration) error {
+	const op = "repository.redisDenylist.add"
+
+	if err := d.client.Set(ctx, d.prefix+key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (d *redisDenylist) Get(ctx context.Context, key string) (string, bool, error) {
+	const op = "repository.redisDenylist.get"
+
+	v, err := d.client.Get(ctx, d.prefix+key).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("%s: %w", op, err)
+	}
+	return v, true, nil
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/postgres"
+	"go-authentication/pkg/utils"
+	"log/slog"
+)
+
+const _deviceTable = "known_devices"
+
+type deviceRepo struct {
+	log *slog.Logger
+	pg  *postgres.Postgres
+}
+
+func NewDeviceRepo(log *slog.Logger, db *postgres.Postgres) *deviceRepo {
+	return &deviceRepo{log: log, pg: db}
+}
+
+// _upsertDevice stores the device or refreshes it if known, and reports whether it is new
+// and whether the first device of the account is trusted, the trust is taken by the first login.
+const _upsertDevice = `
+WITH signup AS (
+         UPDATE accounts SET trust_first_device = false
+         WHERE id = $1 AND trust_first_device
+         RETURNING id),
+     dev AS (
+         INSERT INTO known_devices (account_id, fingerprint, browser, os, ip, first_seen_at, last_seen_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $6)
+         ON CONFLICT (account_id, fingerprint) DO UPDATE
+             SET ip = excluded.ip, last_seen_at = excluded.last_seen_at
+         RETURNING (xmax = 0) AS inserted)
+SELECT dev.inserted, EXISTS (SELECT 1 FROM signup)
+FROM dev`
+
+// Add stores the device of the account or refreshes the known one. It reports whether
+// the device is seen for the first time and whether it is the trusted first device of the account.
+func (r *deviceRepo) Add(ctx context.Context, d domain.KnownDevice) (bool, bool, error) {
+	const op = "repository.deviceRepo.Add"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	var inserted, trusted bool
+	if err := r.pg.DB(ctx).QueryRow(ctx, _upsertDevice,
+		d.AccountID, d.Fingerprint, d.Browser, d.OS, d.IP, d.LastSeenAt).Scan(&inserted, &trusted); err != nil {
+		l.Error("bad queryRow or scan", slog.String("error", err.Error()))
+		return false, false, fmt.Errorf("%s : %w", op, err)
+	}
+	return inserted, trusted, nil
+}
+
+// FindAll returns known devices of the account, recently seen first.
+func (r *deviceRepo) FindAll(ctx context.Context, aid string) ([]domain.KnownDevice, error) {
+	const op = "repository.deviceRepo.FindAll"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Select("fingerprint", "browser", "os", "ip", "first_seen_at", "last_seen_at").
+		From(_deviceTable).
+		Where(squirrel.Eq{"account_id": aid}).
+		OrderBy("last_seen_at desc").
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad select query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+
+	rows, err := r.pg.DB(ctx).Query(ctx, sql, args...)
+	if err != nil {
+		l.Error("db.query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+	defer rows.Close()
+
+	var devices []domain.KnownDevice
+	for rows.Next() {
+		d := domain.KnownDevice{AccountID: aid}
+		if err = rows.Scan(&d.Fingerprint, &d.Browser, &d.OS, &d.IP, &d.FirstSeenAt, &d.LastSeenAt); err != nil {
+			l.Error("rows.scan", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("%s : %w", op, err)
+		}
+		devices = append(devices, d)
+	}
+	if err = rows.Err(); err != nil {
+		l.Error("rows.err", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+	return devices, nil
+}
+
+// Delete forgets the device of the account, deleting of unknown device is not an error.
+func (r *deviceRepo) Delete(ctx context.Context, aid, fingerprint string) error {
+	const op = "repository.deviceRepo.Delete"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Delete(_deviceTable).
+		Where(squirrel.Eq{"account_id": aid, "fingerprint": fingerprint}).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad delete query", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	if _, err = r.pg.DB(ctx).Exec(ctx, sql, args...); err != nil {
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go-authentication/internal/domain"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type attemptsEntry struct {
+	attempts  domain.LoginAttempts
+	expiresAt time.Time
+}
+
+// _attemptsSweepEvery is a number of reservations between sweeps of expired entries.
+const _attemptsSweepEvery = 1024
+
+// memoryLoginAttempts keeps login attempts in memory of the current process.
+type memoryLoginAttempts struct {
+	mu      sync.Mutex
+	entries map[string]attemptsEntry
+	calls   int
+}
+
+func NewMemoryLoginAttempts() *memoryLoginAttempts {
+	return &memoryLoginAttempts{entries: make(map[string]attemptsEntry)}
+}
+
+func (m *memoryLoginAttempts) Get(_ context.Context, key string) (domain.LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.get(key, time.Now()), nil
+}
+
+// get must be called with mu held.
+func (m *memoryLoginAttempts) get(key string, now time.Time) domain.LoginAttempts {
+	e, ok := m.entries[key]
+	if !ok || now.After(e.expiresAt) {
+		delete(m.entries, key)
+		return domain.LoginAttempts{}
+	}
+	return e.attempts
+}
+
+func (m *memoryLoginAttempts) Reserve(
+	_ context.Context,
+	key string,
+	ttl time.Duration,
+	wait func(domain.LoginAttempts) time.Duration) (time.Duration, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	m.calls++
+	if m.calls%_attemptsSweepEvery == 0 {
+		m.sweep(now)
+	}
+
+	a := m.get(key, now)
+	if d := wait(a); d > 0 {
+		return d, nil
+	}
+
+	a.Failures++
+	a.LastFailure = now
+
+	expiresAt := now.Add(ttl)
+	if a.LockedUntil.After(expiresAt) {
+		expiresAt = a.LockedUntil
+	}
+
+	m.entries[key] = attemptsEntry{attempts: a, expiresAt: expiresAt}
+	return 0, nil
+}
+
+// sweep drops expired entries to keep memory bounded, must be called with mu held.
+func (m *memoryLoginAttempts) sweep(now time.Time) {
+	for k, e := range m.entries {
+		if now.After(e.expiresAt) {
+			delete(m.entries, k)
+		}
+	}
+}
+
+func (m *memoryLoginAttempts) Release(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if ok && e.attempts.Failures > 0 {
+		e.attempts.Failures--
+		m.entries[key] = e
+	}
+	return nil
+}
+
+func (m *memoryLoginAttempts) Lock(_ context.Context, key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := m.entries[key]
+	e.attempts.LockedUntil = until
+	if until.After(e.expiresAt) {
+		e.expiresAt = until
+	}
+	m.entries[key] = e
+	return nil
+}
+
+func (m *memoryLoginAttempts) Reset(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+// redisLoginAttempts keeps login attempts in redis hashes shared by all instances.
+type redisLoginAttempts struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisLoginAttempts(client *redis.Client, prefix string) *redisLoginAttempts {
+	return &redisLoginAttempts{client: client, prefix: prefix}
+}
+
+const (
+	_attemptsFailures = "failures"
+	_attemptsLast     = "last"
+	_attemptsLocked   = "locked"
+)
+
+func (r *redisLoginAttempts) Get(ctx context.Context, key string) (domain.LoginAttempts, error) {
+	const op = "repository.redisLoginAttempts.get"
+
+	m, err := r.client.HGetAll(ctx, r.prefix+key).Result()
+	if err != nil {
+		return domain.LoginAttempts{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return parseAttempts(m), nil
+}
+
+// _reserveRetries limits optimistic transaction retries of Reserve under contention.
+const _reserveRetries = 10
+
+func (r *redisLoginAttempts) Reserve(
+	ctx context.Context,
+	key string,
+	ttl time.Duration,
+	wait func(domain.LoginAttempts) time.Duration) (time.Duration, error) {
+
+	const op = "repository.redisLoginAttempts.reserve"
+
+	k := r.prefix + key
+
+	var d time.Duration
+	reserve := func(tx *redis.Tx) error {
+		m, err := tx.HGetAll(ctx, k).Result()
+		if err != nil {
+			return err
+		}
+		a := parseAttempts(m)
+		if d = wait(a); d > 0 {
+			return nil
+		}
+
+		// the state outlives the lock, as in memory
+		expire := ttl
+		if untilLock := time.Until(a.LockedUntil); untilLock > expire {
+			expire = untilLock
+		}
+
+		// the transaction fails if the key is changed after it is watched
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.HIncrBy(ctx, k, _attemptsFailures, 1)
+			p.HSet(ctx, k, _attemptsLast, time.Now().UnixNano())
+			p.Expire(ctx, k, expire)
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < _reserveRetries; i++ {
+		err := r.client.Watch(ctx, reserve, k)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		return d, nil
+	}
+	return 0, fmt.Errorf("%s: %w", op, redis.TxFailedErr)
+}
+
+// _releaseScript decrements failures only of existing state, so it can't create a key without ttl.
+var _releaseScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], ARGV[1]) then
+	return redis.call("HINCRBY", KEYS[1], ARGV[1], -1)
+end
+return 0`)
+
+func (r *redisLoginAttempts) Release(ctx context.Context, key string) error {
+	const op = "repository.redisLoginAttempts.release"
+
+	if err := _releaseScript.Run(ctx, r.client, []string{r.prefix + key}, _attemptsFailures).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// _lockScript sets the lock and extends ttl of the state to the end of the lock, the ttl is never
+// shortened, so failures counted before the lock are kept after it, as in memory.
+var _lockScript = redis.NewScript(`
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl < tonumber(ARGV[3]) then
+	redis.call("PEXPIRE", KEYS[1], ARGV[3])
+end
+return 0`)
+
+func (r *redisLoginAttempts) Lock(ctx context.Context, key string, until time.Time) error {
+	const op = "repository.redisLoginAttempts.lock"
+
+	lockMs := max(time.Until(until).Milliseconds(), 1)
+
+	err := _lockScript.Run(ctx, r.client, []string{r.prefix + key},
+		_attemptsLocked, until.UnixNano(), lockMs).Err()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (r *redisLoginAttempts) Reset(ctx context.Context, key string) error {
+	const op = "repository.redisLoginAttempts.reset"
+
+	if err := r.client.Del(ctx, r.prefix+key).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func parseAttempts(m map[string]string) domain.LoginAttempts {
+	var a domain.LoginAttempts
+
+	a.Failures, _ = strconv.Atoi(m[_attemptsFailures])
+	if v, err := strconv.ParseInt(m[_attemptsLast], 10, 64); err == nil {
+		a.LastFailure = time.Unix(0, v)
+	}
+	if v, err := strconv.ParseInt(m[_attemptsLocked], 10, 64); err == nil {
+		a.LockedUntil = time.Unix(0, v)
+	}
+	return a
+}
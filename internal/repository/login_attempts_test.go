@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go-authentication/internal/domain"
+	"testing"
+	"time"
+)
+
+func noWait(domain.LoginAttempts) time.Duration { return 0 }
+
+func newTestRedisLoginAttempts(t *testing.T) (*redisLoginAttempts, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return NewRedisLoginAttempts(client, "attempts:"), mr
+}
+
+func TestRedisLoginAttemptsLockKeepsLongerTTL(t *testing.T) {
+	r, mr := newTestRedisLoginAttempts(t)
+	ctx := context.Background()
+
+	if _, err := r.Reserve(ctx, "bob", time.Hour, noWait); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Lock(ctx, "bob", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	if ttl := mr.TTL("attempts:bob"); ttl < 59*time.Minute {
+		t.Errorf("ttl = %s, want failure history kept for an hour", ttl)
+	}
+
+	// the lock is over, the failures are still counted
+	mr.FastForward(2 * time.Minute)
+
+	a, err := r.Get(ctx, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Failures != 1 {
+		t.Errorf("%d failures after the lock, want 1", a.Failures)
+	}
+}
+
+func TestRedisLoginAttemptsLockExtendsTTL(t *testing.T) {
+	r, mr := newTestRedisLoginAttempts(t)
+	ctx := context.Background()
+
+	if _, err := r.Reserve(ctx, "bob", time.Minute, noWait); err != nil {
+		t.Fatal(err)
+	}
+	until := time.Now().Add(time.Hour)
+	if err := r.Lock(ctx, "bob", until); err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	mr.FastForward(2 * time.Minute)
+
+	a, err := r.Get(ctx, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Failures != 1 || !a.LockedUntil.Equal(time.Unix(0, until.UnixNano())) {
+		t.Errorf("attempts = %+v, want 1 failure locked until %s", a, until)
+	}
+}
+
+func TestRedisLoginAttemptsReserveKeepsLock(t *testing.T) {
+	r, mr := newTestRedisLoginAttempts(t)
+	ctx := context.Background()
+
+	if err := r.Lock(ctx, "bob", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reserve(ctx, "bob", time.Minute, noWait); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("attempts:bob"); ttl < 59*time.Minute {
+		t.Errorf("ttl = %s, want the lock kept for an hour", ttl)
+	}
+}
+
+func TestMemoryLoginAttemptsLockKeepsLongerTTL(t *testing.T) {
+	m := NewMemoryLoginAttempts()
+	ctx := context.Background()
+
+	if _, err := m.Reserve(ctx, "bob", time.Hour, noWait); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Lock(ctx, "bob", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if exp := time.Until(m.entries["bob"].expiresAt); exp < 59*time.Minute {
+		t.Errorf("entry expires in %s, want failure history kept for an hour", exp)
+	}
+}
+
+func TestMemoryLoginAttemptsSweepsPeriodically(t *testing.T) {
+	m := NewMemoryLoginAttempts()
+	ctx := context.Background()
+
+	m.entries["expired"] = attemptsEntry{expiresAt: time.Now().Add(-time.Second)}
+
+	for i := 1; i < _attemptsSweepEvery; i++ {
+		if _, err := m.Reserve(ctx, "bob", time.Hour, noWait); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := m.entries["expired"]; !ok {
+		t.Fatal("expired entry is swept before the sweep period")
+	}
+
+	if _, err := m.Reserve(ctx, "bob", time.Hour, noWait); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.entries["expired"]; ok {
+		t.Error("expired entry is not swept")
+	}
+}
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/postgres"
+	"go-authentication/pkg/utils"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+const _outboxTable = "outbox"
+
+type outboxRepo struct {
+	log *slog.Logger
+	pg  *postgres.Postgres
+}
+
+func NewOutboxRepo(log *slog.Logger, db *postgres.Postgres) *outboxRepo {
+	return &outboxRepo{log: log, pg: db}
+}
+
+// Add writes the event to the outbox, called within a transaction it is written
+// atomically with the change the event describes.
+func (r *outboxRepo) Add(ctx context.Context, e domain.Event) error {
+	const op = "repository.outboxRepo.Add"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		l.Error("can't marshal event", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	sql, args, err := r.pg.Builder.
+		Insert(_outboxTable).
+		Columns("event_id", "type", "payload", "created_at").
+		Values(e.ID, e.Type, payload, e.CreatedAt).
+		ToSql()
+	if err != nil {
+		l.Error("pg.builder: bad insert query", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	if _, err = r.pg.DB(ctx).Exec(ctx, sql, args...); err != nil {
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	return nil
+}
+
+// _claimOutbox takes pending events and hides them from other relays for the lease,
+// events of a crashed relay are claimed again after the lease.
+const _claimOutbox = `
+UPDATE outbox o
+SET locked_until = current_timestamp + $2 * interval '1 millisecond'
+FROM (SELECT id FROM outbox
+      WHERE dispatched_at IS NULL AND parked_at IS NULL
+        AND (locked_until IS NULL OR locked_until <= current_timestamp)
+      ORDER BY id
+      LIMIT $1 FOR UPDATE SKIP LOCKED) due
+WHERE o.id = due.id
+RETURNING o.id, o.payload, o.attempts`
+
+// Claim returns up to limit pending events in the order they were written, the events
+// aren't locked while they are published, so no transaction is held over the network.
+func (r *outboxRepo) Claim(ctx context.Context, limit int, lease time.Duration) ([]domain.OutboxEntry, error) {
+	const op = "repository.outboxRepo.Claim"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	rows, err := r.pg.DB(ctx).Query(ctx, _claimOutbox, limit, lease.Milliseconds())
+	if err != nil {
+		l.Error("db.query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+	defer rows.Close()
+
+	var entries []domain.OutboxEntry
+	for rows.Next() {
+		var e domain.OutboxEntry
+		if err = rows.Scan(&e.ID, &e.Event, &e.Attempts); err != nil {
+			l.Error("rows.scan", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("%s : %w", op, err)
+		}
+		entries = append(entries, e)
+	}
+	if err = rows.Err(); err != nil {
+		l.Error("rows.err", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+
+	// RETURNING doesn't keep the order of the subquery
+	slices.SortFunc(entries, func(a, b domain.OutboxEntry) int { return cmp.Compare(a.ID, b.ID) })
+	return entries, nil
+}
+
+// MarkDispatched marks published events dispatched.
+func (r *outboxRepo) MarkDispatched(ctx context.Context, ids []int64) error {
+	const op = "repository.outboxRepo.MarkDispatched"
+
+	if err := r.update(ctx, ids, map[string]any{"dispatched_at": squirrel.Expr("current_timestamp")}); err != nil {
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	return nil
+}
+
+// Release returns claimed events which weren't published to pending without counting an attempt.
+func (r *outboxRepo) Release(ctx context.Context, ids []int64) error {
+	const op = "repository.outboxRepo.Release"
+
+	if err := r.update(ctx, ids, map[string]any{"locked_until": nil}); err != nil {
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	return nil
+}
+
+// Fail records failed attempt to publish the event, a parked event isn't claimed anymore.
+func (r *outboxRepo) Fail(ctx context.Context, id int64, lastErr string, park bool) error {
+	const op = "repository.outboxRepo.Fail"
+
+	columns := map[string]any{
+		"attempts":     squirrel.Expr("attempts + 1"),
+		"last_error":   lastErr,
+		"locked_until": nil,
+	}
+	if park {
+		columns["parked_at"] = squirrel.Expr("current_timestamp")
+	}
+
+	if err := r.update(ctx, []int64{id}, columns); err != nil {
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	return nil
+}
+
+func (r *outboxRepo) update(ctx context.Context, ids []int64, columns map[string]any) error {
+	l := r.log.With(slog.String(utils.Operation, "repository.outboxRepo.update"))
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	sql, args, err := r.pg.Builder.
+		Update(_outboxTable).
+		SetMap(columns).
+		Where(squirrel.Eq{"id": ids}).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad update query", slog.String("error", err.Error()))
+		return err
+	}
+
+	if _, err = r.pg.DB(ctx).Exec(ctx, sql, args...); err != nil {
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// DeleteDispatched deletes events dispatched before the time and returns their number.
+func (r *outboxRepo) DeleteDispatched(ctx context.Context, before time.Time) (int64, error) {
+	const op = "repository.outboxRepo.DeleteDispatched"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Delete(_outboxTable).
+		Where(squirrel.Lt{"dispatched_at": before}).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad delete query", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s : %w", op, err)
+	}
+
+	ct, err := r.pg.DB(ctx).Exec(ctx, sql, args...)
+	if err != nil {
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s : %w", op, err)
+	}
+	return ct.RowsAffected(), nil
+}
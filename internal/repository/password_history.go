@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"go-authentication/pkg/postgres"
+	"go-authentication/pkg/utils"
+	"log/slog"
+)
+
+const _passwordHistoryTable = "password_history"
+
+type passwordHistoryRepo struct {
+	log *slog.Logger
+	pg  *postgres.Postgres
+}
+
+func NewPasswordHistoryRepo(log *slog.Logger, db *postgres.Postgres) *passwordHistoryRepo {
+	return &passwordHistoryRepo{log: log, pg: db}
+}
+
+// Add stores password hash of the account and prunes all but keep latest hashes.
+func (r *passwordHistoryRepo) Add(ctx context.Context, aid, hash string, keep int) error {
+	const op = "repository.passwordHistoryRepo.Add"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Insert(_passwordHistoryTable).
+		Columns("account_id", "password_hash").
+		Values(aid, hash).
+		ToSql()
+	if err != nil {
+		l.Error("pg.builder: bad insert query",
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	if _, err = r.pg.DB(ctx).Exec(ctx, sql, args...); err != nil {
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	latest := r.pg.Builder.
+		Select("id").
+		From(_passwordHistoryTable).
+		Where(squirrel.Eq{"account_id": aid}).
+		OrderBy("id desc").
+		Limit(uint64(keep))
+
+	sql, args, err = r.pg.Builder.
+		Delete(_passwordHistoryTable).
+		Where(squirrel.Eq{"account_id": aid}).
+		Where(latest.Prefix("id not in (").Suffix(")")).
+		ToSql()
+	if err != nil {
+		l.Error("pg.builder: bad delete query",
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	ct, err := r.pg.DB(ctx).Exec(ctx, sql, args...)
+	if err != nil {
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	l.Debug("password history pruned", slog.Int64("count", ct.RowsAffected()))
+
+	return nil
+}
+
+// FindLatest returns up to n latest password hashes of the account, the newest first.
+func (r *passwordHistoryRepo) FindLatest(ctx context.Context, aid string, n int) ([]string, error) {
+	const op = "repository.passwordHistoryRepo.FindLatest"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Select("password_hash").
+		From(_passwordHistoryTable).
+		Where(squirrel.Eq{"account_id": aid}).
+		OrderBy("id desc").
+		Limit(uint64(n)).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad select query",
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+
+	rows, err := r.pg.DB(ctx).Query(ctx, sql, args...)
+	if err != nil {
+		l.Error("db.query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+	defer rows.Close()
+
+	hashes := make([]string, 0, n)
+	for rows.Next() {
+		var h string
+		if err = rows.Scan(&h); err != nil {
+			return nil, fmt.Errorf("%s : %w", op, err)
+		}
+		hashes = append(hashes, h)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+	return hashes, nil
+}
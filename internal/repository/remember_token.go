@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"go-authentication/internal/apperrors"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/postgres"
+	"go-authentication/pkg/utils"
+	"log/slog"
+	"time"
+)
+
+const _rememberTable = "remember_tokens"
+
+type rememberTokenRepo struct {
+	log *slog.Logger
+	pg  *postgres.Postgres
+}
+
+func NewRememberTokenRepo(log *slog.Logger, db *postgres.Postgres) *rememberTokenRepo {
+	return &rememberTokenRepo{log: log, pg: db}
+}
+
+// Create ...
+func (r *rememberTokenRepo) Create(ctx context.Context, t domain.RememberToken) error {
+	const op = "repository.rememberTokenRepo.Create"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Insert(_rememberTable).
+		Columns("selector", "account_id", "validator_hash", "rotated_at", "expires_at", "created_at").
+		Values(t.Selector, t.AccountID, t.ValidatorHash, t.RotatedAt, t.ExpiresAt, t.CreatedAt).
+		ToSql()
+	if err != nil {
+		l.Error("pg.builder: bad insert query",
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	if _, err = r.pg.DB(ctx).Exec(ctx, sql, args...); err != nil {
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	return nil
+}
+
+// FindBySelector returns token which is not expired yet.
+func (r *rememberTokenRepo) FindBySelector(ctx context.Context, selector string) (domain.RememberToken, error) {
+	const op = "repository.rememberTokenRepo.FindBySelector"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Select("account_id", "validator_hash", "prev_validator_hash", "rotated_at", "expires_at", "created_at").
+		From(_rememberTable).
+		Where(squirrel.Eq{"selector": selector}).
+		Where(squirrel.Gt{"expires_at": time.Now()}).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad select by selector query",
+			slog.String("error", err.Error()))
+		return domain.RememberToken{}, fmt.Errorf("%s : %w", op, err)
+	}
+
+	t := domain.RememberToken{Selector: selector}
+
+	if err = r.pg.DB(ctx).QueryRow(ctx, sql, args...).Scan(
+		&t.AccountID,
+		&t.ValidatorHash,
+		&t.PrevValidatorHash,
+		&t.RotatedAt,
+		&t.ExpiresAt,
+		&t.CreatedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			l.Warn("remember token not found")
+			return domain.RememberToken{}, fmt.Errorf("%s: %w", op, apperrors.ErrorRememberTokenNotFound)
+		}
+		l.Error("bad queryRow or scan",
+			slog.String("error", err.Error()))
+		return domain.RememberToken{}, fmt.Errorf("%s : %w", op, err)
+	}
+	return t, nil
+}
+
+// Rotate stores new validator of the token only if the stored validator is still the one
+// the token was rotated from, so concurrent rotations of the same token can't both succeed.
+func (r *rememberTokenRepo) Rotate(ctx context.Context, t domain.RememberToken) error {
+	const op = "repository.rememberTokenRepo.Rotate"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Update(_rememberTable).
+		Set("validator_hash", t.ValidatorHash).
+		Set("prev_validator_hash", t.PrevValidatorHash).
+		Set("rotated_at", t.RotatedAt).
+		Where(squirrel.Eq{"selector": t.Selector, "validator_hash": t.PrevValidatorHash}).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad update query",
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	ct, err := r.pg.DB(ctx).Exec(ctx, sql, args...)
+	if err != nil {
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	if ct.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, apperrors.ErrorRememberTokenNotFound)
+	}
+	return nil
+}
+
+// Delete removes the whole series of the token.
+func (r *rememberTokenRepo) Delete(ctx context.Context, selector string) error {
+	const op = "repository.rememberTokenRepo.Delete"
+
+	return r.delete(ctx, op, squirrel.Eq{"selector": selector})
+}
+
+// DeleteAll removes all token series of the account.
+func (r *rememberTokenRepo) DeleteAll(ctx context.Context, aid string) error {
+	const op = "repository.rememberTokenRepo.DeleteAll"
+
+	return r.delete(ctx, op, squirrel.Eq{"account_id": aid})
+}
+
+func (r *rememberTokenRepo) delete(ctx context.Context, op string, where squirrel.Eq) error {
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Delete(_rememberTable).
+		Where(where).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad delete query",
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	ct, err := r.pg.DB(ctx).Exec(ctx, sql, args...)
+	if err != nil {
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	l.Debug("deleted remember tokens", slog.Int64("count", ct.RowsAffected()))
+	return nil
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go-authentication/internal/apperrors"
+	"go-authentication/pkg/postgres"
+	"go-authentication/pkg/utils"
+	"log/slog"
+)
+
+const (
+	_accountRolesTable    = "account_roles"
+	_rolePermissionsTable = "role_permissions"
+)
+
+type roleRepo struct {
+	log *slog.Logger
+	pg  *postgres.Postgres
+}
+
+func NewRoleRepo(log *slog.Logger, db *postgres.Postgres) *roleRepo {
+	return &roleRepo{log: log, pg: db}
+}
+
+// Assign assigns role to the account, assigning of already assigned role is not an error.
+func (r *roleRepo) Assign(ctx context.Context, aid, role string) error {
+	const op = "repository.roleRepo.Assign"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Insert(_accountRolesTable).
+		Columns("account_id", "role").
+		Values(aid, role).
+		Suffix("ON CONFLICT DO NOTHING").
+		ToSql()
+	if err != nil {
+		l.Error("pg.builder: bad insert query",
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	if _, err = r.pg.DB(ctx).Exec(ctx, sql, args...); err != nil {
+		var pgErr *pgconn.PgError
+
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation {
+			l.Warn("foreign key violation", slog.String("constraint", pgErr.ConstraintName))
+
+			if pgErr.ConstraintName == "account_roles_account_id_fkey" {
+				return fmt.Errorf("%s: %w", op, apperrors.ErrorAccountNotFound)
+			}
+			return fmt.Errorf("%s: %w", op, apperrors.ErrorRoleNotFound)
+		}
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	return nil
+}
+
+// Revoke removes role from the account, returns ErrorRoleNotAssigned if the account doesn't have the role.
+func (r *roleRepo) Revoke(ctx context.Context, aid, role string) error {
+	const op = "repository.roleRepo.Revoke"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Delete(_accountRolesTable).
+		Where(squirrel.Eq{"account_id": aid, "role": role}).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad delete query",
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	ct, err := r.pg.DB(ctx).Exec(ctx, sql, args...)
+	if err != nil {
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	if ct.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, apperrors.ErrorRoleNotAssigned)
+	}
+	return nil
+}
+
+// FindByAccount returns names of the account roles.
+func (r *roleRepo) FindByAccount(ctx context.Context, aid string) ([]string, error) {
+	const op = "repository.roleRepo.FindByAccount"
+
+	sql, args, err := r.pg.Builder.
+		Select("role").
+		From(_accountRolesTable).
+		Where(squirrel.Eq{"account_id": aid}).
+		OrderBy("role").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+
+	roles, err := r.strings(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+	return roles, nil
+}
+
+// FindPermissions returns names of permissions granted to the account by all its roles.
+func (r *roleRepo) FindPermissions(ctx context.Context, aid string) ([]string, error) {
+	const op = "repository.roleRepo.FindPermissions"
+
+	sql, args, err := r.pg.Builder.
+		Select("DISTINCT rp.permission").
+		From(_rolePermissionsTable + " rp").
+		Join(_accountRolesTable + " ar ON ar.role = rp.role").
+		Where(squirrel.Eq{"ar.account_id": aid}).
+		OrderBy("rp.permission").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+
+	perms, err := r.strings(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+	return perms, nil
+}
+
+func (r *roleRepo) strings(ctx context.Context, sql string, args ...any) ([]string, error) {
+	rows, err := r.pg.DB(ctx).Query(ctx, sql, args...)
+	if err != nil {
+		r.log.Error("db.query", slog.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []string
+	for rows.Next() {
+		var s string
+		if err = rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
@@ -4,42 +4,130 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/google/uuid"
+	"go-authentication/config"
+	"go-authentication/internal/apperrors"
 	"go-authentication/pkg/utils"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
 
 	"log/slog"
 
 	"go-authentication/internal/domain"
 )
 
+// _legacyTTLIndex is a name of the former TTL index on createdAt, it expired every session
+// after the same TTL, regardless of the session lifetime.
+const _legacyTTLIndex = "createdAt_1"
+
+// sessionDocument is a session stored in mongo, expiresAt is a date, so the TTL index removes
+// the session when it expires.
+type sessionDocument struct {
+	domain.Session `bson:",inline"`
+	ExpiresAt      time.Time `bson:"expiresAt"`
+}
+
+func newSessionDocument(s domain.Session) sessionDocument {
+	return sessionDocument{Session: s, ExpiresAt: time.Unix(s.ExpiresAt, 0)}
+}
+
+// storedSession is a session read from mongo, expiresAt of sessions stored before
+// the TTL index was moved to it is a unix time.
+type storedSession struct {
+	domain.Session `bson:",inline"`
+	ExpiresAt      bson.RawValue `bson:"expiresAt"`
+}
+
+func (d storedSession) session() domain.Session {
+	s := d.Session
+	switch d.ExpiresAt.Type {
+	case bsontype.DateTime:
+		s.ExpiresAt = d.ExpiresAt.Time().Unix()
+	case bsontype.Int64, bsontype.Int32, bsontype.Double:
+		s.ExpiresAt, _ = d.ExpiresAt.AsInt64OK()
+	}
+	return s
+}
+
 type sessionRepo struct {
 	log   *slog.Logger
+	cfg   config.Session
 	mongo *mongo.Collection
 }
 
-func NewSessionRepo(mongo *mongo.Database, logger *slog.Logger) *sessionRepo {
-	return &sessionRepo{mongo: mongo.Collection("session"), log: logger}
+func NewSessionRepo(mongo *mongo.Database, logger *slog.Logger, cfg config.Session) *sessionRepo {
+	return &sessionRepo{mongo: mongo.Collection("session"), log: logger, cfg: cfg}
 }
 
-func (r *sessionRepo) Create(ctx context.Context, session domain.Session) error {
-	const op = "repository.session.create"
+// EnsureIndexes creates indexes of the session collection, it must be called once at startup.
+// Sessions are removed by the TTL index when they expire, expiration times stored as unix time
+// are converted to dates and the former index on createdAt is dropped.
+func (r *sessionRepo) EnsureIndexes(ctx context.Context) error {
+	const op = "repository.session.ensureIndexes"
 	l := r.log.With(slog.String(utils.Operation, op))
 
+	_, err := r.mongo.UpdateMany(ctx,
+		bson.M{"expiresAt": bson.M{"$type": "number"}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"expiresAt": bson.M{"$toDate": bson.M{"$multiply": bson.A{"$expiresAt", 1000}}},
+		}}}})
+	if err != nil {
+		l.Error("r.mongo.UpdateMany: can't convert expiration times",
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err = r.mongo.Indexes().DropOne(ctx, _legacyTTLIndex); err != nil && !isIndexNotFound(err) {
+		l.Error("r.mongo.Indexes.DropOne: can't drop legacy index",
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
 	ttlIndex := mongo.IndexModel{
-		Keys:    bson.D{{Key: "createdAt", Value: 1}}, // sorting asc
-		Options: options.Index().SetExpireAfterSeconds(int32(session.TTL)),
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
 	}
-	_, err := r.mongo.Indexes().CreateOne(ctx, ttlIndex)
-	if err != nil {
-		l.Error("r.mongo.Indexes.CreateOne: can't create index",
+	handleIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "accountId", Value: 1}, {Key: "handle", Value: 1}},
+	}
+	if _, err = r.mongo.Indexes().CreateMany(ctx, []mongo.IndexModel{ttlIndex, handleIndex}); err != nil {
+		l.Error("r.mongo.Indexes.CreateMany: can't create index",
 			slog.String("error", err.Error()))
 		return fmt.Errorf("%s: %w", op, err)
 	}
+	return nil
+}
+
+func isIndexNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	// IndexNotFound, NamespaceNotFound if the collection doesn't exist yet
+	return errors.As(err, &cmdErr) && (cmdErr.Code == 27 || cmdErr.Code == 26)
+}
+
+// Create stores session, the token of the session is not persisted, only its hash is used as id.
+func (r *sessionRepo) Create(ctx context.Context, session domain.Session) (domain.Session, error) {
+	const op = "repository.session.create"
+
+	if err := r.insert(ctx, session); err != nil {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return session, nil
+}
 
-	info, err := r.mongo.InsertOne(ctx, session)
+func (r *sessionRepo) insert(ctx context.Context, session domain.Session) error {
+	const op = "repository.session.insert"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	info, err := r.mongo.InsertOne(ctx, newSessionDocument(session))
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			l.Warn("r.mongo.InsertOne: session already exists",
+				slog.String("error", err.Error()))
+			return fmt.Errorf("%s: %w", op, apperrors.ErrorSessionAlreadyExists)
+		}
 		l.Error("r.mongo.InsertOne: can't create session",
 			slog.String("error", err.Error()))
 		return fmt.Errorf("%s: %w", op, err)
@@ -50,55 +138,174 @@ func (r *sessionRepo) Create(ctx context.Context, session domain.Session) error
 	return nil
 }
 
-func (r *sessionRepo) FindByID(ctx context.Context, sid string) (domain.Session, error) {
+// FindByToken looks up session by hash of the token.
+func (r *sessionRepo) FindByToken(ctx context.Context, token string) (domain.Session, error) {
+	const op = "repository.session.findByToken"
+
+	session, err := r.findByID(ctx, domain.HashSessionToken(r.cfg.HashKey, token))
+	if err != nil {
+		if r.cfg.LegacyIDLookup && errors.Is(err, apperrors.ErrorSessionNotFound) {
+			session, err = r.migrateLegacy(ctx, token)
+			if err != nil {
+				return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+			}
+			return session, nil
+		}
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	session.Token = token
+	return session, nil
+}
+
+// migrateLegacy looks up session stored with raw token as id
+// and stores it again under hashed id with a public handle.
+func (r *sessionRepo) migrateLegacy(ctx context.Context, token string) (domain.Session, error) {
+	const op = "repository.session.migrateLegacy"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	legacy, err := r.findByID(ctx, token)
+	if err != nil {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	session := legacy
+	session.ID = domain.HashSessionToken(r.cfg.HashKey, token)
+	session.Token = token
+	if session.Handle == "" {
+		session.Handle = uuid.NewString()
+	}
+
+	// concurrent request may have already migrated the session
+	if err = r.insert(ctx, session); err != nil && !errors.Is(err, apperrors.ErrorSessionAlreadyExists) {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err = r.mongo.DeleteOne(ctx, bson.M{"_id": legacy.ID}); err != nil {
+		l.Warn("can't delete legacy session", slog.String("error", err.Error()))
+	}
+
+	l.Info("legacy session migrated", slog.String("handle", session.Handle))
+
+	return session, nil
+}
+
+func (r *sessionRepo) findByID(ctx context.Context, sid string) (domain.Session, error) {
 	const op = "repository.session.findById"
 	l := r.log.With(slog.String(utils.Operation, op))
 
-	var session domain.Session
+	var doc storedSession
 
-	if err := r.mongo.FindOne(ctx, bson.M{"_id": sid}).Decode(&session); err != nil {
+	if err := r.mongo.FindOne(ctx, bson.M{"_id": sid}).Decode(&doc); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			l.Error("findOne: no documents found", slog.String("error", err.Error()))
-			return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+			return domain.Session{}, fmt.Errorf("%s: %w", op, apperrors.ErrorSessionNotFound)
 		}
 		l.Error("findOne: can't find session",
 			slog.String("error", err.Error()))
 		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
 	}
 
+	// the TTL monitor removes expired sessions only once a minute
+	session := doc.session()
+	if session.Expired() {
+		l.Warn("session is expired", slog.String("handle", session.Handle))
+		return domain.Session{}, fmt.Errorf("%s: %w", op, apperrors.ErrorSessionNotFound)
+	}
+
 	l.Debug("find session from mongodb",
-		slog.Any("session", session),
+		slog.String("handle", session.Handle),
 	)
 
 	return session, nil
 }
 
-func (r *sessionRepo) FindAll(ctx context.Context, aid string) ([]domain.Session, error) {
+// FindByHandle returns session with given public handle only if it belongs to account with given id.
+func (r *sessionRepo) FindByHandle(ctx context.Context, aid, handle string) (domain.Session, error) {
+	const op = "repository.session.findByHandle"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	var doc storedSession
+
+	if err := r.mongo.FindOne(ctx, bson.M{"accountId": aid, "handle": handle}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			l.Warn("findOne: no documents found", slog.String("error", err.Error()))
+			return domain.Session{}, fmt.Errorf("%s: %w", op, apperrors.ErrorSessionNotFound)
+		}
+		l.Error("findOne: can't find session",
+			slog.String("error", err.Error()))
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	session := doc.session()
+	if session.Expired() {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, apperrors.ErrorSessionNotFound)
+	}
+	return session, nil
+}
+
+// _sessionSortFields maps allowed sort keys to document fields.
+var _sessionSortFields = map[string]string{
+	"createdAt": "createdAt",
+	"expiresAt": "expiresAt",
+}
+
+// FindAll returns a page of account sessions and total number of account sessions.
+func (r *sessionRepo) FindAll(ctx context.Context, aid string, p domain.Pagination) ([]domain.Session, int64, error) {
 	const op = "repository.session.findAll"
 	l := r.log.With(slog.String(utils.Operation, op))
 
-	cursor, err := r.mongo.Find(ctx, bson.M{"accountId": bson.M{"$eq": aid}})
+	filter := bson.M{"accountId": bson.M{"$eq": aid}}
+
+	total, err := r.mongo.CountDocuments(ctx, filter)
+	if err != nil {
+		l.Error("r.mongo.CountDocuments: can't count sessions",
+			slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	sortField, ok := _sessionSortFields[p.SortBy]
+	if !ok {
+		sortField = "createdAt"
+	}
+	order := 1
+	if p.SortDesc {
+		order = -1
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: sortField, Value: order}, {Key: "_id", Value: 1}}).
+		SetSkip(int64(p.Offset())).
+		SetLimit(int64(p.PerPage))
+
+	cursor, err := r.mongo.Find(ctx, filter, opts)
 	if err != nil {
 		l.Error("r.mongo.FindAll: can't find sessions",
 			slog.String("error", err.Error()))
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	var sessions []domain.Session
+	docs := make([]storedSession, 0, p.PerPage)
 
-	if err = cursor.All(ctx, &sessions); err != nil {
+	if err = cursor.All(ctx, &docs); err != nil {
 		l.Error("cursor.All: can't find sessions",
 			slog.String("error", err.Error()))
-		return sessions, fmt.Errorf("%s: %w", op, err)
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
 	}
-	return sessions, nil
+
+	sessions := make([]domain.Session, 0, len(docs))
+	for _, d := range docs {
+		sessions = append(sessions, d.session())
+	}
+	return sessions, total, nil
 }
 
-func (r *sessionRepo) Delete(ctx context.Context, sid string) error {
+// Delete removes session with given handle only if it belongs to account with given id.
+func (r *sessionRepo) Delete(ctx context.Context, aid, handle string) error {
 	const op = "repository.session.Delete"
 	l := r.log.With(slog.String(utils.Operation, op))
 
-	res, err := r.mongo.DeleteOne(ctx, bson.M{"_id": sid})
+	res, err := r.mongo.DeleteOne(ctx, bson.M{"accountId": aid, "handle": handle})
 	if err != nil {
 		l.Error("r.deleteOne",
 			slog.String("error", err.Error()))
@@ -106,16 +313,21 @@ func (r *sessionRepo) Delete(ctx context.Context, sid string) error {
 	}
 
 	l.Debug("deleted document", slog.Int64("count", res.DeletedCount))
+
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("%s: %w", op, apperrors.ErrorSessionNotFound)
+	}
 	return nil
 }
 
-func (r *sessionRepo) DeleteAll(ctx context.Context, aid, currSid string) error {
+// DeleteAll removes all sessions of account except the session with given handle.
+func (r *sessionRepo) DeleteAll(ctx context.Context, aid, exceptHandle string) error {
 	const op = "repository.session.deleteAll"
 	l := r.log.With(slog.String(utils.Operation, op))
 
 	_, err := r.mongo.DeleteMany(ctx,
 		bson.M{
-			"_id":       bson.M{"$ne": currSid},
+			"handle":    bson.M{"$ne": exceptHandle},
 			"accountId": aid,
 		})
 	if err != nil {
@@ -125,3 +337,79 @@ func (r *sessionRepo) DeleteAll(ctx context.Context, aid, currSid string) error
 	}
 	return nil
 }
+
+// AccountIDs returns up to limit distinct ids of accounts having sessions,
+// greater than afterAID in ascending order.
+func (r *sessionRepo) AccountIDs(ctx context.Context, afterAID string, limit int) ([]string, error) {
+	const op = "repository.session.accountIDs"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"accountId": bson.M{"$gt": afterAID}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$accountId"}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		{{Key: "$limit", Value: limit}},
+	}
+
+	cursor, err := r.mongo.Aggregate(ctx, pipeline)
+	if err != nil {
+		l.Error("r.mongo.Aggregate: can't group sessions",
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var groups []struct {
+		AccountID string `bson:"_id"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		l.Error("cursor.All: can't group sessions",
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	ids := make([]string, 0, len(groups))
+	for _, g := range groups {
+		ids = append(ids, g.AccountID)
+	}
+	return ids, nil
+}
+
+// Rotate stores metadata of session with oldID under id of session s and deletes the old session.
+// The new session is inserted first, so if anything fails the old id stays valid and the client
+// keeps its session. Only one of concurrent rotations of the same session deletes the old one,
+// the others remove their copies and get ErrorSessionNotFound.
+func (r *sessionRepo) Rotate(ctx context.Context, oldID string, s domain.Session) (domain.Session, error) {
+	const op = "repository.session.rotate"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	old, err := r.findByID(ctx, oldID)
+	if err != nil {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rotated := old
+	rotated.ID = s.ID
+	rotated.Token = s.Token
+
+	if err = r.insert(ctx, rotated); err != nil {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := r.mongo.DeleteOne(ctx, bson.M{"_id": oldID})
+	if err == nil && res.DeletedCount == 0 {
+		l.Warn("r.mongo.DeleteOne: session is rotated concurrently")
+		err = apperrors.ErrorSessionNotFound
+	}
+	if err != nil {
+		if _, delErr := r.mongo.DeleteOne(ctx, bson.M{"_id": rotated.ID}); delErr != nil {
+			l.Error("r.mongo.DeleteOne: can't remove rotated session",
+				slog.String("error", delErr.Error()))
+		}
+		if !errors.Is(err, apperrors.ErrorSessionNotFound) {
+			l.Error("r.mongo.DeleteOne: can't delete old session", slog.String("error", err.Error()))
+		}
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return rotated, nil
+}
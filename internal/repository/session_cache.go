@@ -0,0 +1,333 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/utils"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SessionCacheBus delivers cache invalidations to other instances.
+type SessionCacheBus interface {
+	Publish(ctx context.Context, payload []byte) error
+	// Listen calls fn for every received payload until ctx is done.
+	Listen(ctx context.Context, fn func(payload []byte)) error
+}
+
+// SessionCacheStats -.
+type SessionCacheStats struct {
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`
+	Invalidations uint64 `json:"invalidations"`
+	Size          int    `json:"size"`
+}
+
+type cacheEntry struct {
+	token     string
+	session   domain.Session
+	expiresAt time.Time
+}
+
+// invalidation describes sessions to be removed from the cache.
+type invalidation struct {
+	AccountID string `json:"a"`
+	// Handle is a handle of the removed session, all sessions of the account are removed if empty.
+	Handle       string `json:"h,omitempty"`
+	ExceptHandle string `json:"e,omitempty"`
+}
+
+// sessionCache is a bounded LRU cache of sessions found by token in front of SessionRepo.
+type sessionCache struct {
+	log *slog.Logger
+
+	// methods which are not overridden are passed through
+	SessionStore
+	bus SessionCacheBus
+
+	size int
+	ttl  time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*list.Element
+	lru       *list.List
+	byAccount map[string]map[string]struct{}
+	// gen is incremented by every invalidation, sessions looked up before it aren't cached.
+	gen uint64
+
+	hits, misses, evictions, invalidations atomic.Uint64
+}
+
+// SessionStore is a session repository wrapped by the cache, it mirrors service.SessionRepo.
+type SessionStore interface {
+	Create(ctx context.Context, session domain.Session) (domain.Session, error)
+	FindByToken(ctx context.Context, token string) (domain.Session, error)
+	FindByHandle(ctx context.Context, aid, handle string) (domain.Session, error)
+	FindAll(ctx context.Context, aid string, p domain.Pagination) ([]domain.Session, int64, error)
+	Delete(ctx context.Context, aid, handle string) error
+	DeleteAll(ctx context.Context, aid, exceptHandle string) error
+	Rotate(ctx context.Context, oldID string, s domain.Session) (domain.Session, error)
+	AccountIDs(ctx context.Context, afterAID string, limit int) ([]string, error)
+}
+
+// NewSessionCache wraps repo with the cache of given size, entries live no longer than ttl.
+// bus is optional, if set invalidations are published to other instances and received from them
+// until ctx is done.
+func NewSessionCache(
+	ctx context.Context,
+	log *slog.Logger,
+	repo SessionStore,
+	size int,
+	ttl time.Duration,
+	bus SessionCacheBus) *sessionCache {
+
+	c := &sessionCache{
+		log:          log,
+		SessionStore: repo,
+		bus:          bus,
+		size:         size,
+		ttl:          ttl,
+		entries:      make(map[string]*list.Element, size),
+		lru:          list.New(),
+		byAccount:    make(map[string]map[string]struct{}),
+	}
+
+	if bus != nil {
+		go c.listen(ctx)
+	}
+
+	return c
+}
+
+func (c *sessionCache) listen(ctx context.Context) {
+	const op = "repository.sessionCache.listen"
+	l := c.log.With(slog.String(utils.Operation, op))
+
+	err := c.bus.Listen(ctx, func(payload []byte) {
+		var inv invalidation
+		if err := json.Unmarshal(payload, &inv); err != nil {
+			l.Error("can't unmarshal invalidation", slog.String("error", err.Error()))
+			return
+		}
+		c.invalidate(inv)
+	})
+	if err != nil && ctx.Err() == nil {
+		l.Error("cache invalidation listener stopped", slog.String("error", err.Error()))
+	}
+}
+
+// FindByToken returns cached session or looks it up in the underlying repo.
+func (c *sessionCache) FindByToken(ctx context.Context, token string) (domain.Session, error) {
+	if s, ok := c.get(token); ok {
+		c.hits.Add(1)
+		return s, nil
+	}
+	c.misses.Add(1)
+
+	gen := c.generation()
+
+	s, err := c.SessionStore.FindByToken(ctx, token)
+	if err != nil {
+		return domain.Session{}, err
+	}
+
+	c.put(token, s, gen)
+	return s, nil
+}
+
+// Delete deletes session from the underlying repo before invalidation, lookups which raced
+// with the deletion may have read the session but don't cache it, since the generation has changed.
+func (c *sessionCache) Delete(ctx context.Context, aid, handle string) error {
+	err := c.SessionStore.Delete(ctx, aid, handle)
+	c.invalidateAll(ctx, invalidation{AccountID: aid, Handle: handle})
+
+	return err
+}
+
+func (c *sessionCache) DeleteAll(ctx context.Context, aid, exceptHandle string) error {
+	err := c.SessionStore.DeleteAll(ctx, aid, exceptHandle)
+	c.invalidateAll(ctx, invalidation{AccountID: aid, ExceptHandle: exceptHandle})
+
+	return err
+}
+
+func (c *sessionCache) Rotate(ctx context.Context, oldID string, s domain.Session) (domain.Session, error) {
+	rotated, err := c.SessionStore.Rotate(ctx, oldID, s)
+	c.invalidateAll(ctx, invalidation{AccountID: s.AccountID, Handle: s.Handle})
+
+	return rotated, err
+}
+
+// Stats returns cache counters.
+func (c *sessionCache) Stats() SessionCacheStats {
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+
+	return SessionCacheStats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Evictions:     c.evictions.Load(),
+		Invalidations: c.invalidations.Load(),
+		Size:          size,
+	}
+}
+
+// invalidateAll invalidates local entries and publishes invalidation to other instances.
+func (c *sessionCache) invalidateAll(ctx context.Context, inv invalidation) {
+	const op = "repository.sessionCache.invalidateAll"
+
+	c.invalidate(inv)
+
+	if c.bus == nil {
+		return
+	}
+
+	payload, err := json.Marshal(inv)
+	if err == nil {
+		err = c.bus.Publish(ctx, payload)
+	}
+	if err != nil {
+		// other instances drop the entries when ttl expires
+		c.log.Error("can't publish cache invalidation",
+			slog.String(utils.Operation, op),
+			slog.String("error", err.Error()))
+	}
+}
+
+func (c *sessionCache) get(token string) (domain.Session, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[token]
+	if !ok {
+		return domain.Session{}, false
+	}
+
+	e := el.Value.(*cacheEntry)
+	if time.Now().After(e.expiresAt) {
+		c.remove(el)
+		return domain.Session{}, false
+	}
+
+	c.lru.MoveToFront(el)
+	return e.session, true
+}
+
+func (c *sessionCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.gen
+}
+
+// put caches the session unless an invalidation happened since generation gen.
+func (c *sessionCache) put(token string, s domain.Session, gen uint64) {
+	expiresAt := time.Now().Add(c.ttl)
+	if sessionExp := time.Unix(s.ExpiresAt, 0); sessionExp.Before(expiresAt) {
+		expiresAt = sessionExp
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.gen != gen {
+		return
+	}
+
+	if el, ok := c.entries[token]; ok {
+		c.remove(el)
+	}
+
+	c.entries[token] = c.lru.PushFront(&cacheEntry{token: token, session: s, expiresAt: expiresAt})
+	if c.byAccount[s.AccountID] == nil {
+		c.byAccount[s.AccountID] = make(map[string]struct{})
+	}
+	c.byAccount[s.AccountID][token] = struct{}{}
+
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+		c.evictions.Add(1)
+	}
+}
+
+func (c *sessionCache) invalidate(inv invalidation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+
+	for token := range c.byAccount[inv.AccountID] {
+		el := c.entries[token]
+		h := el.Value.(*cacheEntry).session.Handle
+
+		if (inv.Handle != "" && h != inv.Handle) || (inv.ExceptHandle != "" && h == inv.ExceptHandle) {
+			continue
+		}
+
+		c.remove(el)
+		c.invalidations.Add(1)
+	}
+}
+
+// remove deletes entry, must be called with mu held.
+func (c *sessionCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.token)
+
+	tokens := c.byAccount[e.session.AccountID]
+	delete(tokens, e.token)
+	if len(tokens) == 0 {
+		delete(c.byAccount, e.session.AccountID)
+	}
+}
+
+// redisCacheBus delivers cache invalidations through redis pub/sub channel.
+type redisCacheBus struct {
+	client  *redis.Client
+	channel string
+}
+
+func NewRedisCacheBus(client *redis.Client, channel string) *redisCacheBus {
+	return &redisCacheBus{client: client, channel: channel}
+}
+
+func (b *redisCacheBus) Publish(ctx context.Context, payload []byte) error {
+	const op = "repository.redisCacheBus.publish"
+
+	if err := b.client.Publish(ctx, b.channel, payload).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (b *redisCacheBus) Listen(ctx context.Context, fn func(payload []byte)) error {
+	const op = "repository.redisCacheBus.listen"
+
+	pubsub := b.client.Subscribe(ctx, b.channel)
+	defer pubsub.Close()
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			fn([]byte(msg.Payload))
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
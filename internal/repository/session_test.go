@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-authentication/config"
+	"go-authentication/internal/apperrors"
+	"go-authentication/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func newTestSessionRepo(mt *mtest.T) *sessionRepo {
+	return NewSessionRepo(mt.DB, slog.New(slog.NewTextHandler(io.Discard, nil)), config.Session{HashKey: "test"})
+}
+
+func sessionDoc(s domain.Session, expiresAt any) bson.D {
+	return bson.D{
+		{Key: "_id", Value: s.ID},
+		{Key: "handle", Value: s.Handle},
+		{Key: "accountId", Value: s.AccountID},
+		{Key: "provider", Value: s.Provider},
+		{Key: "expiresAt", Value: expiresAt},
+		{Key: "createdAt", Value: s.CreatedAt},
+	}
+}
+
+func TestSessionRepoEnsureIndexes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("expires at expiresAt", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 27, Name: "IndexNotFound", Message: "index not found"}),
+			mtest.CreateSuccessResponse(),
+		)
+
+		if err := newTestSessionRepo(mt).EnsureIndexes(context.Background()); err != nil {
+			t.Fatalf("EnsureIndexes() error = %v", err)
+		}
+
+		var create bson.Raw
+		for _, e := range mt.GetAllStartedEvents() {
+			if e.CommandName == "createIndexes" {
+				create = e.Command
+			}
+		}
+		if create == nil {
+			t.Fatal("indexes are not created")
+		}
+
+		indexes, _ := create.Lookup("indexes").Array().Values()
+		ttl := indexes[0].Document()
+		if key := ttl.Lookup("key").Document().Index(0).Key(); key != "expiresAt" {
+			t.Errorf("TTL index key = %s, want expiresAt", key)
+		}
+		if after, ok := ttl.Lookup("expireAfterSeconds").AsInt64OK(); !ok || after != 0 {
+			t.Errorf("expireAfterSeconds = %v, want 0", ttl.Lookup("expireAfterSeconds"))
+		}
+	})
+}
+
+func TestSessionRepoCreatesSessionsOfAnyTTL(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("normal and impersonation", func(mt *mtest.T) {
+		r := newTestSessionRepo(mt)
+
+		normal, err := domain.NewSession("test", "a", "email", "ua", "203.0.113.7", 24*time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		impersonation, err := domain.NewSession("test", "a", domain.ProviderImpersonation, "ua", "203.0.113.7", 15*time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		impersonation.ImpersonatorID = "admin"
+
+		for _, s := range []domain.Session{normal, impersonation} {
+			mt.AddMockResponses(mtest.CreateSuccessResponse())
+			if _, err = r.Create(context.Background(), s); err != nil {
+				t.Fatalf("Create(%s) error = %v", s.Provider, err)
+			}
+		}
+
+		events := mt.GetAllStartedEvents()
+		if len(events) != 2 {
+			t.Fatalf("%d commands sent, want 2 inserts", len(events))
+		}
+		for i, s := range []domain.Session{normal, impersonation} {
+			if events[i].CommandName != "insert" {
+				t.Fatalf("command %d is %s, want insert", i, events[i].CommandName)
+			}
+
+			doc := events[i].Command.Lookup("documents").Array().Index(0).Value().Document()
+			exp := doc.Lookup("expiresAt")
+			if exp.Type != bsontype.DateTime {
+				t.Fatalf("%s: expiresAt is %s, want date", s.Provider, exp.Type)
+			}
+			if got := exp.Time().Unix(); got != s.ExpiresAt {
+				t.Errorf("%s: expiresAt = %d, want %d", s.Provider, got, s.ExpiresAt)
+			}
+		}
+	})
+}
+
+func TestSessionRepoFindByToken(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	s, err := domain.NewSession("test", "a", domain.ProviderImpersonation, "ua", "203.0.113.7", 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := "test.session"
+
+	tests := []struct {
+		name      string
+		expiresAt any
+		wantErr   error
+	}{
+		{"valid", time.Unix(s.ExpiresAt, 0), nil},
+		{"legacy unix time", s.ExpiresAt, nil},
+		{"expired", time.Now().Add(-time.Second), apperrors.ErrorSessionNotFound},
+		{"expired legacy unix time", time.Now().Add(-time.Second).Unix(), apperrors.ErrorSessionNotFound},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, sessionDoc(s, tt.expiresAt)))
+
+			got, err := newTestSessionRepo(mt).FindByToken(context.Background(), s.Token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("FindByToken() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (got.Handle != s.Handle || got.ExpiresAt != s.ExpiresAt) {
+				t.Errorf("FindByToken() = %+v, want handle %s expiring at %d", got, s.Handle, s.ExpiresAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"go-authentication/internal/apperrors"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/postgres"
+	"go-authentication/pkg/utils"
+	"log/slog"
+	"time"
+)
+
+const (
+	_webhookTable         = "webhooks"
+	_webhookDeliveryTable = "webhook_deliveries"
+)
+
+type webhookRepo struct {
+	log *slog.Logger
+	pg  *postgres.Postgres
+}
+
+func NewWebhookRepo(log *slog.Logger, db *postgres.Postgres) *webhookRepo {
+	return &webhookRepo{log: log, pg: db}
+}
+
+// Create stores the webhook and returns it with id and creation time.
+func (r *webhookRepo) Create(ctx context.Context, w domain.Webhook) (domain.Webhook, error) {
+	const op = "repository.webhookRepo.Create"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Insert(_webhookTable).
+		Columns("url", "secret", "events", "active").
+		Values(w.URL, w.Secret, w.Events, w.Active).
+		Suffix("RETURNING id, created_at, updated_at").
+		ToSql()
+	if err != nil {
+		l.Error("pg.builder: bad insert query", slog.String("error", err.Error()))
+		return domain.Webhook{}, fmt.Errorf("%s : %w", op, err)
+	}
+
+	if err = r.pg.DB(ctx).QueryRow(ctx, sql, args...).Scan(&w.ID, &w.CreatedAt, &w.UpdatedAt); err != nil {
+		l.Error("queryrow error", slog.String("error", err.Error()))
+		return domain.Webhook{}, fmt.Errorf("%s : %w", op, err)
+	}
+	return w, nil
+}
+
+// FindAll ...
+func (r *webhookRepo) FindAll(ctx context.Context) ([]domain.Webhook, error) {
+	const op = "repository.webhookRepo.FindAll"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Select("id", "url", "secret", "events", "active", "created_at", "updated_at").
+		From(_webhookTable).
+		OrderBy("created_at").
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad select query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+
+	rows, err := r.pg.DB(ctx).Query(ctx, sql, args...)
+	if err != nil {
+		l.Error("db.query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+	defer rows.Close()
+
+	var webhooks []domain.Webhook
+	for rows.Next() {
+		var w domain.Webhook
+		if err = rows.Scan(&w.ID, &w.URL, &w.Secret, &w.Events, &w.Active, &w.CreatedAt, &w.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("%s : %w", op, err)
+		}
+		webhooks = append(webhooks, w)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+
+	return webhooks, nil
+}
+
+// FindByID ...
+func (r *webhookRepo) FindByID(ctx context.Context, id string) (domain.Webhook, error) {
+	const op = "repository.webhookRepo.FindByID"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Select("url", "secret", "events", "active", "created_at", "updated_at").
+		From(_webhookTable).
+		Where(squirrel.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad select by id query", slog.String("error", err.Error()))
+		return domain.Webhook{}, fmt.Errorf("%s : %w", op, err)
+	}
+
+	w := domain.Webhook{ID: id}
+	if err = r.pg.DB(ctx).QueryRow(ctx, sql, args...).Scan(
+		&w.URL, &w.Secret, &w.Events, &w.Active, &w.CreatedAt, &w.UpdatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.Webhook{}, fmt.Errorf("%s: %w", op, apperrors.ErrorWebhookNotFound)
+		}
+		l.Error("bad queryRow or scan", slog.String("error", err.Error()))
+		return domain.Webhook{}, fmt.Errorf("%s : %w", op, err)
+	}
+	return w, nil
+}
+
+// Delete deletes the webhook with its deliveries.
+func (r *webhookRepo) Delete(ctx context.Context, id string) error {
+	const op = "repository.webhookRepo.Delete"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Delete(_webhookTable).
+		Where(squirrel.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad delete query", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	ct, err := r.pg.DB(ctx).Exec(ctx, sql, args...)
+	if err != nil {
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	if ct.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, apperrors.ErrorWebhookNotFound)
+	}
+	return nil
+}
+
+// Enqueue queues the event for every active webhook subscribed to it,
+// the event queued again is ignored.
+func (r *webhookRepo) Enqueue(ctx context.Context, e domain.Event) error {
+	const op = "repository.webhookRepo.Enqueue"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	p := domain.NewWebhookPayload(e)
+
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	subscribed := r.pg.Builder.
+		Select("id").
+		Column("?::uuid", p.ID).
+		Column("?", p.Type).
+		Column("?::jsonb", payload).
+		From(_webhookTable).
+		Where(squirrel.Expr("active AND (? = ANY(events) OR ? = ANY(events))", p.Type, domain.WebhookAllEvents))
+
+	sql, args, err := r.pg.Builder.
+		Insert(_webhookDeliveryTable).
+		Columns("webhook_id", "event_id", "event_type", "payload").
+		Select(subscribed).
+		Suffix("ON CONFLICT (webhook_id, event_id) DO NOTHING").
+		ToSql()
+	if err != nil {
+		l.Error("pg.builder: bad insert query", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	if _, err = r.pg.DB(ctx).Exec(ctx, sql, args...); err != nil {
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	return nil
+}
+
+// _claimDeliveries takes due deliveries and postpones them by the lease, so other instances
+// skip them while they are being sent, a delivery of a crashed instance is retried after the lease.
+const _claimDeliveries = `
+UPDATE webhook_deliveries d
+SET attempts = d.attempts + 1, next_attempt_at = current_timestamp + $2 * interval '1 millisecond'
+FROM (SELECT id FROM webhook_deliveries
+      WHERE status = 'pending' AND next_attempt_at <= current_timestamp
+      ORDER BY next_attempt_at
+      LIMIT $1 FOR UPDATE SKIP LOCKED) due, webhooks w
+WHERE d.id = due.id AND w.id = d.webhook_id
+RETURNING d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.attempts, d.created_at, w.url, w.secret`
+
+// ClaimDue returns up to limit due deliveries with url and secret of their webhooks,
+// attempts of the returned deliveries are incremented.
+func (r *webhookRepo) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]domain.WebhookDelivery, error) {
+	const op = "repository.webhookRepo.ClaimDue"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	rows, err := r.pg.DB(ctx).Query(ctx, _claimDeliveries, limit, lease.Milliseconds())
+	if err != nil {
+		l.Error("db.query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+	defer rows.Close()
+
+	var deliveries []domain.WebhookDelivery
+	for rows.Next() {
+		d := domain.WebhookDelivery{Status: domain.WebhookDeliveryPending}
+		if err = rows.Scan(
+			&d.ID,
+			&d.WebhookID,
+			&d.EventID,
+			&d.EventType,
+			&d.Payload,
+			&d.Attempts,
+			&d.CreatedAt,
+			&d.URL,
+			&d.Secret,
+		); err != nil {
+			return nil, fmt.Errorf("%s : %w", op, err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+
+	return deliveries, nil
+}
+
+// MarkDelivered ...
+func (r *webhookRepo) MarkDelivered(ctx context.Context, id int64) error {
+	const op = "repository.webhookRepo.MarkDelivered"
+
+	err := r.updateDelivery(ctx, id, map[string]any{
+		"status":       domain.WebhookDeliveryDelivered,
+		"delivered_at": squirrel.Expr("current_timestamp"),
+		"last_error":   "",
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Retry schedules the next attempt of the failed delivery.
+func (r *webhookRepo) Retry(ctx context.Context, id int64, next time.Time, lastErr string) error {
+	const op = "repository.webhookRepo.Retry"
+
+	if err := r.updateDelivery(ctx, id, map[string]any{"next_attempt_at": next, "last_error": lastErr}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// MarkFailed stops retries of the delivery.
+func (r *webhookRepo) MarkFailed(ctx context.Context, id int64, lastErr string) error {
+	const op = "repository.webhookRepo.MarkFailed"
+
+	err := r.updateDelivery(ctx, id, map[string]any{"status": domain.WebhookDeliveryFailed, "last_error": lastErr})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (r *webhookRepo) updateDelivery(ctx context.Context, id int64, columns map[string]any) error {
+	l := r.log.With(slog.String(utils.Operation, "repository.webhookRepo.updateDelivery"))
+
+	sql, args, err := r.pg.Builder.
+		Update(_webhookDeliveryTable).
+		SetMap(columns).
+		Where(squirrel.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad update query", slog.String("error", err.Error()))
+		return err
+	}
+
+	if _, err = r.pg.DB(ctx).Exec(ctx, sql, args...); err != nil {
+		l.Error("db.exec", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// FindDeliveries returns a page of deliveries of the webhook, newest first, and total number of them.
+func (r *webhookRepo) FindDeliveries(ctx context.Context, webhookID string, p domain.Pagination) ([]domain.WebhookDelivery, int64, error) {
+	const op = "repository.webhookRepo.FindDeliveries"
+	l := r.log.With(slog.String(utils.Operation, op))
+
+	sql, args, err := r.pg.Builder.
+		Select("count(*)").
+		From(_webhookDeliveryTable).
+		Where(squirrel.Eq{"webhook_id": webhookID}).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad count query", slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s : %w", op, err)
+	}
+
+	var total int64
+	if err = r.pg.DB(ctx).QueryRow(ctx, sql, args...).Scan(&total); err != nil {
+		l.Error("bad queryRow or scan", slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s : %w", op, err)
+	}
+
+	sql, args, err = r.pg.Builder.
+		Select("id", "event_id", "event_type", "status", "attempts", "next_attempt_at", "last_error",
+			"created_at", "delivered_at").
+		From(_webhookDeliveryTable).
+		Where(squirrel.Eq{"webhook_id": webhookID}).
+		OrderBy("id desc").
+		Limit(uint64(p.PerPage)).
+		Offset(uint64(p.Offset())).
+		ToSql()
+	if err != nil {
+		l.Error("builder - bad select query", slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s : %w", op, err)
+	}
+
+	rows, err := r.pg.DB(ctx).Query(ctx, sql, args...)
+	if err != nil {
+		l.Error("db.query", slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s : %w", op, err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]domain.WebhookDelivery, 0, p.PerPage)
+	for rows.Next() {
+		d := domain.WebhookDelivery{WebhookID: webhookID}
+		if err = rows.Scan(
+			&d.ID,
+			&d.EventID,
+			&d.EventType,
+			&d.Status,
+			&d.Attempts,
+			&d.NextAttemptAt,
+			&d.LastError,
+			&d.CreatedAt,
+			&d.DeliveredAt,
+		); err != nil {
+			return nil, 0, fmt.Errorf("%s : %w", op, err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%s : %w", op, err)
+	}
+
+	return deliveries, total, nil
+}
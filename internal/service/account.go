@@ -2,47 +2,145 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"go-authentication/config"
+	"go-authentication/internal/apperrors"
 	"go-authentication/internal/domain"
+	"go-authentication/pkg/passpolicy"
+	"go-authentication/pkg/password"
 	"go-authentication/pkg/utils"
 	"log/slog"
+	"time"
 )
 
+// _notifyTimeout limits time of sending a notification in background.
+const _notifyTimeout = 30 * time.Second
+
 type AccountService struct {
 	cfg *config.Config
 	log *slog.Logger
 
-	repo    AccountRepo
-	session SessionRepo
+	repo     AccountRepo
+	session  SessionRepo
+	events   EventBroker
+	notifier AccountNotifier
+	hasher   *password.Hasher
+	guard    *loginGuard
+	policy   passpolicy.Policy
+	history  PasswordHistoryRepo
+	roles    RoleRepo
+	audit    auditor
+	outbox   OutboxRepo
+	tokens   AccountTokenRepo
+	remember RememberTokenRepo
+	tx       TxManager
 }
 
-func NewAccountService(cfg *config.Config, log *slog.Logger, repo AccountRepo, sess SessionRepo) *AccountService {
+func NewAccountService(
+	cfg *config.Config,
+	log *slog.Logger,
+	repo AccountRepo,
+	sess SessionRepo,
+	events EventBroker,
+	notifier AccountNotifier,
+	hasher *password.Hasher,
+	attempts LoginAttemptStore,
+	policy passpolicy.Policy,
+	history PasswordHistoryRepo,
+	roles RoleRepo,
+	audit AuditRepo,
+	outbox OutboxRepo,
+	tokens AccountTokenRepo,
+	remember RememberTokenRepo,
+	tx TxManager) *AccountService {
 
-	return &AccountService{cfg: cfg, log: log, repo: repo, session: sess}
+	return &AccountService{
+		cfg:      cfg,
+		log:      log,
+		repo:     repo,
+		session:  sess,
+		events:   events,
+		notifier: notifier,
+		hasher:   hasher,
+		guard:    newLoginGuard(cfg.LoginThrottle, attempts),
+		policy:   policy,
+		history:  history,
+		roles:    roles,
+		audit:    newAuditor(log, audit),
+		outbox:   outbox,
+		tokens:   tokens,
+		remember: remember,
+		tx:       tx,
+	}
 }
 
 func (s *AccountService) Create(ctx context.Context, acc domain.Account) (string, error) {
 	const op = "service.create"
 	l := s.log.With(slog.String(utils.Operation, op))
 
-	err := acc.GenPasswordHash()
+	if err := s.checkPolicy(acc); err != nil {
+		return "", fmt.Errorf("%s : %w", op, err)
+	}
+
+	err := acc.GenPasswordHash(s.hasher)
 	if err != nil {
 		l.Error("can't gen password hash",
 			slog.String("error", err.Error()))
 		return "", fmt.Errorf("%s : %w", op, err)
 	}
 
-	aid, err := s.repo.Create(ctx, acc)
+	// the account is created only together with its default roles and account.created event
+	var aid string
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if aid, err = s.repo.Create(ctx, acc); err != nil {
+			return err
+		}
+		for _, role := range s.cfg.DefaultRoles {
+			if err = s.roles.Assign(ctx, aid, role); err != nil {
+				return fmt.Errorf("can't assign default role %s: %w", role, err)
+			}
+		}
+		return s.outbox.Add(ctx, domain.NewEvent(domain.EventAccountCreated, aid))
+	})
 	if err != nil {
+		if s.cfg.SignupConcealExisting && errors.Is(err, apperrors.ErrorAccountAlreadyExists) {
+			l.Warn("signup with existing email", slog.String("error", err.Error()))
+
+			// the notice is sent in background, so the response takes as long as for a new account
+			go s.notifyAlreadyRegistered(acc)
+			return "", nil
+		}
 		return "", fmt.Errorf("%s : %w", op, err)
 	}
 
+	s.addToHistory(ctx, aid, acc.PasswordHash)
+	s.audit.recordAction(ctx, domain.AuditAccountCreated, aid, nil, nil)
+
 	l.Info("account created successfully", slog.String("account_id", aid))
 
 	return aid, nil
 }
 
+// notifyAlreadyRegistered sends the notice to the existing account with the email of attempted signup acc,
+// it is written in the locale of the signup if the account can't be found.
+func (s *AccountService) notifyAlreadyRegistered(acc domain.Account) {
+	const op = "service.notifyAlreadyRegistered"
+
+	ctx, cancel := context.WithTimeout(context.Background(), _notifyTimeout)
+	defer cancel()
+
+	if existing, err := s.repo.FindByEmail(ctx, acc.Email); err == nil {
+		acc = existing
+	}
+
+	if err := s.notifier.AlreadyRegistered(ctx, acc); err != nil {
+		s.log.Error("can't send already registered notice",
+			slog.String(utils.Operation, op),
+			slog.String("error", err.Error()))
+	}
+}
+
 func (s *AccountService) GetByID(ctx context.Context, aid string) (domain.Account, error) {
 	const op = "service.GetByID"
 
@@ -65,12 +163,317 @@ func (s *AccountService) GetByEmail(ctx context.Context, email string) (domain.A
 	return acc, nil
 }
 
+// ChangePassword replaces password of the account after verifying the current one,
+// clients of the other sessions are notified, sid is a handle of the caller session.
+func (s *AccountService) ChangePassword(ctx context.Context, aid, sid, current, new string) error {
+	const op = "service.ChangePassword"
+	l := s.log.With(slog.String(utils.Operation, op))
+
+	acc, err := s.repo.FindByID(ctx, aid)
+	if err != nil {
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	// the current password is guessed like on login, so it is throttled with the same attempts
+	if err = s.guard.Begin(ctx, acc.Email, ""); err != nil {
+		if errors.Is(err, apperrors.ErrorTooManyLoginAttempts) {
+			s.audit.recordAction(ctx, domain.AuditPasswordChanged, aid, err, nil)
+			return fmt.Errorf("%s : %w", op, err)
+		}
+		l.Error("can't check password attempts", slog.String("error", err.Error()))
+	}
+
+	acc.Password = current
+	if err = acc.CompareHashAndPassword(s.hasher); err != nil {
+		if errors.Is(err, apperrors.ErrorAccountWrongPassword) {
+			if fErr := s.guard.Fail(ctx, acc.Email); fErr != nil {
+				l.Error("can't register failed password attempt", slog.String("error", fErr.Error()))
+			}
+		} else if cErr := s.guard.Cancel(ctx, acc.Email, ""); cErr != nil {
+			l.Error("can't cancel password attempt", slog.String("error", cErr.Error()))
+		}
+		s.audit.recordAction(ctx, domain.AuditPasswordChanged, aid, err, nil)
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	if err = s.guard.Succeed(ctx, acc.Email, ""); err != nil {
+		l.Error("can't reset password attempts", slog.String("error", err.Error()))
+	}
+
+	acc.Password = new
+	if err = s.checkPolicy(acc); err != nil {
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	if err = s.checkHistory(ctx, acc); err != nil {
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	if err = acc.GenPasswordHash(s.hasher); err != nil {
+		l.Error("can't gen password hash", slog.String("error", err.Error()))
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.UpdatePassword(ctx, aid, acc.PasswordHash); err != nil {
+			return err
+		}
+		return s.outbox.Add(ctx, domain.NewEvent(domain.EventPasswordChanged, aid))
+	})
+	s.audit.recordAction(ctx, domain.AuditPasswordChanged, aid, err, nil)
+	if err != nil {
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	s.addToHistory(ctx, aid, acc.PasswordHash)
+
+	e := domain.NewEvent(domain.EventPasswordChanged, aid)
+	e.ExceptSessionID = sid
+	if err = s.events.Publish(ctx, e); err != nil {
+		l.Error("can't publish event", slog.String("error", err.Error()))
+	}
+
+	l.Info("password changed", slog.String("account_id", aid))
+	return nil
+}
+
+// checkPolicy returns PasswordPolicyError if the account password violates the password policy.
+func (s *AccountService) checkPolicy(acc domain.Account) error {
+	if v := s.policy.Check(acc.Password, acc.Email, acc.Username); len(v) > 0 {
+		return &apperrors.PasswordPolicyError{Violations: v}
+	}
+	return nil
+}
+
+// checkHistory returns PasswordPolicyError if the account password is the current one
+// or one of the latest passwords of the account.
+func (s *AccountService) checkHistory(ctx context.Context, acc domain.Account) error {
+	const op = "service.checkHistory"
+
+	if s.cfg.HistorySize <= 0 {
+		return nil
+	}
+
+	hashes, err := s.history.FindLatest(ctx, acc.ID, s.cfg.HistorySize)
+	if err != nil {
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	// the current hash is checked too, the history may lack it for accounts created before the history
+	for _, h := range append([]string{acc.PasswordHash}, hashes...) {
+		if s.hasher.Verify(acc.Password, h) == nil {
+			return &apperrors.PasswordPolicyError{Violations: []passpolicy.Violation{{
+				Code:    passpolicy.CodeReused,
+				Message: fmt.Sprintf("password must differ from the last %d passwords", s.cfg.HistorySize),
+			}}}
+		}
+	}
+	return nil
+}
+
+// addToHistory remembers password hash of the account, failures are only logged
+// since the password is already set.
+func (s *AccountService) addToHistory(ctx context.Context, aid, hash string) {
+	const op = "service.addToHistory"
+
+	if s.cfg.HistorySize <= 0 {
+		return
+	}
+
+	if err := s.history.Add(ctx, aid, hash, s.cfg.HistorySize); err != nil {
+		s.log.Error("can't add password to history",
+			slog.String(utils.Operation, op),
+			slog.String("error", err.Error()))
+	}
+}
+
+func (s *AccountService) UpdatePasswordHash(ctx context.Context, aid, hash string) error {
+	const op = "service.UpdatePasswordHash"
+
+	if err := s.repo.UpdatePasswordHash(ctx, aid, hash); err != nil {
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	return nil
+}
+
+// StartPasswordReset forbids login to the account until its password is reset and emails the owner
+// a reset link once the token is committed. The flag is kept if the link can't be sent, so the call
+// can be safely repeated.
+func (s *AccountService) StartPasswordReset(ctx context.Context, aid string) error {
+	const op = "service.StartPasswordReset"
+
+	acc, err := s.repo.FindByID(ctx, aid)
+	if err != nil {
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	t, err := domain.NewAccountToken(s.cfg.Session.HashKey, domain.TokenPasswordReset, aid, s.cfg.PasswordResetTTL)
+	if err != nil {
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.SetPasswordResetRequired(ctx, aid, true); err != nil {
+			return err
+		}
+		return s.tokens.Create(ctx, t)
+	})
+	if err == nil {
+		err = s.notifier.PasswordReset(ctx, acc, t.Token, t.ExpiresAt)
+	}
+	s.audit.recordAction(ctx, domain.AuditPasswordResetSent, aid, err, nil)
+	if err != nil {
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	return nil
+}
+
+// ResetPassword sets new password of the account the reset token was sent to and ends all its sessions.
+// The token is used only if the password is set, so a password violating the policy can be corrected.
+func (s *AccountService) ResetPassword(ctx context.Context, token, password string) error {
+	const op = "service.ResetPassword"
+	l := s.log.With(slog.String(utils.Operation, op))
+
+	var (
+		acc domain.Account
+		// aid is set once the token resolves, attempts with invalid tokens are recorded without a target
+		aid string
+	)
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		t, err := s.tokens.Use(ctx, domain.TokenPasswordReset, domain.HashAccountToken(s.cfg.Session.HashKey, token))
+		if err != nil {
+			return err
+		}
+		aid = t.AccountID
+
+		if acc, err = s.repo.FindByID(ctx, aid); err != nil {
+			return err
+		}
+
+		acc.Password = password
+		if err = s.checkPolicy(acc); err != nil {
+			return err
+		}
+		if err = s.checkHistory(ctx, acc); err != nil {
+			return err
+		}
+		if err = acc.GenPasswordHash(s.hasher); err != nil {
+			l.Error("can't gen password hash", slog.String("error", err.Error()))
+			return err
+		}
+
+		if err = s.repo.UpdatePassword(ctx, acc.ID, acc.PasswordHash); err != nil {
+			return err
+		}
+		// links sent before are of no use anymore
+		if err = s.tokens.DeleteAll(ctx, acc.ID, domain.TokenPasswordReset); err != nil {
+			return err
+		}
+		if err = s.remember.DeleteAll(ctx, acc.ID); err != nil {
+			return err
+		}
+		return s.outbox.Add(ctx, domain.NewEvent(domain.EventPasswordChanged, acc.ID))
+	})
+	s.audit.recordAction(ctx, domain.AuditPasswordReset, aid, err, nil)
+	if err != nil {
+		return fmt.Errorf("%s : %w", op, err)
+	}
+	s.addToHistory(ctx, acc.ID, acc.PasswordHash)
+
+	// sessions might be opened by someone who knew the old password
+	if err = s.revokeSessions(ctx, acc.ID); err != nil {
+		l.Error("can't revoke sessions", slog.String("error", err.Error()))
+	}
+
+	if err = s.events.Publish(ctx, domain.NewEvent(domain.EventPasswordChanged, acc.ID)); err != nil {
+		l.Error("can't publish event", slog.String("error", err.Error()))
+	}
+
+	l.Info("password reset", slog.String("account_id", acc.ID))
+	return nil
+}
+
+// Delete deletes the account and revokes all its sessions across both stores. Sessions are revoked
+// before the account is deleted, so on failure the account is kept and the call can be safely repeated,
+// and once more after, to catch sessions opened meanwhile. Persistent login tokens are deleted with
+// the account and access tokens of missing accounts are rejected.
 func (s *AccountService) Delete(ctx context.Context, aid string) error {
 	const op = "service.Delete"
+	l := s.log.With(slog.String(utils.Operation, op))
 
-	err := s.repo.Delete(ctx, aid)
+	if err := s.revokeSessions(ctx, aid); err != nil {
+		s.audit.recordAction(ctx, domain.AuditAccountDeleted, aid, err, nil)
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.Delete(ctx, aid); err != nil {
+			return err
+		}
+		return s.outbox.Add(ctx, domain.NewEvent(domain.EventAccountDeleted, aid))
+	})
+	// the account is already deleted if the call is repeated after failed revoking of sessions
+	if errors.Is(err, apperrors.ErrorAccountNotFound) {
+		err = nil
+	}
+	s.audit.recordAction(ctx, domain.AuditAccountDeleted, aid, err, nil)
 	if err != nil {
 		return fmt.Errorf("%s : %w", op, err)
 	}
+
+	// sessions left here are removed by the orphaned sessions cleanup
+	if err = s.revokeSessions(ctx, aid); err != nil {
+		l.Error("can't revoke sessions of deleted account",
+			slog.String("account_id", aid),
+			slog.String("error", err.Error()))
+	}
+
+	if err = s.events.Publish(ctx, domain.NewEvent(domain.EventAccountDeleted, aid)); err != nil {
+		l.Error("can't publish event", slog.String("error", err.Error()))
+	}
 	return nil
 }
+
+// revokeSessions deletes all sessions of the account, retrying with backoff since deleting is idempotent.
+func (s *AccountService) revokeSessions(ctx context.Context, aid string) error {
+	const op = "service.revokeSessions"
+
+	delay := s.cfg.RevokeBackoff
+	for attempt := 1; ; attempt++ {
+		err := s.session.DeleteAll(ctx, aid, "")
+		if err == nil {
+			return nil
+		}
+		if attempt >= s.cfg.RevokeAttempts {
+			return fmt.Errorf("%s : %w", op, err)
+		}
+
+		s.log.Warn("can't revoke sessions, retrying",
+			slog.String(utils.Operation, op),
+			slog.Int("attempt", attempt),
+			slog.String("error", err.Error()))
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-ctx.Done():
+			return fmt.Errorf("%s : %w", op, ctx.Err())
+		}
+	}
+}
+
+// Activity returns a page of audit events affecting the account and total number of them.
+func (s *AccountService) Activity(ctx context.Context, aid string, p domain.Pagination) ([]domain.AuditEvent, int64, error) {
+	const op = "service.Activity"
+
+	events, total, err := s.audit.repo.FindByTarget(ctx, aid, p)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s : %w", op, err)
+	}
+
+	// the client of an admin acting on the account isn't disclosed to the owner
+	for i := range events {
+		if events[i].ByOther() {
+			events[i].IP, events[i].UserAgent = "", ""
+		}
+	}
+
+	return events, total, nil
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"go-authentication/config"
+	"go-authentication/internal/apperrors"
+	"go-authentication/internal/domain"
+	"go-authentication/internal/mailer"
+	"go-authentication/pkg/passpolicy"
+	"slices"
+	"testing"
+	"time"
+)
+
+type testAccountDeps struct {
+	accounts *fakeAccountRepo
+	sessions *fakeSessionRepo
+	audit    *fakeAuditRepo
+	outbox   *fakeOutboxWriter
+	broker   *fakeBroker
+	tokens   *fakeAccountTokenRepo
+	notifier AccountNotifier
+	tx       TxManager
+}
+
+func newTestAccountService(d testAccountDeps) *AccountService {
+	cfg := &config.Config{}
+	cfg.AccountDeletion = config.AccountDeletion{RevokeAttempts: 3, RevokeBackoff: time.Millisecond}
+	cfg.Session.HashKey = "test"
+	cfg.PasswordReset.PasswordResetTTL = time.Hour
+
+	return NewAccountService(
+		cfg, discardLogger(), d.accounts, d.sessions, d.broker, d.notifier, nil, nil, passpolicy.Policy{}, nil, nil,
+		d.audit, d.outbox, d.tokens, nil, d.tx)
+}
+
+func newTestAccountDeps(sessions *fakeSessionRepo) testAccountDeps {
+	return testAccountDeps{
+		accounts: newFakeAccountRepo(domain.Account{ID: "a"}),
+		sessions: sessions,
+		audit:    &fakeAuditRepo{},
+		outbox:   &fakeOutboxWriter{},
+		broker:   &fakeBroker{},
+		tokens:   &fakeAccountTokenRepo{},
+		tx:       fakeTx{},
+	}
+}
+
+func TestDeleteRetriesRevokingSessions(t *testing.T) {
+	sessions := newFakeSessionRepo("a")
+	sessions.failDeletes = 2
+	d := newTestAccountDeps(sessions)
+
+	if err := newTestAccountService(d).Delete(context.Background(), "a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	// two failures, the successful attempt and revoking after the account is deleted
+	if sessions.deleteCalls != 4 {
+		t.Errorf("DeleteAll called %d times, want 4", sessions.deleteCalls)
+	}
+	if !slices.Equal(d.accounts.deleted, []string{"a"}) {
+		t.Errorf("deleted accounts = %v, want [a]", d.accounts.deleted)
+	}
+	if len(d.outbox.events) != 1 || d.outbox.events[0].Type != domain.EventAccountDeleted {
+		t.Errorf("outbox events = %v", d.outbox.events)
+	}
+}
+
+func TestDeleteKeepsAccountIfSessionsAreNotRevoked(t *testing.T) {
+	sessions := newFakeSessionRepo("a")
+	sessions.failDeletes = 3
+	d := newTestAccountDeps(sessions)
+	s := newTestAccountService(d)
+
+	err := s.Delete(context.Background(), "a")
+	if !errors.Is(err, errStoreDown) {
+		t.Fatalf("Delete() = %v, want %v", err, errStoreDown)
+	}
+	if sessions.deleteCalls != 3 {
+		t.Errorf("DeleteAll called %d times, want 3", sessions.deleteCalls)
+	}
+	if len(d.accounts.deleted) != 0 || len(d.outbox.events) != 0 {
+		t.Fatal("account is deleted while its sessions are left")
+	}
+	if types := d.audit.types(); len(types) != 1 || d.audit.events[0].Result != domain.AuditResultFailure {
+		t.Errorf("audit events = %v, want failed deletion", d.audit.events)
+	}
+
+	// the call can be repeated once the store is back
+	if err = s.Delete(context.Background(), "a"); err != nil {
+		t.Fatalf("repeated Delete() error = %v", err)
+	}
+	if len(sessions.accountIDs()) != 0 || !slices.Equal(d.accounts.deleted, []string{"a"}) {
+		t.Errorf("sessions %v, deleted accounts %v", sessions.accountIDs(), d.accounts.deleted)
+	}
+}
+
+func TestDeleteOfDeletedAccountSucceeds(t *testing.T) {
+	d := newTestAccountDeps(newFakeSessionRepo())
+	d.accounts = newFakeAccountRepo()
+
+	if err := newTestAccountService(d).Delete(context.Background(), "a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+}
+
+func TestDeleteStopsRetryingWhenCanceled(t *testing.T) {
+	sessions := newFakeSessionRepo("a")
+	sessions.failDeletes = 100
+	d := newTestAccountDeps(sessions)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := newTestAccountService(d).Delete(ctx, "a"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Delete() = %v, want %v", err, context.Canceled)
+	}
+	if sessions.deleteCalls != 1 {
+		t.Errorf("DeleteAll called %d times, want 1", sessions.deleteCalls)
+	}
+}
+
+func TestStartPasswordResetSendsLinkAfterCommit(t *testing.T) {
+	m := mailer.NewMemoryMailer()
+	d := newTestAccountDeps(newFakeSessionRepo())
+	d.notifier = emailAccountNotifier{mailer: m}
+
+	if err := newTestAccountService(d).StartPasswordReset(context.Background(), "a"); err != nil {
+		t.Fatalf("StartPasswordReset() error = %v", err)
+	}
+	emails := m.Emails()
+	if len(emails) != 1 || emails[0].Template != mailer.TemplatePasswordReset {
+		t.Fatalf("emails = %v, want a reset link", emails)
+	}
+
+	// the emailed token is stored
+	hash := domain.HashAccountToken("test", emails[0].Text)
+	if _, err := d.tokens.Use(context.Background(), domain.TokenPasswordReset, hash); err != nil {
+		t.Errorf("emailed token is not stored: %v", err)
+	}
+}
+
+func TestStartPasswordResetDoesNotSendLinkIfNotCommitted(t *testing.T) {
+	m := mailer.NewMemoryMailer()
+	d := newTestAccountDeps(newFakeSessionRepo())
+	d.notifier = emailAccountNotifier{mailer: m}
+	d.tx = commitFailingTx{}
+
+	if err := newTestAccountService(d).StartPasswordReset(context.Background(), "a"); !errors.Is(err, errCommit) {
+		t.Fatalf("StartPasswordReset() error = %v, want %v", err, errCommit)
+	}
+	if emails := m.Emails(); len(emails) != 0 {
+		t.Errorf("reset link is sent for uncommitted token: %v", emails)
+	}
+	if types := d.audit.types(); len(types) != 1 || d.audit.events[0].Result != domain.AuditResultFailure {
+		t.Errorf("audit events = %v, want failed password reset", d.audit.events)
+	}
+}
+
+func TestResetPasswordWithInvalidTokenHasNoTarget(t *testing.T) {
+	d := newTestAccountDeps(newFakeSessionRepo())
+
+	err := newTestAccountService(d).ResetPassword(context.Background(), "unknown", "password")
+	if !errors.Is(err, apperrors.ErrorAccountTokenInvalid) {
+		t.Fatalf("ResetPassword() error = %v, want %v", err, apperrors.ErrorAccountTokenInvalid)
+	}
+
+	if len(d.audit.events) != 1 {
+		t.Fatalf("%d audit events, want 1", len(d.audit.events))
+	}
+	if e := d.audit.events[0]; e.Type != domain.AuditPasswordReset || e.TargetID != "" {
+		t.Errorf("audit event %s targets %q, want %s without target", e.Type, e.TargetID, domain.AuditPasswordReset)
+	}
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"go-authentication/config"
+	"go-authentication/internal/apperrors"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/utils"
+	"log/slog"
+	"time"
+)
+
+// adminService performs account management on behalf of operators,
+// every action is recorded to the audit log whether it succeeds or not.
+type adminService struct {
+	cfg *config.Config
+	log *slog.Logger
+
+	accounts AccountRepo
+	account  Account
+	roles    RoleRepo
+	session  Session
+	audit    auditor
+}
+
+func NewAdminService(
+	cfg *config.Config,
+	log *slog.Logger,
+	accounts AccountRepo,
+	account Account,
+	roles RoleRepo,
+	session Session,
+	audit AuditRepo) *adminService {
+
+	return &adminService{
+		cfg:      cfg,
+		log:      log,
+		accounts: accounts,
+		account:  account,
+		roles:    roles,
+		session:  session,
+		audit:    newAuditor(log, audit),
+	}
+}
+
+func (s *adminService) SearchAccounts(
+	ctx context.Context,
+	actor domain.Actor,
+	f domain.AccountFilter,
+	p domain.Pagination) ([]domain.Account, int64, error) {
+
+	const op = "adminservice.searchAccounts"
+
+	accounts, total, err := s.accounts.FindAll(ctx, f, p)
+
+	e := domain.NewAuditEvent(domain.AuditAdminAccountsSearched, actor, "")
+	e.Details["email"] = f.Email
+	e.Details["username"] = f.Username
+	if !f.CreatedFrom.IsZero() {
+		e.Details["createdFrom"] = f.CreatedFrom.Format(time.RFC3339)
+	}
+	if !f.CreatedTo.IsZero() {
+		e.Details["createdTo"] = f.CreatedTo.Format(time.RFC3339)
+	}
+	s.audit.record(ctx, e.WithResult(err))
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return accounts, total, nil
+}
+
+func (s *adminService) GetAccount(ctx context.Context, actor domain.Actor, aid string) (domain.Account, error) {
+	const op = "adminservice.getAccount"
+
+	acc, err := s.accounts.FindByID(ctx, aid)
+	s.audit.record(ctx, domain.NewAuditEvent(domain.AuditAdminAccountViewed, actor, aid).WithResult(err))
+
+	if err != nil {
+		return domain.Account{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return acc, nil
+}
+
+// Lock locks the account and terminates all its sessions, the account can't log in until unlocked.
+func (s *adminService) Lock(ctx context.Context, actor domain.Actor, aid string) error {
+	const op = "adminservice.lock"
+
+	err := s.accounts.SetLocked(ctx, aid, true)
+	if err == nil {
+		err = s.session.TerminateAll(ctx, aid, "")
+	}
+	s.audit.record(ctx, domain.NewAuditEvent(domain.AuditAdminAccountLocked, actor, aid).WithResult(err))
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *adminService) Unlock(ctx context.Context, actor domain.Actor, aid string) error {
+	const op = "adminservice.unlock"
+
+	err := s.accounts.SetLocked(ctx, aid, false)
+	s.audit.record(ctx, domain.NewAuditEvent(domain.AuditAdminAccountUnlocked, actor, aid).WithResult(err))
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// ForcePasswordReset forbids login until the password is reset, emails the owner a reset link
+// and terminates all sessions of the account.
+func (s *adminService) ForcePasswordReset(ctx context.Context, actor domain.Actor, aid string) error {
+	const op = "adminservice.forcePasswordReset"
+
+	err := s.account.StartPasswordReset(ctx, aid)
+	if err == nil {
+		err = s.session.TerminateAll(ctx, aid, "")
+	}
+	s.audit.record(ctx, domain.NewAuditEvent(domain.AuditAdminPasswordResetForced, actor, aid).WithResult(err))
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *adminService) Sessions(
+	ctx context.Context,
+	actor domain.Actor,
+	aid string,
+	p domain.Pagination) ([]domain.Session, int64, error) {
+
+	const op = "adminservice.sessions"
+
+	sessions, total, err := s.session.List(ctx, aid, p)
+	s.audit.record(ctx, domain.NewAuditEvent(domain.AuditAdminSessionsViewed, actor, aid).WithResult(err))
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return sessions, total, nil
+}
+
+func (s *adminService) TerminateSessions(ctx context.Context, actor domain.Actor, aid string) error {
+	const op = "adminservice.terminateSessions"
+
+	err := s.session.TerminateAll(ctx, aid, "")
+	s.audit.record(ctx, domain.NewAuditEvent(domain.AuditAdminSessionsTerminated, actor, aid).WithResult(err))
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Impersonate opens a short-lived session of the account on behalf of the actor,
+// the session is marked with the actor id so it is told apart from sessions of the account owner.
+// The actor session sid is ended, since the client replaces it by the impersonated one.
+// Locked accounts can't be impersonated.
+func (s *adminService) Impersonate(ctx context.Context, actor domain.Actor, sid, aid string) (domain.Session, error) {
+	const op = "adminservice.impersonate"
+
+	acc, err := s.accounts.FindByID(ctx, aid)
+	if err == nil && acc.LockedAt != nil {
+		err = apperrors.ErrorAccountLocked
+	}
+
+	var session domain.Session
+	if err == nil {
+		session, err = s.session.Impersonate(ctx, aid, actor.AccountID, Device{UserAgent: actor.UserAgent, IP: actor.IP})
+	}
+	if err == nil {
+		if err = s.session.Delete(ctx, actor.AccountID, sid); err != nil {
+			// the admin keeps the own session if it can't be ended
+			if delErr := s.session.Delete(ctx, aid, session.Handle); delErr != nil {
+				s.log.Error("can't delete impersonated session",
+					slog.String(utils.Operation, op),
+					slog.String("error", delErr.Error()))
+			}
+		}
+	}
+
+	e := domain.NewAuditEvent(domain.AuditAdminImpersonated, actor, aid)
+	if err == nil {
+		e.Details["sessionId"] = session.Handle
+		e.Details["expiresAt"] = time.Unix(session.ExpiresAt, 0).Format(time.RFC3339)
+	}
+	s.audit.record(ctx, e.WithResult(err))
+
+	if err != nil {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return session, nil
+}
+
+func (s *adminService) Roles(ctx context.Context, actor domain.Actor, aid string) ([]string, error) {
+	const op = "adminservice.roles"
+
+	roles, err := s.roles.FindByAccount(ctx, aid)
+	s.audit.record(ctx, domain.NewAuditEvent(domain.AuditAdminRolesViewed, actor, aid).WithResult(err))
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return roles, nil
+}
+
+func (s *adminService) AssignRole(ctx context.Context, actor domain.Actor, aid, role string) error {
+	const op = "adminservice.assignRole"
+
+	err := s.roles.Assign(ctx, aid, role)
+
+	e := domain.NewAuditEvent(domain.AuditAdminRoleAssigned, actor, aid)
+	e.Details["role"] = role
+	s.audit.record(ctx, e.WithResult(err))
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *adminService) RevokeRole(ctx context.Context, actor domain.Actor, aid, role string) error {
+	const op = "adminservice.revokeRole"
+
+	err := s.roles.Revoke(ctx, aid, role)
+
+	e := domain.NewAuditEvent(domain.AuditAdminRoleRevoked, actor, aid)
+	e.Details["role"] = role
+	s.audit.record(ctx, e.WithResult(err))
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
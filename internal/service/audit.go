@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/utils"
+	"log/slog"
+	"maps"
+)
+
+// auditor appends events to the audit log, failures are logged with the event
+// so the action is not lost completely, and never fail the audited action.
+type auditor struct {
+	log  *slog.Logger
+	repo AuditRepo
+}
+
+func newAuditor(log *slog.Logger, repo AuditRepo) auditor {
+	return auditor{log: log, repo: repo}
+}
+
+func (a auditor) record(ctx context.Context, e domain.AuditEvent) {
+	const op = "auditor.record"
+
+	if err := a.repo.Create(ctx, e); err != nil {
+		a.log.Error("can't write audit event",
+			slog.String(utils.Operation, op),
+			slog.Any("event", e),
+			slog.String("error", err.Error()))
+	}
+}
+
+// recordAction records event of the request actor affecting account targetID,
+// the result is failure if err is not nil.
+func (a auditor) recordAction(ctx context.Context, typ, targetID string, err error, details map[string]any) {
+	e := domain.NewAuditEvent(typ, domain.ActorFromContext(ctx), targetID)
+	maps.Copy(e.Details, details)
+
+	a.record(ctx, e.WithResult(err))
+}
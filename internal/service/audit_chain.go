@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"go-authentication/config"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/utils"
+	"log/slog"
+	"time"
+)
+
+// _auditVerifyBatch is a number of events read at once during verification.
+const _auditVerifyBatch = 1000
+
+// auditChainService signs the head of the audit chain periodically and verifies the chain.
+type auditChainService struct {
+	log  *slog.Logger
+	repo AuditChainRepo
+
+	key      string
+	interval time.Duration
+	// lastEventID is an id of the event signed by the last checkpoint of this instance.
+	lastEventID int64
+}
+
+func NewAuditChainService(cfg *config.Config, log *slog.Logger, repo AuditChainRepo) *auditChainService {
+	return &auditChainService{
+		log:      log,
+		repo:     repo,
+		key:      cfg.AuditChainKey,
+		interval: cfg.AuditCheckpointInterval,
+	}
+}
+
+// Run signs the chain head every checkpoint interval until ctx is canceled.
+func (s *auditChainService) Run(ctx context.Context) {
+	const op = "auditchainservice.run"
+	l := s.log.With(slog.String(utils.Operation, op))
+
+	if s.interval <= 0 {
+		l.Info("audit checkpoints are disabled")
+		return
+	}
+
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if err := s.Checkpoint(ctx); err != nil {
+				l.Error("can't checkpoint audit chain", slog.String("error", err.Error()))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Checkpoint signs the current head of the chain, nothing is done if the head is already signed.
+func (s *auditChainService) Checkpoint(ctx context.Context) error {
+	const op = "auditchainservice.checkpoint"
+
+	head, ok, err := s.repo.Head(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !ok || head.ID == s.lastEventID {
+		return nil
+	}
+
+	if err = s.repo.CreateCheckpoint(ctx, domain.NewAuditCheckpoint(s.key, head.ID, head.Hash)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	s.lastEventID = head.ID
+
+	s.log.Debug("audit chain checkpoint created",
+		slog.String(utils.Operation, op),
+		slog.Int64("event_id", head.ID))
+	return nil
+}
+
+// Verify walks the whole chain and reports the first event which breaks it.
+// Editing, deleting or reordering events breaks the links between them,
+// rebuilding or truncating the chain is detected by the signed checkpoints.
+func (s *auditChainService) Verify(ctx context.Context) (domain.AuditChainReport, error) {
+	const op = "auditchainservice.verify"
+
+	var r domain.AuditChainReport
+
+	checkpoints, err := s.repo.FindCheckpoints(ctx)
+	if err != nil {
+		return r, fmt.Errorf("%s: %w", op, err)
+	}
+
+	byEvent := make(map[int64][]domain.AuditCheckpoint, len(checkpoints))
+	for _, c := range checkpoints {
+		if !c.Valid(s.key) {
+			r.BrokenAt, r.Reason = c.EventID, fmt.Sprintf("checkpoint %d has invalid signature", c.ID)
+			return r, nil
+		}
+		byEvent[c.EventID] = append(byEvent[c.EventID], c)
+	}
+
+	var (
+		prev    string
+		afterID int64
+		chained bool
+	)
+	for {
+		events, err := s.repo.FindAfter(ctx, afterID, _auditVerifyBatch)
+		if err != nil {
+			return r, fmt.Errorf("%s: %w", op, err)
+		}
+		if len(events) == 0 {
+			break
+		}
+
+		for _, e := range events {
+			afterID = e.ID
+
+			if e.Hash == "" {
+				if chained {
+					r.BrokenAt, r.Reason = e.ID, "event is not chained"
+					return r, nil
+				}
+				// written before the chain was introduced
+				r.Unchained++
+				continue
+			}
+			chained = true
+
+			if e.PrevHash != prev {
+				r.BrokenAt, r.Reason = e.ID, "event is not linked to the previous event, events are deleted or reordered"
+				return r, nil
+			}
+
+			hash, err := e.ChainHash(prev)
+			if err != nil {
+				return r, fmt.Errorf("%s: %w", op, err)
+			}
+			if hash != e.Hash {
+				r.BrokenAt, r.Reason = e.ID, "event hash does not match its content, event is modified"
+				return r, nil
+			}
+
+			for _, c := range byEvent[e.ID] {
+				if c.Hash != e.Hash {
+					r.BrokenAt, r.Reason = e.ID, fmt.Sprintf("event hash differs from checkpoint %d, chain is rebuilt", c.ID)
+					return r, nil
+				}
+				r.Checkpoints++
+			}
+			delete(byEvent, e.ID)
+
+			prev = e.Hash
+			r.Checked++
+		}
+	}
+
+	// every signed event must be found in the chain
+	for _, c := range checkpoints {
+		if _, missing := byEvent[c.EventID]; missing {
+			r.BrokenAt, r.Reason = c.EventID, fmt.Sprintf("event signed by checkpoint %d is missing, chain is truncated", c.ID)
+			return r, nil
+		}
+	}
+
+	return r, nil
+}
@@ -2,10 +2,15 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"go-authentication/config"
+	"go-authentication/internal/apperrors"
 	"go-authentication/internal/domain"
+	"go-authentication/pkg/password"
 	"go-authentication/pkg/utils"
 	"log/slog"
+	"slices"
 )
 
 type authService struct {
@@ -13,66 +18,150 @@ type authService struct {
 	token   Token
 	account Account
 	session Session
+	devices Devices
+	guard   *loginGuard
+	hasher  *password.Hasher
+	roles   Role
+	audit   auditor
 }
 
-func NewAuthService(log *slog.Logger, token Token, account Account, session Session) *authService {
-	return &authService{log: log, token: token, account: account, session: session}
+func NewAuthService(
+	cfg *config.Config,
+	log *slog.Logger,
+	token Token,
+	account Account,
+	session Session,
+	devices Devices,
+	attempts LoginAttemptStore,
+	hasher *password.Hasher,
+	roles Role,
+	audit AuditRepo) *authService {
+
+	return &authService{
+		log:     log,
+		token:   token,
+		account: account,
+		session: session,
+		devices: devices,
+		guard:   newLoginGuard(cfg.LoginThrottle, attempts),
+		hasher:  hasher,
+		roles:   roles,
+		audit:   newAuditor(log, audit),
+	}
 }
 
 func (s *authService) EmailLogin(ctx context.Context, email, password string, d Device) (domain.Session, error) {
 	const op = "auth.emailLogin"
 	l := s.log.With(slog.String(utils.Operation, op))
 
+	if err := s.beginAttempt(ctx, email, d.IP); err != nil {
+		s.audit.recordAction(ctx, domain.AuditLoginFailed, "", err, map[string]any{"email": email})
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
 	//fetching the account
 	a, err := s.account.GetByEmail(ctx, email)
 	if err != nil {
+		if errors.Is(err, apperrors.ErrorAccountNotFound) {
+			// compare anyway, so unknown emails take as long as wrong passwords
+			s.hasher.VerifyDummy(password)
+			s.failAttempt(ctx, email)
+			s.audit.recordAction(ctx, domain.AuditLoginFailed, "", err, map[string]any{"email": email})
+		} else {
+			s.cancelAttempt(ctx, email, d.IP)
+		}
 		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
 	}
 	l.Debug("account found",
 		slog.Any("account", a))
 
 	a.Password = password
-	err = a.CompareHashAndPassword()
+	err = a.CompareHashAndPassword(s.hasher)
 	if err != nil {
 		l.Error("can't login", slog.String("error", err.Error()))
-		l.Debug("", slog.String("hashed password", a.PasswordHash))
+		s.failAttempt(ctx, email)
+		s.audit.recordAction(ctx, domain.AuditLoginFailed, a.ID, err, nil)
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err = checkAccountActive(a); err != nil {
+		l.Warn("can't login", slog.String("error", err.Error()))
+		s.cancelAttempt(ctx, email, d.IP)
+		s.audit.recordAction(ctx, domain.AuditLoginFailed, a.ID, err, nil)
 		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
 	}
+	s.rehashPassword(ctx, a)
+
+	if err = s.guard.Succeed(ctx, email, d.IP); err != nil {
+		l.Error("can't reset login attempts", slog.String("error", err.Error()))
+	}
 
 	//creating a session
 	sess, err := s.session.Create(ctx, a.ID, a.Email, d)
+	s.audit.recordAction(ctx, domain.AuditLoginSucceeded, a.ID, err, map[string]any{"sessionId": sess.Handle})
 	if err != nil {
 		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
 	}
 
+	// the login is already made, the owner can reject it once alerted
+	if err = s.devices.CheckLogin(ctx, a, sess); err != nil {
+		l.Error("can't check login device", slog.String("error", err.Error()))
+	}
+
 	return sess, nil
 }
 
-func (s *authService) Logout(ctx context.Context, sid string) error {
+func (s *authService) Logout(ctx context.Context, aid, sid string) error {
 	const op = "auth.logout"
 
-	err := s.session.Terminate(ctx, "", sid)
+	err := s.session.Delete(ctx, aid, sid)
+	s.audit.recordAction(ctx, domain.AuditLogout, aid, err, map[string]any{"sessionId": sid})
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 	return nil
 }
 
-func (s *authService) NewAccessToken(ctx context.Context, sub, password string) (string, error) {
+func (s *authService) NewAccessToken(ctx context.Context, session domain.Session, password string) (string, error) {
 	const op = "auth.AccessToken"
 
+	sub := session.AccountID
+
 	a, err := s.account.GetByID(ctx, sub)
 	if err != nil {
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
+	if err = s.beginAttempt(ctx, a.Email, ""); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
 	a.Password = password
-	err = a.CompareHashAndPassword()
+	err = a.CompareHashAndPassword(s.hasher)
+	if err != nil {
+		s.failAttempt(ctx, a.Email)
+		s.audit.recordAction(ctx, domain.AuditAccessTokenIssued, sub, err, nil)
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if err = checkAccountActive(a); err != nil {
+		s.cancelAttempt(ctx, a.Email, "")
+		s.audit.recordAction(ctx, domain.AuditAccessTokenIssued, sub, err, nil)
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	s.rehashPassword(ctx, a)
+
+	if err = s.guard.Succeed(ctx, a.Email, ""); err != nil {
+		s.log.Error("can't reset login attempts",
+			slog.String(utils.Operation, op),
+			slog.String("error", err.Error()))
+	}
+
+	roles, err := s.roles.Roles(ctx, sub)
 	if err != nil {
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	t, err := s.token.New(sub)
+	t, err := s.token.New(domain.AccessClaims{Subject: sub, Roles: roles, Impersonator: session.ImpersonatorID})
+	s.audit.recordAction(ctx, domain.AuditAccessTokenIssued, sub, err, map[string]any{"sessionId": session.Handle})
 	if err != nil {
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
@@ -80,12 +169,95 @@ func (s *authService) NewAccessToken(ctx context.Context, sub, password string)
 	return t, nil
 }
 
-func (s *authService) ParseAccessToken(ctx context.Context, token string) (string, error) {
+// ParseAccessToken returns claims of the token, tokens of deleted accounts and tokens
+// issued before roles of the account were changed are rejected.
+func (s *authService) ParseAccessToken(ctx context.Context, token string) (domain.AccessClaims, error) {
 	const op = "auth.ParseAccessToken"
 
-	aid, err := s.token.Parse(token)
+	c, err := s.token.Parse(token)
 	if err != nil {
-		return "", fmt.Errorf("%s: %w", op, err)
+		return domain.AccessClaims{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err = s.account.GetByID(ctx, c.Subject); err != nil {
+		return domain.AccessClaims{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// roles are sorted by the repo both when the token is issued and now
+	roles, err := s.roles.Roles(ctx, c.Subject)
+	if err != nil {
+		return domain.AccessClaims{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !slices.Equal(roles, c.Roles) {
+		return domain.AccessClaims{}, fmt.Errorf("%s: %w", op, apperrors.ErrRolesChanged)
+	}
+	return c, nil
+}
+
+// checkAccountActive returns error if admin locked the account or required to reset its password.
+func checkAccountActive(a domain.Account) error {
+	if a.LockedAt != nil {
+		return apperrors.ErrorAccountLocked
+	}
+	if a.PasswordResetRequired {
+		return apperrors.ErrorPasswordResetRequired
+	}
+	return nil
+}
+
+// rehashPassword upgrades hash of the verified password if it is made by
+// not preferred algorithm or with outdated parameters, failures are only logged.
+func (s *authService) rehashPassword(ctx context.Context, a domain.Account) {
+	const op = "auth.rehashPassword"
+	l := s.log.With(slog.String(utils.Operation, op))
+
+	if !s.hasher.NeedsRehash(a.PasswordHash) {
+		return
+	}
+
+	if err := a.GenPasswordHash(s.hasher); err != nil {
+		l.Error("can't gen password hash", slog.String("error", err.Error()))
+		return
+	}
+
+	if err := s.account.UpdatePasswordHash(ctx, a.ID, a.PasswordHash); err != nil {
+		l.Error("can't update password hash", slog.String("error", err.Error()))
+		return
+	}
+	l.Info("password rehashed", slog.String("account_id", a.ID))
+}
+
+// beginAttempt reserves an attempt, it returns error only if the attempt is throttled,
+// failures of the attempts store are logged and the attempt is allowed.
+func (s *authService) beginAttempt(ctx context.Context, login, ip string) error {
+	const op = "auth.beginAttempt"
+
+	err := s.guard.Begin(ctx, login, ip)
+	if err != nil && !errors.Is(err, apperrors.ErrorTooManyLoginAttempts) {
+		s.log.Error("can't check login attempts",
+			slog.String(utils.Operation, op),
+			slog.String("error", err.Error()))
+		return nil
+	}
+	return err
+}
+
+func (s *authService) failAttempt(ctx context.Context, login string) {
+	const op = "auth.failAttempt"
+
+	if err := s.guard.Fail(ctx, login); err != nil {
+		s.log.Error("can't register failed login attempt",
+			slog.String(utils.Operation, op),
+			slog.String("error", err.Error()))
+	}
+}
+
+func (s *authService) cancelAttempt(ctx context.Context, login, ip string) {
+	const op = "auth.cancelAttempt"
+
+	if err := s.guard.Cancel(ctx, login, ip); err != nil {
+		s.log.Error("can't cancel login attempt",
+			slog.String(utils.Operation, op),
+			slog.String("error", err.Error()))
 	}
-	return aid, nil
 }
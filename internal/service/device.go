@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"go-authentication/config"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/utils"
+	"log/slog"
+)
+
+// deviceService remembers devices accounts log in from, so the owner can be alerted
+// of a login from a device the account hasn't used before and reject it.
+type deviceService struct {
+	cfg *config.Config
+	log *slog.Logger
+
+	repo     DeviceRepo
+	tokens   AccountTokenRepo
+	notifier AccountNotifier
+	session  Session
+	account  Account
+	audit    auditor
+	tx       TxManager
+}
+
+func NewDeviceService(
+	cfg *config.Config,
+	log *slog.Logger,
+	repo DeviceRepo,
+	tokens AccountTokenRepo,
+	notifier AccountNotifier,
+	session Session,
+	account Account,
+	audit AuditRepo,
+	tx TxManager) *deviceService {
+
+	return &deviceService{
+		cfg:      cfg,
+		log:      log,
+		repo:     repo,
+		tokens:   tokens,
+		notifier: notifier,
+		session:  session,
+		account:  account,
+		audit:    newAuditor(log, audit),
+		tx:       tx,
+	}
+}
+
+// CheckLogin remembers the device of session s opened by account a and alerts the owner if
+// the device is new. The first login after signup is where the account signed up, so it isn't alerted,
+// while the first login of an account created before devices were remembered is.
+// The alert is sent after the device and the rejection token are committed, the device is
+// forgotten if the alert can't be sent, so the next login from it is alerted again.
+func (s *deviceService) CheckLogin(ctx context.Context, a domain.Account, sess domain.Session) error {
+	const op = "deviceservice.checkLogin"
+	l := s.log.With(slog.String(utils.Operation, op))
+
+	d := domain.NewKnownDevice(s.cfg.Session.HashKey, sess)
+
+	var t domain.AccountToken
+	alert := false
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		added, trusted, err := s.repo.Add(ctx, d)
+		if err != nil {
+			return err
+		}
+		if !added || trusted || !s.cfg.LoginAlertsEnabled {
+			return nil
+		}
+
+		t, err = domain.NewAccountToken(s.cfg.Session.HashKey, domain.TokenLoginRejection, a.ID, s.cfg.LoginRejectTTL)
+		if err != nil {
+			return err
+		}
+		t.SessionID = sess.Handle
+		t.DeviceID = d.Fingerprint
+
+		if err = s.tokens.Create(ctx, t); err != nil {
+			return err
+		}
+		alert = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !alert {
+		return nil
+	}
+
+	err = s.notifier.NewDeviceLogin(ctx, a, sess, t.Token, t.ExpiresAt)
+	s.audit.recordAction(ctx, domain.AuditNewDeviceLogin, a.ID, err,
+		map[string]any{"sessionId": sess.Handle, "deviceId": d.Fingerprint})
+	if err != nil {
+		if delErr := s.repo.Delete(ctx, a.ID, d.Fingerprint); delErr != nil {
+			l.Error("can't forget device of unsent alert", slog.String("error", delErr.Error()))
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	l.Info("login from new device",
+		slog.String("account_id", a.ID),
+		slog.String("handle", sess.Handle))
+	return nil
+}
+
+func (s *deviceService) List(ctx context.Context, aid string) ([]domain.KnownDevice, error) {
+	const op = "deviceservice.list"
+
+	devices, err := s.repo.FindAll(ctx, aid)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return devices, nil
+}
+
+// RejectLogin ends all sessions of the account the login rejection token was sent to, not only
+// the rejected one, since its password is known to someone else, forgets the device of the login
+// and starts password reset. The token is used and the device is forgotten in a transaction, sessions
+// live in another store and the reset link is emailed, so both are done after the commit.
+func (s *deviceService) RejectLogin(ctx context.Context, token string) error {
+	const op = "deviceservice.rejectLogin"
+
+	var t domain.AccountToken
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		if t, err = s.tokens.Use(ctx, domain.TokenLoginRejection, domain.HashAccountToken(s.cfg.Session.HashKey, token)); err != nil {
+			return err
+		}
+		return s.repo.Delete(ctx, t.AccountID, t.DeviceID)
+	})
+	if err == nil {
+		// persistent logins are ended too, they might be issued to the device
+		err = s.session.TerminateAll(ctx, t.AccountID, "")
+	}
+	if err == nil {
+		err = s.account.StartPasswordReset(ctx, t.AccountID)
+	}
+	s.audit.recordAction(ctx, domain.AuditLoginRejected, t.AccountID, err,
+		map[string]any{"sessionId": t.SessionID, "deviceId": t.DeviceID})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
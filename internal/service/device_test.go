@@ -0,0 +1,472 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"go-authentication/config"
+	"go-authentication/internal/apperrors"
+	"go-authentication/internal/domain"
+	"go-authentication/internal/mailer"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDeviceRepo keeps devices by account and fingerprint, accounts in trusted
+// haven't logged in since signup.
+type fakeDeviceRepo struct {
+	mu      sync.Mutex
+	devices map[string]domain.KnownDevice
+	trusted map[string]bool
+}
+
+func newFakeDeviceRepo(trusted ...string) *fakeDeviceRepo {
+	r := &fakeDeviceRepo{devices: make(map[string]domain.KnownDevice), trusted: make(map[string]bool)}
+	for _, aid := range trusted {
+		r.trusted[aid] = true
+	}
+	return r
+}
+
+func (r *fakeDeviceRepo) Add(_ context.Context, d domain.KnownDevice) (bool, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// mirrors varchar(64) columns of known_devices
+	if len([]rune(d.Browser)) > 64 || len([]rune(d.OS)) > 64 {
+		return false, false, errors.New("value too long for type character varying(64)")
+	}
+
+	trusted := r.trusted[d.AccountID]
+	delete(r.trusted, d.AccountID)
+
+	k := d.AccountID + "|" + d.Fingerprint
+	if known, ok := r.devices[k]; ok {
+		known.LastSeenAt = d.LastSeenAt
+		r.devices[k] = known
+		return false, trusted, nil
+	}
+	r.devices[k] = d
+	return true, trusted, nil
+}
+
+func (r *fakeDeviceRepo) FindAll(_ context.Context, aid string) ([]domain.KnownDevice, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var devices []domain.KnownDevice
+	for _, d := range r.devices {
+		if d.AccountID == aid {
+			devices = append(devices, d)
+		}
+	}
+	return devices, nil
+}
+
+func (r *fakeDeviceRepo) Delete(_ context.Context, aid, fingerprint string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.devices, aid+"|"+fingerprint)
+	return nil
+}
+
+// fakeAccountTokenRepo keeps tokens by hash.
+type fakeAccountTokenRepo struct {
+	mu     sync.Mutex
+	tokens map[string]domain.AccountToken
+}
+
+func (r *fakeAccountTokenRepo) Create(_ context.Context, t domain.AccountToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.tokens == nil {
+		r.tokens = make(map[string]domain.AccountToken)
+	}
+	r.tokens[t.Hash] = t
+	return nil
+}
+
+func (r *fakeAccountTokenRepo) Use(_ context.Context, purpose, hash string) (domain.AccountToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tokens[hash]
+	if !ok || t.Purpose != purpose || t.UsedAt != nil || time.Now().After(t.ExpiresAt) {
+		return domain.AccountToken{}, apperrors.ErrorAccountTokenInvalid
+	}
+
+	now := time.Now()
+	t.UsedAt = &now
+	r.tokens[hash] = t
+	return t, nil
+}
+
+func (r *fakeAccountTokenRepo) DeleteAll(_ context.Context, aid, purpose string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for hash, t := range r.tokens {
+		if t.AccountID == aid && t.Purpose == purpose {
+			delete(r.tokens, hash)
+		}
+	}
+	return nil
+}
+
+// emailAccountNotifier sends notifications as plain emails with the token in the text,
+// new device alerts fail with alertErr if it is set.
+type emailAccountNotifier struct {
+	mailer   Mailer
+	alertErr error
+}
+
+func (n emailAccountNotifier) AlreadyRegistered(ctx context.Context, acc domain.Account) error {
+	return n.mailer.Send(ctx, domain.Email{To: acc.Email, Template: mailer.TemplateAlreadyRegistered})
+}
+
+func (n emailAccountNotifier) NewDeviceLogin(
+	ctx context.Context,
+	acc domain.Account,
+	_ domain.Session,
+	rejectToken string,
+	_ time.Time) error {
+
+	if n.alertErr != nil {
+		return n.alertErr
+	}
+	return n.mailer.Send(ctx, domain.Email{To: acc.Email, Template: mailer.TemplateNewDeviceLogin, Text: rejectToken})
+}
+
+func (n emailAccountNotifier) PasswordReset(ctx context.Context, acc domain.Account, token string, _ time.Time) error {
+	return n.mailer.Send(ctx, domain.Email{To: acc.Email, Template: mailer.TemplatePasswordReset, Text: token})
+}
+
+// commitFailingTx runs fn and fails to commit.
+type commitFailingTx struct{}
+
+var errCommit = errors.New("commit failed")
+
+func (commitFailingTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	return errCommit
+}
+
+// fakeSessionService records accounts whose sessions were terminated.
+type fakeSessionService struct {
+	Session
+
+	mu         sync.Mutex
+	terminated []string
+}
+
+func (s *fakeSessionService) TerminateAll(_ context.Context, aid, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.terminated = append(s.terminated, aid)
+	return nil
+}
+
+// fakeAccountService records accounts whose password reset was started.
+type fakeAccountService struct {
+	Account
+
+	mu     sync.Mutex
+	resets []string
+}
+
+func (s *fakeAccountService) StartPasswordReset(_ context.Context, aid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.resets = append(s.resets, aid)
+	return nil
+}
+
+type testDeviceDeps struct {
+	devices  *fakeDeviceRepo
+	tokens   *fakeAccountTokenRepo
+	mailer   interface{ Emails() []domain.Email }
+	sessions *fakeSessionService
+	accounts *fakeAccountService
+	audit    *fakeAuditRepo
+}
+
+func newTestDeviceService(devices *fakeDeviceRepo) (*deviceService, testDeviceDeps) {
+	cfg := &config.Config{}
+	cfg.Session.HashKey = "test"
+	cfg.LoginAlerts = config.LoginAlerts{LoginAlertsEnabled: true, LoginRejectTTL: time.Hour}
+
+	m := mailer.NewMemoryMailer()
+	d := testDeviceDeps{
+		devices:  devices,
+		tokens:   &fakeAccountTokenRepo{},
+		mailer:   m,
+		sessions: &fakeSessionService{},
+		accounts: &fakeAccountService{},
+		audit:    &fakeAuditRepo{},
+	}
+
+	s := NewDeviceService(cfg, discardLogger(), d.devices, d.tokens, emailAccountNotifier{mailer: m},
+		d.sessions, d.accounts, d.audit, fakeTx{})
+	return s, d
+}
+
+var testAccount = domain.Account{ID: "a", Email: "bob@example.com"}
+
+func testLogin(handle, browser, os, ip string) domain.Session {
+	return domain.Session{
+		AccountID: testAccount.ID,
+		Handle:    handle,
+		IP:        ip,
+		Device:    domain.Device{Browser: browser, OS: os},
+		CreatedAt: time.Now(),
+	}
+}
+
+// alerts returns reject tokens of sent new device alerts.
+func alerts(d testDeviceDeps) []string {
+	var tokens []string
+	for _, e := range d.mailer.Emails() {
+		if e.Template == mailer.TemplateNewDeviceLogin {
+			tokens = append(tokens, e.Text)
+		}
+	}
+	return tokens
+}
+
+func TestDeviceFingerprint(t *testing.T) {
+	base := testLogin("s", "Chrome 120", "Windows 10", "203.0.113.7")
+
+	tests := []struct {
+		name string
+		sess domain.Session
+		same bool
+	}{
+		{"browser update", testLogin("s", "Chrome 121", "Windows 10", "203.0.113.7"), true},
+		{"same network", testLogin("s", "Chrome 120", "Windows 10", "203.0.113.200"), true},
+		{"other network", testLogin("s", "Chrome 120", "Windows 10", "198.51.100.7"), false},
+		{"other browser", testLogin("s", "Firefox 120", "Windows 10", "203.0.113.7"), false},
+		{"other OS", testLogin("s", "Chrome 120", "Linux", "203.0.113.7"), false},
+		{"IPv6", testLogin("s", "Chrome 120", "Windows 10", "2001:db8::2"), false},
+	}
+
+	want := domain.DeviceFingerprint("test", base)
+	for _, tt := range tests {
+		got := domain.DeviceFingerprint("test", tt.sess)
+		if (got == want) != tt.same {
+			t.Errorf("%s: same fingerprint = %v, want %v", tt.name, got == want, tt.same)
+		}
+	}
+
+	v6 := testLogin("s", "Chrome 120", "Windows 10", "2001:db8::1")
+	if domain.DeviceFingerprint("test", v6) != domain.DeviceFingerprint("test", tests[5].sess) {
+		t.Error("addresses of the same IPv6 /64 have different fingerprints")
+	}
+	if domain.DeviceFingerprint("other", base) == want {
+		t.Error("fingerprint doesn't depend on the hash key")
+	}
+}
+
+func TestCheckLoginTrustsFirstLoginAfterSignup(t *testing.T) {
+	s, d := newTestDeviceService(newFakeDeviceRepo(testAccount.ID))
+
+	if err := s.CheckLogin(context.Background(), testAccount, testLogin("s1", "Chrome 120", "Linux", "203.0.113.7")); err != nil {
+		t.Fatalf("CheckLogin() error = %v", err)
+	}
+	if n := len(alerts(d)); n != 0 {
+		t.Fatalf("%d alerts sent for the first login after signup, want 0", n)
+	}
+
+	// the same device again
+	if err := s.CheckLogin(context.Background(), testAccount, testLogin("s2", "Chrome 121", "Linux", "203.0.113.8")); err != nil {
+		t.Fatalf("CheckLogin() error = %v", err)
+	}
+	if n := len(alerts(d)); n != 0 {
+		t.Fatalf("%d alerts sent for a known device, want 0", n)
+	}
+
+	if err := s.CheckLogin(context.Background(), testAccount, testLogin("s3", "Firefox 120", "Windows 10", "198.51.100.7")); err != nil {
+		t.Fatalf("CheckLogin() error = %v", err)
+	}
+	if n := len(alerts(d)); n != 1 {
+		t.Fatalf("%d alerts sent for a new device, want 1", n)
+	}
+}
+
+func TestCheckLoginAlertsFirstRememberedLoginOfOldAccount(t *testing.T) {
+	// the account was created before devices were remembered, so it isn't trusted
+	s, d := newTestDeviceService(newFakeDeviceRepo())
+
+	if err := s.CheckLogin(context.Background(), testAccount, testLogin("s1", "Chrome 120", "Linux", "203.0.113.7")); err != nil {
+		t.Fatalf("CheckLogin() error = %v", err)
+	}
+	if n := len(alerts(d)); n != 1 {
+		t.Fatalf("%d alerts sent, want 1", n)
+	}
+}
+
+func TestCheckLoginTruncatesLongDeviceNames(t *testing.T) {
+	s, d := newTestDeviceService(newFakeDeviceRepo())
+
+	long := strings.Repeat("x", 200)
+	if err := s.CheckLogin(context.Background(), testAccount, testLogin("s1", long+" 1", long, "203.0.113.7")); err != nil {
+		t.Fatalf("CheckLogin() error = %v", err)
+	}
+	if n := len(alerts(d)); n != 1 {
+		t.Fatalf("%d alerts sent, want 1", n)
+	}
+
+	devices, _ := d.devices.FindAll(context.Background(), testAccount.ID)
+	if len(devices) != 1 {
+		t.Fatalf("%d devices stored, want 1", len(devices))
+	}
+	if len(devices[0].Browser) != 64 || len(devices[0].OS) != 64 {
+		t.Errorf("stored browser and OS have %d and %d characters, want 64",
+			len(devices[0].Browser), len(devices[0].OS))
+	}
+
+	// the same long user agent is recognized
+	if err := s.CheckLogin(context.Background(), testAccount, testLogin("s2", long+" 2", long, "203.0.113.7")); err != nil {
+		t.Fatalf("CheckLogin() error = %v", err)
+	}
+	if n := len(alerts(d)); n != 1 {
+		t.Errorf("%d alerts sent, want 1", n)
+	}
+}
+
+func TestRejectLogin(t *testing.T) {
+	s, d := newTestDeviceService(newFakeDeviceRepo())
+	ctx := context.Background()
+
+	sess := testLogin("s1", "Chrome 120", "Linux", "203.0.113.7")
+	if err := s.CheckLogin(ctx, testAccount, sess); err != nil {
+		t.Fatalf("CheckLogin() error = %v", err)
+	}
+	tokens := alerts(d)
+	if len(tokens) != 1 {
+		t.Fatalf("%d alerts sent, want 1", len(tokens))
+	}
+
+	if err := s.RejectLogin(ctx, tokens[0]); err != nil {
+		t.Fatalf("RejectLogin() error = %v", err)
+	}
+
+	if len(d.sessions.terminated) != 1 || d.sessions.terminated[0] != testAccount.ID {
+		t.Errorf("terminated sessions of %v, want [%s]", d.sessions.terminated, testAccount.ID)
+	}
+	if len(d.accounts.resets) != 1 || d.accounts.resets[0] != testAccount.ID {
+		t.Errorf("password reset started for %v, want [%s]", d.accounts.resets, testAccount.ID)
+	}
+	if devices, _ := d.devices.FindAll(ctx, testAccount.ID); len(devices) != 0 {
+		t.Errorf("rejected device is remembered: %v", devices)
+	}
+
+	types := d.audit.types()
+	if len(types) != 2 || types[0] != domain.AuditNewDeviceLogin || types[1] != domain.AuditLoginRejected {
+		t.Errorf("audit events = %v", types)
+	}
+
+	// the rejected device is alerted again
+	if err := s.CheckLogin(ctx, testAccount, testLogin("s2", "Chrome 120", "Linux", "203.0.113.7")); err != nil {
+		t.Fatalf("CheckLogin() error = %v", err)
+	}
+	if n := len(alerts(d)); n != 2 {
+		t.Errorf("%d alerts sent, want 2", n)
+	}
+}
+
+func TestRejectLoginTokenIsSingleUse(t *testing.T) {
+	s, d := newTestDeviceService(newFakeDeviceRepo())
+	ctx := context.Background()
+
+	if err := s.CheckLogin(ctx, testAccount, testLogin("s1", "Chrome 120", "Linux", "203.0.113.7")); err != nil {
+		t.Fatalf("CheckLogin() error = %v", err)
+	}
+	token := alerts(d)[0]
+
+	if err := s.RejectLogin(ctx, token); err != nil {
+		t.Fatalf("RejectLogin() error = %v", err)
+	}
+	if err := s.RejectLogin(ctx, token); !errors.Is(err, apperrors.ErrorAccountTokenInvalid) {
+		t.Fatalf("second RejectLogin() error = %v, want %v", err, apperrors.ErrorAccountTokenInvalid)
+	}
+	if len(d.accounts.resets) != 1 {
+		t.Errorf("password reset started %d times, want 1", len(d.accounts.resets))
+	}
+}
+
+func TestRejectLoginRefusesOtherTokens(t *testing.T) {
+	s, d := newTestDeviceService(newFakeDeviceRepo())
+	ctx := context.Background()
+
+	// a password reset token can't reject a login
+	reset, err := domain.NewAccountToken("test", domain.TokenPasswordReset, testAccount.ID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.tokens.Create(ctx, reset); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{reset.Token, "unknown"} {
+		if err = s.RejectLogin(ctx, token); !errors.Is(err, apperrors.ErrorAccountTokenInvalid) {
+			t.Errorf("RejectLogin(%q) error = %v, want %v", token, err, apperrors.ErrorAccountTokenInvalid)
+		}
+	}
+	if len(d.sessions.terminated) != 0 || len(d.accounts.resets) != 0 {
+		t.Errorf("invalid token terminated sessions of %v and reset password of %v",
+			d.sessions.terminated, d.accounts.resets)
+	}
+}
+
+func TestCheckLoginForgetsDeviceOfUnsentAlert(t *testing.T) {
+	s, d := newTestDeviceService(newFakeDeviceRepo())
+	errMail := errors.New("mail is down")
+	s.notifier = emailAccountNotifier{mailer: mailer.NewMemoryMailer(), alertErr: errMail}
+
+	if err := s.CheckLogin(context.Background(), testAccount, testLogin("s1", "Chrome 120", "Linux", "203.0.113.7")); !errors.Is(err, errMail) {
+		t.Fatalf("CheckLogin() error = %v, want %v", err, errMail)
+	}
+	if devices, _ := d.devices.FindAll(context.Background(), testAccount.ID); len(devices) != 0 {
+		t.Errorf("device of unsent alert is remembered: %v", devices)
+	}
+	if len(d.audit.events) != 1 || d.audit.events[0].Result != domain.AuditResultFailure {
+		t.Errorf("audit events = %v, want failed new device login", d.audit.events)
+	}
+}
+
+func TestCheckLoginDoesNotAlertIfNotCommitted(t *testing.T) {
+	s, d := newTestDeviceService(newFakeDeviceRepo())
+	s.tx = commitFailingTx{}
+
+	if err := s.CheckLogin(context.Background(), testAccount, testLogin("s1", "Chrome 120", "Linux", "203.0.113.7")); !errors.Is(err, errCommit) {
+		t.Fatalf("CheckLogin() error = %v, want %v", err, errCommit)
+	}
+	if n := len(alerts(d)); n != 0 {
+		t.Errorf("%d alerts sent for uncommitted token, want 0", n)
+	}
+}
+
+func TestRejectLoginKeepsSessionsIfNotCommitted(t *testing.T) {
+	s, d := newTestDeviceService(newFakeDeviceRepo())
+	ctx := context.Background()
+
+	if err := s.CheckLogin(ctx, testAccount, testLogin("s1", "Chrome 120", "Linux", "203.0.113.7")); err != nil {
+		t.Fatalf("CheckLogin() error = %v", err)
+	}
+	s.tx = commitFailingTx{}
+
+	if err := s.RejectLogin(ctx, alerts(d)[0]); !errors.Is(err, errCommit) {
+		t.Fatalf("RejectLogin() error = %v, want %v", err, errCommit)
+	}
+	if len(d.sessions.terminated) != 0 || len(d.accounts.resets) != 0 {
+		t.Errorf("uncommitted rejection terminated sessions of %v and reset password of %v",
+			d.sessions.terminated, d.accounts.resets)
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"go-authentication/internal/apperrors"
+	"go-authentication/internal/domain"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type fakeAuditRepo struct {
+	AuditRepo
+
+	mu     sync.Mutex
+	events []domain.AuditEvent
+}
+
+func (f *fakeAuditRepo) Create(_ context.Context, e domain.AuditEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.events = append(f.events, e)
+	return nil
+}
+
+// types returns types of the recorded events in the order of recording.
+func (f *fakeAuditRepo) types() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	types := make([]string, 0, len(f.events))
+	for _, e := range f.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+// fakeTx runs fn without a transaction.
+type fakeTx struct{}
+
+func (fakeTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// fakeAccountRepo keeps accounts by id.
+type fakeAccountRepo struct {
+	AccountRepo
+
+	mu       sync.Mutex
+	accounts map[string]domain.Account
+	deleted  []string
+}
+
+func newFakeAccountRepo(accounts ...domain.Account) *fakeAccountRepo {
+	r := &fakeAccountRepo{accounts: make(map[string]domain.Account)}
+	for _, a := range accounts {
+		r.accounts[a.ID] = a
+	}
+	return r
+}
+
+func (r *fakeAccountRepo) FindByID(_ context.Context, id string) (domain.Account, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a, ok := r.accounts[id]
+	if !ok {
+		return domain.Account{}, apperrors.ErrorAccountNotFound
+	}
+	return a, nil
+}
+
+func (r *fakeAccountRepo) Delete(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.accounts[id]; !ok {
+		return apperrors.ErrorAccountNotFound
+	}
+	delete(r.accounts, id)
+	r.deleted = append(r.deleted, id)
+	return nil
+}
+
+func (r *fakeAccountRepo) SetPasswordResetRequired(_ context.Context, id string, required bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a, ok := r.accounts[id]
+	if !ok {
+		return apperrors.ErrorAccountNotFound
+	}
+	a.PasswordResetRequired = required
+	r.accounts[id] = a
+	return nil
+}
+
+func (r *fakeAccountRepo) FindMissing(_ context.Context, ids []string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var missing []string
+	for _, id := range ids {
+		if _, ok := r.accounts[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	return missing, nil
+}
+
+// fakeOutboxWriter collects events added to the outbox.
+type fakeOutboxWriter struct {
+	OutboxRepo
+
+	mu     sync.Mutex
+	events []domain.Event
+}
+
+func (o *fakeOutboxWriter) Add(_ context.Context, e domain.Event) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.events = append(o.events, e)
+	return nil
+}
+
+// fakeBroker collects published events.
+type fakeBroker struct {
+	EventBroker
+
+	mu     sync.Mutex
+	events []domain.Event
+}
+
+func (b *fakeBroker) Publish(_ context.Context, e domain.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.events = append(b.events, e)
+	return nil
+}
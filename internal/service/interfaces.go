@@ -4,31 +4,115 @@ import (
 	"context"
 	"go-authentication/internal/domain"
 	"net/url"
+	"time"
 )
 
 // Services:
 
 type Account interface {
+	// Create returns id of the created account, the id is empty
+	// if the email is registered and existing accounts are concealed.
 	Create(ctx context.Context, acc domain.Account) (string, error)
 	GetByID(ctx context.Context, aid string) (domain.Account, error)
 	GetByEmail(ctx context.Context, email string) (domain.Account, error)
+	// ChangePassword replaces the password after verifying the current one, sid is a handle of the caller session.
+	ChangePassword(ctx context.Context, aid, sid, current, new string) error
+	UpdatePasswordHash(ctx context.Context, aid, hash string) error
+	// StartPasswordReset forbids login to the account until its password is reset and emails the owner a reset link.
+	StartPasswordReset(ctx context.Context, aid string) error
+	// ResetPassword sets new password of the account the reset token was sent to, the token can be used once.
+	ResetPassword(ctx context.Context, token, password string) error
 	Delete(ctx context.Context, aid string) error
+	// Activity returns a page of audit events affecting the account and total number of them.
+	Activity(ctx context.Context, aid string, p domain.Pagination) ([]domain.AuditEvent, int64, error)
 }
 
 type Session interface {
 	Create(ctx context.Context, aid, provider string, d Device) (domain.Session, error)
-	Get(ctx context.Context, sid string) (domain.Session, error)
-	GetAll(ctx context.Context, aid string) ([]domain.Session, error)
-	Terminate(ctx context.Context, curSid string, reqSid string) error
+	// Impersonate creates a short-lived session of account aid opened by admin impersonatorID.
+	Impersonate(ctx context.Context, aid, impersonatorID string, d Device) (domain.Session, error)
+	// Get returns session by raw session token from the cookie.
+	Get(ctx context.Context, token string) (domain.Session, error)
+	// GetByAccount returns session with given public handle only if it belongs to given account.
+	GetByAccount(ctx context.Context, aid, handle string) (domain.Session, error)
+	// List returns a page of account sessions and total number of account sessions.
+	List(ctx context.Context, aid string, p domain.Pagination) ([]domain.Session, int64, error)
+	// Terminate deletes session with given public handle of account aid,
+	// curSid must be the handle of the caller session.
+	Terminate(ctx context.Context, aid, curSid, handle string) error
+	// Delete deletes session by its handle, used to end the current session.
+	Delete(ctx context.Context, aid, sid string) error
+	// TerminateAll deletes all sessions of account aid except the session with handle sid.
 	TerminateAll(ctx context.Context, aid string, sid string) error
+	// Rotate replaces id and token of the session keeping its metadata, the old token becomes invalid.
+	// It must be called whenever privileges of the session change to prevent session fixation.
+	Rotate(ctx context.Context, s domain.Session) (domain.Session, error)
+	// Remember creates persistent login token of the account and returns it.
+	Remember(ctx context.Context, aid string) (string, error)
+	// Restore creates new session using persistent login token, the token is rotated
+	// and the new one is returned, it is empty if the token is kept.
+	Restore(ctx context.Context, rememberToken string, d Device) (domain.Session, string, error)
+	// Forget deletes the series of persistent login token.
+	Forget(ctx context.Context, rememberToken string) error
+	// Subscribe returns channel of events affecting session with handle sid of account aid,
+	// the channel is closed when ctx is done.
+	Subscribe(ctx context.Context, aid, sid string) (<-chan domain.Event, error)
+}
+
+// Devices keeps devices accounts have logged in from and alerts owners of logins from new ones.
+type Devices interface {
+	// CheckLogin remembers the device of session s opened by account a, the owner is alerted
+	// if the device is new, unless it is the first login after signup.
+	CheckLogin(ctx context.Context, a domain.Account, s domain.Session) error
+	// List returns known devices of the account, the recently used first.
+	List(ctx context.Context, aid string) ([]domain.KnownDevice, error)
+	// RejectLogin ends all sessions of the account the rejection token of the login alert was sent to,
+	// forgets the device and starts password reset.
+	RejectLogin(ctx context.Context, token string) error
 }
 
 type Auth interface {
 	// EmailLogin creates new session using provided account email and password.
 	EmailLogin(ctx context.Context, email, password string, d Device) (domain.Session, error)
-	Logout(ctx context.Context, sid string) error
-	NewAccessToken(ctx context.Context, sub, password string) (string, error)
-	ParseAccessToken(ctx context.Context, token string) (string, error)
+	Logout(ctx context.Context, aid, sid string) error
+	// NewAccessToken issues access token for the account of session s after verifying its password.
+	NewAccessToken(ctx context.Context, s domain.Session, password string) (string, error)
+	ParseAccessToken(ctx context.Context, token string) (domain.AccessClaims, error)
+}
+
+// Admin manages any account on behalf of the actor, all actions are audited.
+type Admin interface {
+	SearchAccounts(ctx context.Context, actor domain.Actor, f domain.AccountFilter, p domain.Pagination) ([]domain.Account, int64, error)
+	GetAccount(ctx context.Context, actor domain.Actor, aid string) (domain.Account, error)
+	Lock(ctx context.Context, actor domain.Actor, aid string) error
+	Unlock(ctx context.Context, actor domain.Actor, aid string) error
+	ForcePasswordReset(ctx context.Context, actor domain.Actor, aid string) error
+	Sessions(ctx context.Context, actor domain.Actor, aid string, p domain.Pagination) ([]domain.Session, int64, error)
+	TerminateSessions(ctx context.Context, actor domain.Actor, aid string) error
+	// Impersonate opens a session of account aid on behalf of the actor and ends the actor session sid.
+	Impersonate(ctx context.Context, actor domain.Actor, sid, aid string) (domain.Session, error)
+	Roles(ctx context.Context, actor domain.Actor, aid string) ([]string, error)
+	AssignRole(ctx context.Context, actor domain.Actor, aid, role string) error
+	RevokeRole(ctx context.Context, actor domain.Actor, aid, role string) error
+}
+
+type Webhook interface {
+	// Create registers webhook of url subscribed to events, the returned webhook contains its secret.
+	Create(ctx context.Context, url string, events []string) (domain.Webhook, error)
+	List(ctx context.Context) ([]domain.Webhook, error)
+	Get(ctx context.Context, id string) (domain.Webhook, error)
+	Delete(ctx context.Context, id string) error
+	// Deliveries returns a page of deliveries of the webhook and total number of them.
+	Deliveries(ctx context.Context, id string, p domain.Pagination) ([]domain.WebhookDelivery, int64, error)
+}
+
+type Role interface {
+	// Roles returns names of the account roles.
+	Roles(ctx context.Context, aid string) ([]string, error)
+	// HasPermission reports whether any role of the account grants the permission.
+	HasPermission(ctx context.Context, aid, permission string) (bool, error)
+	Assign(ctx context.Context, aid, role string) error
+	Revoke(ctx context.Context, aid, role string) error
 }
 
 type SocialAuth interface {
@@ -38,23 +122,189 @@ type SocialAuth interface {
 }
 
 type Token interface {
-	New(sub string) (string, error)
-	Parse(token string) (string, error)
+	New(c domain.AccessClaims) (string, error)
+	Parse(token string) (domain.AccessClaims, error)
+}
+
+type EventBroker interface {
+	Publish(ctx context.Context, e domain.Event) error
+	// Subscribe returns channel of events of given account, the channel is closed when ctx is done.
+	Subscribe(ctx context.Context, aid string) (<-chan domain.Event, error)
+}
+
+// EventPublisher delivers events written to the outbox to other components,
+// the same event may be published more than once.
+type EventPublisher interface {
+	Publish(ctx context.Context, e domain.Event) error
+}
+
+type LoginAttemptStore interface {
+	Get(ctx context.Context, key string) (domain.LoginAttempts, error)
+	// Reserve atomically counts a failure of the key and sets the time of the last failure unless wait
+	// returns non-zero duration for the current state, the duration is returned then. The state is
+	// forgotten after ttl since the last failure.
+	Reserve(ctx context.Context, key string, ttl time.Duration, wait func(domain.LoginAttempts) time.Duration) (time.Duration, error)
+	// Release uncounts a failure reserved for an attempt which hasn't failed.
+	Release(ctx context.Context, key string) error
+	// Lock locks the key until given time.
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+type AccountNotifier interface {
+	// AlreadyRegistered tells the owner of the account that someone tried to sign up with its email.
+	AlreadyRegistered(ctx context.Context, acc domain.Account) error
+	// NewDeviceLogin tells the owner of the account about login of session s from a new device,
+	// rejectToken lets the owner reject the login until it expires.
+	NewDeviceLogin(ctx context.Context, acc domain.Account, s domain.Session, rejectToken string, expiresAt time.Time) error
+	// PasswordReset sends the owner of the account a link to set new password with the token.
+	PasswordReset(ctx context.Context, acc domain.Account, token string, expiresAt time.Time) error
+}
+
+type Mailer interface {
+	Send(ctx context.Context, e domain.Email) error
+}
+
+type GeoLocator interface {
+	// Lookup returns country and city of given ip address.
+	Lookup(ip string) (country string, city string, err error)
 }
 
 // Repositories:
 
+// TxManager runs fn in a transaction, repositories called with ctx passed to fn run their queries in it.
+// The transaction is rolled back if fn returns error or panics.
+type TxManager interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
 type AccountRepo interface {
 	Create(ctx context.Context, acc domain.Account) (string, error)
 	FindByID(ctx context.Context, id string) (domain.Account, error)
 	FindByEmail(ctx context.Context, email string) (domain.Account, error)
+	// FindAll returns a page of accounts matching the filter and total number of matching accounts.
+	FindAll(ctx context.Context, f domain.AccountFilter, p domain.Pagination) ([]domain.Account, int64, error)
+	// UpdatePassword sets new password chosen by the owner and clears required password reset.
+	UpdatePassword(ctx context.Context, id, hash string) error
+	// UpdatePasswordHash replaces hash of the same password.
+	UpdatePasswordHash(ctx context.Context, id, hash string) error
+	SetLocked(ctx context.Context, id string, locked bool) error
+	SetPasswordResetRequired(ctx context.Context, id string, required bool) error
 	Delete(ctx context.Context, id string) error
+	// FindMissing returns those of ids which don't belong to any account, malformed ids are missing too.
+	FindMissing(ctx context.Context, ids []string) ([]string, error)
 }
 
 type SessionRepo interface {
-	Create(ctx context.Context, session domain.Session) error
-	FindByID(ctx context.Context, id string) (domain.Session, error)
-	FindAll(ctx context.Context, aid string) ([]domain.Session, error)
-	Delete(ctx context.Context, sid string) error
-	DeleteAll(ctx context.Context, aid, currSid string) error
+	// Create stores session and returns it with the token to be passed to the client.
+	Create(ctx context.Context, session domain.Session) (domain.Session, error)
+	// FindByToken returns session identified by the token passed by the client.
+	FindByToken(ctx context.Context, token string) (domain.Session, error)
+	FindByHandle(ctx context.Context, aid, handle string) (domain.Session, error)
+	FindAll(ctx context.Context, aid string, p domain.Pagination) ([]domain.Session, int64, error)
+	// Delete deletes session of account aid by its public handle.
+	Delete(ctx context.Context, aid, handle string) error
+	// DeleteAll deletes all sessions of account aid except the session with given handle.
+	DeleteAll(ctx context.Context, aid, exceptHandle string) error
+	// Rotate replaces session with oldID by the session s, returns it with the token to be passed to the client.
+	Rotate(ctx context.Context, oldID string, s domain.Session) (domain.Session, error)
+	// AccountIDs returns up to limit distinct ids of accounts having sessions,
+	// greater than afterAID in ascending order.
+	AccountIDs(ctx context.Context, afterAID string, limit int) ([]string, error)
+}
+
+type RoleRepo interface {
+	// Assign assigns role to the account, assigning of already assigned role is not an error.
+	Assign(ctx context.Context, aid, role string) error
+	Revoke(ctx context.Context, aid, role string) error
+	FindByAccount(ctx context.Context, aid string) ([]string, error)
+	// FindPermissions returns permissions granted to the account by all its roles.
+	FindPermissions(ctx context.Context, aid string) ([]string, error)
+}
+
+type AuditRepo interface {
+	// Create appends the event to the audit log.
+	Create(ctx context.Context, e domain.AuditEvent) error
+	// FindByTarget returns a page of events affecting account aid, newest first, and total number of them,
+	// events of admins viewing the account are skipped.
+	FindByTarget(ctx context.Context, aid string, p domain.Pagination) ([]domain.AuditEvent, int64, error)
+}
+
+type WebhookRepo interface {
+	Create(ctx context.Context, w domain.Webhook) (domain.Webhook, error)
+	FindAll(ctx context.Context) ([]domain.Webhook, error)
+	FindByID(ctx context.Context, id string) (domain.Webhook, error)
+	Delete(ctx context.Context, id string) error
+	// Enqueue queues the event for every active webhook subscribed to it.
+	Enqueue(ctx context.Context, e domain.Event) error
+	// ClaimDue returns up to limit due deliveries and hides them from other callers for the lease.
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]domain.WebhookDelivery, error)
+	MarkDelivered(ctx context.Context, id int64) error
+	// Retry schedules the next attempt of the failed delivery.
+	Retry(ctx context.Context, id int64, next time.Time, lastErr string) error
+	// MarkFailed stops retries of the delivery.
+	MarkFailed(ctx context.Context, id int64, lastErr string) error
+	FindDeliveries(ctx context.Context, webhookID string, p domain.Pagination) ([]domain.WebhookDelivery, int64, error)
+}
+
+type OutboxRepo interface {
+	// Add writes the event to the outbox.
+	Add(ctx context.Context, e domain.Event) error
+	// Claim returns up to limit pending events in the order they were written and hides them
+	// from other callers for the lease.
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]domain.OutboxEntry, error)
+	MarkDispatched(ctx context.Context, ids []int64) error
+	// Release makes claimed events pending again without counting an attempt.
+	Release(ctx context.Context, ids []int64) error
+	// Fail counts failed attempt to publish the event, parked events aren't claimed anymore.
+	Fail(ctx context.Context, id int64, lastErr string, park bool) error
+	// DeleteDispatched deletes events dispatched before the time and returns their number.
+	DeleteDispatched(ctx context.Context, before time.Time) (int64, error)
+}
+
+type WebhookSender interface {
+	// Send posts signed JSON body to url.
+	Send(ctx context.Context, url, secret, id, event string, body []byte) error
+	// CheckURL returns error if requests to url are not allowed.
+	CheckURL(ctx context.Context, url string) error
+}
+
+type AuditChainRepo interface {
+	// Head returns the last chained event, ok is false if there is none.
+	Head(ctx context.Context) (e domain.AuditEvent, ok bool, err error)
+	// FindAfter returns up to limit events with id greater than afterID in the order of the chain.
+	FindAfter(ctx context.Context, afterID int64, limit int) ([]domain.AuditEvent, error)
+	CreateCheckpoint(ctx context.Context, c domain.AuditCheckpoint) error
+	// FindCheckpoints returns all checkpoints in the order of the chain.
+	FindCheckpoints(ctx context.Context) ([]domain.AuditCheckpoint, error)
+}
+
+type PasswordHistoryRepo interface {
+	// Add stores password hash of the account and prunes all but keep latest hashes.
+	Add(ctx context.Context, aid, hash string, keep int) error
+	// FindLatest returns up to n latest password hashes of the account.
+	FindLatest(ctx context.Context, aid string, n int) ([]string, error)
+}
+
+type RememberTokenRepo interface {
+	Create(ctx context.Context, t domain.RememberToken) error
+	FindBySelector(ctx context.Context, selector string) (domain.RememberToken, error)
+	Rotate(ctx context.Context, t domain.RememberToken) error
+	Delete(ctx context.Context, selector string) error
+	DeleteAll(ctx context.Context, aid string) error
+}
+
+type DeviceRepo interface {
+	// Add stores the device or updates its last use, it reports whether the device is new
+	// and whether it is the first device of the account since signup, which is trusted once.
+	Add(ctx context.Context, d domain.KnownDevice) (added bool, trusted bool, err error)
+	FindAll(ctx context.Context, aid string) ([]domain.KnownDevice, error)
+	Delete(ctx context.Context, aid, fingerprint string) error
+}
+
+type AccountTokenRepo interface {
+	Create(ctx context.Context, t domain.AccountToken) error
+	// Use marks unused and unexpired token with given purpose and hash used and returns it.
+	Use(ctx context.Context, purpose, hash string) (domain.AccountToken, error)
+	DeleteAll(ctx context.Context, aid, purpose string) error
 }
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-authentication/config"
+	"go-authentication/internal/apperrors"
+	"go-authentication/internal/domain"
+	"strings"
+	"time"
+)
+
+// loginGuard throttles password guessing: every failure over the free attempts
+// doubles the delay before the next attempt is allowed, the account is locked
+// after the threshold of failures.
+type loginGuard struct {
+	cfg   config.LoginThrottle
+	store LoginAttemptStore
+}
+
+func newLoginGuard(cfg config.LoginThrottle, store LoginAttemptStore) *loginGuard {
+	return &loginGuard{cfg: cfg, store: store}
+}
+
+func accountAttemptsKey(login string) string {
+	return "account:" + strings.ToLower(login)
+}
+
+func ipAttemptsKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Begin reserves an attempt of login from ip, it returns TooManyAttemptsError if login or ip must wait
+// before the next attempt. The attempt is counted as failed until Succeed or Cancel is called,
+// so parallel attempts can't pass the limit before any of them fails.
+func (g *loginGuard) Begin(ctx context.Context, login, ip string) error {
+	const op = "loginGuard.begin"
+
+	// state must outlive the lock
+	ttl := max(g.cfg.AttemptsTTL, g.cfg.AccountLockDuration)
+
+	wait, err := g.store.Reserve(ctx, accountAttemptsKey(login), ttl, func(a domain.LoginAttempts) time.Duration {
+		return g.wait(a, g.cfg.AccountFreeAttempts)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if wait > 0 {
+		return &apperrors.TooManyAttemptsError{RetryAfter: wait}
+	}
+
+	if ip == "" {
+		return nil
+	}
+
+	wait, err = g.store.Reserve(ctx, ipAttemptsKey(ip), ttl, func(a domain.LoginAttempts) time.Duration {
+		return g.wait(a, g.cfg.IPFreeAttempts)
+	})
+	if err == nil && wait > 0 {
+		err = &apperrors.TooManyAttemptsError{RetryAfter: wait}
+	}
+	if err != nil {
+		if relErr := g.store.Release(ctx, accountAttemptsKey(login)); relErr != nil {
+			return fmt.Errorf("%s: %w", op, errors.Join(err, relErr))
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Fail keeps the reserved attempt failed and locks the account if the threshold is reached.
+func (g *loginGuard) Fail(ctx context.Context, login string) error {
+	const op = "loginGuard.fail"
+
+	if g.cfg.AccountLockThreshold <= 0 {
+		return nil
+	}
+
+	key := accountAttemptsKey(login)
+
+	acc, err := g.store.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if acc.Failures >= g.cfg.AccountLockThreshold {
+		if err = g.store.Lock(ctx, key, time.Now().Add(g.cfg.AccountLockDuration)); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// Succeed forgets failures of the account and releases the attempt reserved for the ip,
+// failures of the ip are kept, so a valid account can't be used to reset throttling of the ip.
+func (g *loginGuard) Succeed(ctx context.Context, login, ip string) error {
+	const op = "loginGuard.succeed"
+
+	if err := g.store.Reset(ctx, accountAttemptsKey(login)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if ip != "" {
+		if err := g.store.Release(ctx, ipAttemptsKey(ip)); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// Cancel releases the attempt which ended before the password was verified or for reasons
+// not related to the password, so it isn't counted as failed.
+func (g *loginGuard) Cancel(ctx context.Context, login, ip string) error {
+	const op = "loginGuard.cancel"
+
+	err := g.store.Release(ctx, accountAttemptsKey(login))
+	if ip != "" {
+		err = errors.Join(err, g.store.Release(ctx, ipAttemptsKey(ip)))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// wait returns duration left until the next attempt is allowed.
+func (g *loginGuard) wait(a domain.LoginAttempts, free int) time.Duration {
+	now := time.Now()
+
+	if a.LockedUntil.After(now) {
+		return a.LockedUntil.Sub(now)
+	}
+
+	if a.Failures < free {
+		return 0
+	}
+
+	delay := g.cfg.BackoffBase
+	for i := free; i < a.Failures && delay < g.cfg.BackoffMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, g.cfg.BackoffMax)
+
+	return max(a.LastFailure.Add(delay).Sub(now), 0)
+}
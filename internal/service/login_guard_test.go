@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"go-authentication/config"
+	"go-authentication/internal/apperrors"
+	"go-authentication/internal/repository"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestGuard() *loginGuard {
+	return newLoginGuard(config.LoginThrottle{
+		AccountFreeAttempts:  3,
+		AccountLockThreshold: 5,
+		AccountLockDuration:  time.Minute,
+		IPFreeAttempts:       100,
+		BackoffBase:          time.Minute,
+		BackoffMax:           time.Hour,
+		AttemptsTTL:          time.Hour,
+	}, repository.NewMemoryLoginAttempts())
+}
+
+func TestLoginGuardParallelAttemptsDontPassLimit(t *testing.T) {
+	g := newTestGuard()
+	ctx := context.Background()
+
+	var (
+		wg      sync.WaitGroup
+		allowed atomic.Int32
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := g.Begin(ctx, "user@example.com", "10.0.0.1")
+			if err == nil {
+				allowed.Add(1)
+				return
+			}
+			if !errors.Is(err, apperrors.ErrorTooManyLoginAttempts) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != 3 {
+		t.Fatalf("allowed %d parallel attempts, want 3", got)
+	}
+}
+
+func TestLoginGuardSucceedAndCancelDontCountFailures(t *testing.T) {
+	g := newTestGuard()
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		if err := g.Begin(ctx, "user@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+		if i%2 == 0 {
+			err := g.Succeed(ctx, "user@example.com", "10.0.0.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := g.Cancel(ctx, "user@example.com", "10.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a, err := g.store.Get(ctx, ipAttemptsKey("10.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Failures != 0 {
+		t.Fatalf("ip failures = %d, want 0", a.Failures)
+	}
+}
+
+func TestLoginGuardLocksAccountAtThreshold(t *testing.T) {
+	g := newTestGuard()
+	g.cfg.AccountFreeAttempts = 100
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if err := g.Begin(ctx, "user@example.com", ""); err != nil {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+		if err := g.Fail(ctx, "user@example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tooMany *apperrors.TooManyAttemptsError
+	if err := g.Begin(ctx, "user@example.com", ""); !errors.As(err, &tooMany) {
+		t.Fatalf("err = %v, want TooManyAttemptsError", err)
+	}
+}
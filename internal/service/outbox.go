@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"go-authentication/config"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/utils"
+	"log/slog"
+	"time"
+)
+
+// outboxRelay publishes events written to the outbox. An event is marked dispatched only after
+// all publishers accept it, so it is published at least once, and again to every publisher if
+// any of them fails or the relay stops in between. An event failing max attempts is parked.
+type outboxRelay struct {
+	cfg        config.Outbox
+	log        *slog.Logger
+	repo       OutboxRepo
+	publishers []EventPublisher
+}
+
+func NewOutboxRelay(cfg *config.Config, log *slog.Logger, repo OutboxRepo, publishers ...EventPublisher) *outboxRelay {
+	return &outboxRelay{
+		cfg:        cfg.Outbox,
+		log:        log,
+		repo:       repo,
+		publishers: publishers,
+	}
+}
+
+// Run dispatches pending events every poll interval and deletes old dispatched ones
+// until ctx is canceled.
+func (s *outboxRelay) Run(ctx context.Context) {
+	const op = "outboxrelay.run"
+	l := s.log.With(slog.String(utils.Operation, op))
+
+	if s.cfg.OutboxPollInterval <= 0 {
+		l.Info("outbox relay is disabled")
+		return
+	}
+
+	t := time.NewTicker(s.cfg.OutboxPollInterval)
+	defer t.Stop()
+
+	lastCleanup := time.Now()
+	for {
+		select {
+		case <-t.C:
+			if err := s.Dispatch(ctx); err != nil {
+				l.Error("can't dispatch outbox", slog.String("error", err.Error()))
+			}
+
+			if s.cfg.OutboxRetention > 0 && time.Since(lastCleanup) >= time.Hour {
+				lastCleanup = time.Now()
+				if err := s.cleanup(ctx); err != nil {
+					l.Error("can't clean up outbox", slog.String("error", err.Error()))
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Dispatch publishes pending events batch by batch until none is left or publishing fails.
+func (s *outboxRelay) Dispatch(ctx context.Context) error {
+	const op = "outboxrelay.dispatch"
+
+	for {
+		entries, err := s.repo.Claim(ctx, s.cfg.OutboxBatchSize, s.cfg.OutboxLease)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err = s.dispatchBatch(ctx, entries); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if len(entries) < s.cfg.OutboxBatchSize {
+			return nil
+		}
+	}
+}
+
+// dispatchBatch publishes claimed events in order and stops at the first failure,
+// so a failing event isn't overtaken by later ones until it is parked.
+func (s *outboxRelay) dispatchBatch(ctx context.Context, entries []domain.OutboxEntry) error {
+	const op = "outboxrelay.dispatchBatch"
+	l := s.log.With(slog.String(utils.Operation, op))
+
+	published := make([]int64, 0, len(entries))
+
+	var publishErr error
+	for i, e := range entries {
+		if publishErr = s.publish(ctx, e.Event); publishErr == nil {
+			published = append(published, e.ID)
+			continue
+		}
+
+		park := e.Attempts+1 >= s.cfg.OutboxMaxAttempts
+		if park {
+			l.Warn("outbox event failed max attempts, parking",
+				slog.String("event_id", e.Event.ID),
+				slog.Int("attempts", e.Attempts+1),
+				slog.String("error", publishErr.Error()))
+		}
+		if err := s.repo.Fail(ctx, e.ID, publishErr.Error(), park); err != nil {
+			l.Error("can't record failed attempt", slog.String("error", err.Error()))
+		}
+
+		rest := make([]int64, 0, len(entries)-i-1)
+		for _, r := range entries[i+1:] {
+			rest = append(rest, r.ID)
+		}
+		// the rest is claimed again by the next poll, or after the lease if it isn't released
+		if err := s.repo.Release(ctx, rest); err != nil {
+			l.Error("can't release outbox events", slog.String("error", err.Error()))
+		}
+		break
+	}
+
+	// events which aren't marked are published again after the lease
+	if err := s.repo.MarkDispatched(ctx, published); err != nil {
+		return err
+	}
+	return publishErr
+}
+
+func (s *outboxRelay) publish(ctx context.Context, e domain.Event) error {
+	for _, p := range s.publishers {
+		if err := p.Publish(ctx, e); err != nil {
+			return fmt.Errorf("event %s: %w", e.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *outboxRelay) cleanup(ctx context.Context) error {
+	const op = "outboxrelay.cleanup"
+
+	n, err := s.repo.DeleteDispatched(ctx, time.Now().Add(-s.cfg.OutboxRetention))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n > 0 {
+		s.log.Debug("dispatched outbox events deleted",
+			slog.String(utils.Operation, op),
+			slog.Int64("count", n))
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"go-authentication/config"
+	"go-authentication/internal/domain"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+type outboxFailure struct {
+	lastErr string
+	park    bool
+}
+
+// fakeOutboxRepo keeps pending events in memory, claimed events are hidden until marked or released.
+type fakeOutboxRepo struct {
+	OutboxRepo
+
+	mu         sync.Mutex
+	pending    []domain.OutboxEntry
+	claimed    map[int64]domain.OutboxEntry
+	dispatched []int64
+	failures   map[int64]outboxFailure
+	parked     []int64
+}
+
+func newFakeOutboxRepo(n int) *fakeOutboxRepo {
+	r := &fakeOutboxRepo{claimed: make(map[int64]domain.OutboxEntry), failures: make(map[int64]outboxFailure)}
+	for i := 1; i <= n; i++ {
+		e := domain.NewEvent(domain.EventAccountCreated, "account-id")
+		r.pending = append(r.pending, domain.OutboxEntry{ID: int64(i), Event: e})
+	}
+	return r
+}
+
+func (r *fakeOutboxRepo) Claim(_ context.Context, limit int, _ time.Duration) ([]domain.OutboxEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := min(limit, len(r.pending))
+	entries := slices.Clone(r.pending[:n])
+	r.pending = r.pending[n:]
+	for _, e := range entries {
+		r.claimed[e.ID] = e
+	}
+	return entries, nil
+}
+
+func (r *fakeOutboxRepo) MarkDispatched(_ context.Context, ids []int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range ids {
+		delete(r.claimed, id)
+	}
+	r.dispatched = append(r.dispatched, ids...)
+	return nil
+}
+
+func (r *fakeOutboxRepo) Release(_ context.Context, ids []int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.release(ids...)
+	return nil
+}
+
+func (r *fakeOutboxRepo) Fail(_ context.Context, id int64, lastErr string, park bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failures[id] = outboxFailure{lastErr: lastErr, park: park}
+	if park {
+		delete(r.claimed, id)
+		r.parked = append(r.parked, id)
+		return nil
+	}
+
+	e := r.claimed[id]
+	e.Attempts++
+	r.claimed[id] = e
+	r.release(id)
+	return nil
+}
+
+// release returns claimed events to pending keeping the order of ids.
+func (r *fakeOutboxRepo) release(ids ...int64) {
+	for _, id := range ids {
+		r.pending = append(r.pending, r.claimed[id])
+		delete(r.claimed, id)
+	}
+	slices.SortFunc(r.pending, func(a, b domain.OutboxEntry) int { return int(a.ID - b.ID) })
+}
+
+// failingPublisher fails events with ids in fail.
+type failingPublisher struct {
+	ids  map[string]int64
+	fail map[int64]bool
+
+	mu        sync.Mutex
+	published []int64
+}
+
+var errBrokerDown = errors.New("broker is down")
+
+func (p *failingPublisher) Publish(_ context.Context, e domain.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id := p.ids[e.ID]
+	if p.fail[id] {
+		return errBrokerDown
+	}
+	p.published = append(p.published, id)
+	return nil
+}
+
+func newTestRelay(repo OutboxRepo, publishers ...EventPublisher) *outboxRelay {
+	cfg := &config.Config{}
+	cfg.Outbox = config.Outbox{OutboxBatchSize: 2, OutboxLease: time.Minute, OutboxMaxAttempts: 3}
+	return NewOutboxRelay(cfg, discardLogger(), repo, publishers...)
+}
+
+func newFailingPublisher(repo *fakeOutboxRepo, fail ...int64) *failingPublisher {
+	p := &failingPublisher{ids: make(map[string]int64), fail: make(map[int64]bool)}
+	for _, e := range repo.pending {
+		p.ids[e.Event.ID] = e.ID
+	}
+	for _, id := range fail {
+		p.fail[id] = true
+	}
+	return p
+}
+
+func TestOutboxRelayDispatchesAllBatches(t *testing.T) {
+	repo := newFakeOutboxRepo(5)
+	p := newFailingPublisher(repo)
+
+	if err := newTestRelay(repo, p).Dispatch(context.Background()); err != nil {
+		t.Fatalf("Dispatch() error = %v", err)
+	}
+
+	want := []int64{1, 2, 3, 4, 5}
+	if !slices.Equal(p.published, want) || !slices.Equal(repo.dispatched, want) {
+		t.Fatalf("published %v, dispatched %v, want %v", p.published, repo.dispatched, want)
+	}
+}
+
+func TestOutboxRelayStopsAtFailure(t *testing.T) {
+	repo := newFakeOutboxRepo(4)
+	p := newFailingPublisher(repo, 3)
+
+	err := newTestRelay(repo, p).Dispatch(context.Background())
+	if !errors.Is(err, errBrokerDown) {
+		t.Fatalf("Dispatch() = %v, want %v", err, errBrokerDown)
+	}
+
+	if !slices.Equal(repo.dispatched, []int64{1, 2}) {
+		t.Errorf("dispatched %v, want [1 2]", repo.dispatched)
+	}
+	if f := repo.failures[3]; f.park || f.lastErr == "" {
+		t.Errorf("failure of event 3 = %+v, want counted attempt", f)
+	}
+	// the failed event and the rest of its batch are pending again, in order
+	var pending []int64
+	for _, e := range repo.pending {
+		pending = append(pending, e.ID)
+	}
+	if !slices.Equal(pending, []int64{3, 4}) || len(repo.claimed) != 0 {
+		t.Errorf("pending %v, claimed %v, want [3 4] pending", pending, repo.claimed)
+	}
+}
+
+func TestOutboxRelayParksAfterMaxAttempts(t *testing.T) {
+	repo := newFakeOutboxRepo(3)
+	p := newFailingPublisher(repo, 2)
+	relay := newTestRelay(repo, p)
+
+	for i := 0; i < 3; i++ {
+		if err := relay.Dispatch(context.Background()); !errors.Is(err, errBrokerDown) {
+			t.Fatalf("Dispatch() = %v, want %v", err, errBrokerDown)
+		}
+	}
+	if !slices.Equal(repo.parked, []int64{2}) {
+		t.Fatalf("parked %v, want [2]", repo.parked)
+	}
+
+	// events after the parked one aren't blocked anymore
+	if err := relay.Dispatch(context.Background()); err != nil {
+		t.Fatalf("Dispatch() error = %v", err)
+	}
+	if !slices.Equal(repo.dispatched, []int64{1, 3}) {
+		t.Errorf("dispatched %v, want [1 3]", repo.dispatched)
+	}
+}
+
+func TestOutboxRelayPublishesToAllPublishers(t *testing.T) {
+	repo := newFakeOutboxRepo(2)
+	first, second := newFailingPublisher(repo), newFailingPublisher(repo, 2)
+
+	if err := newTestRelay(repo, first, second).Dispatch(context.Background()); !errors.Is(err, errBrokerDown) {
+		t.Fatalf("Dispatch() = %v, want %v", err, errBrokerDown)
+	}
+
+	// the event is dispatched only when every publisher accepts it
+	if !slices.Equal(repo.dispatched, []int64{1}) {
+		t.Errorf("dispatched %v, want [1]", repo.dispatched)
+	}
+	if !slices.Equal(first.published, []int64{1, 2}) || !slices.Equal(second.published, []int64{1}) {
+		t.Errorf("published %v and %v", first.published, second.published)
+	}
+}
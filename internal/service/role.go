@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-authentication/config"
+	"go-authentication/internal/apperrors"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/utils"
+	"log/slog"
+	"slices"
+)
+
+type roleService struct {
+	cfg *config.Config
+	log *slog.Logger
+
+	repo     RoleRepo
+	accounts AccountRepo
+}
+
+func NewRoleService(cfg *config.Config, log *slog.Logger, repo RoleRepo, accounts AccountRepo) *roleService {
+	return &roleService{cfg: cfg, log: log, repo: repo, accounts: accounts}
+}
+
+func (s *roleService) Roles(ctx context.Context, aid string) ([]string, error) {
+	const op = "roleservice.roles"
+
+	roles, err := s.repo.FindByAccount(ctx, aid)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return roles, nil
+}
+
+func (s *roleService) HasPermission(ctx context.Context, aid, permission string) (bool, error) {
+	const op = "roleservice.hasPermission"
+
+	perms, err := s.repo.FindPermissions(ctx, aid)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return slices.Contains(perms, permission), nil
+}
+
+func (s *roleService) Assign(ctx context.Context, aid, role string) error {
+	const op = "roleservice.assign"
+
+	if err := s.repo.Assign(ctx, aid, role); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.log.Info("role assigned",
+		slog.String(utils.Operation, op),
+		slog.String("account_id", aid),
+		slog.String("role", role))
+	return nil
+}
+
+func (s *roleService) Revoke(ctx context.Context, aid, role string) error {
+	const op = "roleservice.revoke"
+
+	if err := s.repo.Revoke(ctx, aid, role); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.log.Info("role revoked",
+		slog.String(utils.Operation, op),
+		slog.String("account_id", aid),
+		slog.String("role", role))
+	return nil
+}
+
+// SeedAdmin assigns admin role to the account with email from config,
+// it does nothing if the email is not set or the account is not registered yet.
+func (s *roleService) SeedAdmin(ctx context.Context) error {
+	const op = "roleservice.seedAdmin"
+	l := s.log.With(slog.String(utils.Operation, op))
+
+	if s.cfg.AdminEmail == "" {
+		return nil
+	}
+
+	acc, err := s.accounts.FindByEmail(ctx, s.cfg.AdminEmail)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrorAccountNotFound) {
+			l.Warn("admin account is not registered yet", slog.String("email", s.cfg.AdminEmail))
+			return nil
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = s.repo.Assign(ctx, acc.ID, domain.RoleAdmin); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	l.Info("admin role seeded", slog.String("account_id", acc.ID))
+	return nil
+}
@@ -2,16 +2,28 @@ package service
 
 import (
 	"context"
+	"crypto/hmac"
+	"errors"
 	"fmt"
 	"go-authentication/config"
 	"go-authentication/internal/apperrors"
 	"go-authentication/internal/domain"
+	"go-authentication/pkg/useragent"
+	"go-authentication/pkg/utils"
+	"log/slog"
+	"time"
 )
 
 type sessionService struct {
 	cfg *config.Config
+	log *slog.Logger
 
-	repo SessionRepo
+	repo     SessionRepo
+	remember RememberTokenRepo
+	events   EventBroker
+	geo      GeoLocator
+	audit    auditor
+	outbox   OutboxRepo
 }
 
 type Device struct {
@@ -19,29 +31,104 @@ type Device struct {
 	IP        string
 }
 
-func NewSessionService(cfg *config.Config, repo SessionRepo) *sessionService {
-	return &sessionService{cfg: cfg, repo: repo}
+// NewSessionService creates session service, geo is optional and may be nil.
+func NewSessionService(
+	cfg *config.Config,
+	log *slog.Logger,
+	repo SessionRepo,
+	remember RememberTokenRepo,
+	events EventBroker,
+	geo GeoLocator,
+	audit AuditRepo,
+	outbox OutboxRepo) *sessionService {
+
+	return &sessionService{
+		cfg:      cfg,
+		log:      log,
+		repo:     repo,
+		remember: remember,
+		events:   events,
+		geo:      geo,
+		audit:    newAuditor(log, audit),
+		outbox:   outbox,
+	}
 }
 
 func (s *sessionService) Create(ctx context.Context, aid, provider string, d Device) (domain.Session, error) {
 	const op = "sessionservice.create"
 
-	session, err := domain.NewSession(aid, provider, d.UserAgent, d.IP, s.cfg.Session.TTL)
+	session, err := domain.NewSession(s.cfg.Session.HashKey, aid, provider, d.UserAgent, d.IP, s.cfg.Session.TTL)
+	if err != nil {
+
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	session.Device, session.Location = s.describe(d)
+
+	session, err = s.repo.Create(ctx, session)
 	if err != nil {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	e := domain.NewEvent(domain.EventSessionCreated, aid)
+	e.SessionID = session.Handle
+	s.writeOutbox(ctx, e)
+
+	return session, nil
+}
+
+// Impersonate creates a short-lived session of account aid opened by admin impersonatorID from device d.
+func (s *sessionService) Impersonate(ctx context.Context, aid, impersonatorID string, d Device) (domain.Session, error) {
+	const op = "sessionservice.impersonate"
 
+	session, err := domain.NewSession(
+		s.cfg.Session.HashKey, aid, domain.ProviderImpersonation, d.UserAgent, d.IP, s.cfg.ImpersonationTTL)
+	if err != nil {
 		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err = s.repo.Create(ctx, session); err != nil {
+	session.ImpersonatorID = impersonatorID
+	session.Device, session.Location = s.describe(d)
+
+	session, err = s.repo.Create(ctx, session)
+	if err != nil {
 		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
 	}
+
+	e := domain.NewEvent(domain.EventSessionCreated, aid)
+	e.SessionID = session.Handle
+	s.writeOutbox(ctx, e)
+
 	return session, nil
 }
 
-func (s *sessionService) Get(ctx context.Context, sid string) (domain.Session, error) {
+// describe parses user agent and resolves location of the device,
+// location is left empty if geolocation is disabled or failed.
+func (s *sessionService) describe(d Device) (domain.Device, domain.Location) {
+	const op = "sessionservice.describe"
+
+	ua := useragent.Parse(d.UserAgent)
+	device := domain.Device{Browser: ua.Browser, OS: ua.OS, Type: ua.DeviceType}
+
+	if s.geo == nil {
+		return device, domain.Location{}
+	}
+
+	country, city, err := s.geo.Lookup(d.IP)
+	if err != nil {
+		s.log.Debug("can't resolve ip location",
+			slog.String(utils.Operation, op),
+			slog.String("error", err.Error()))
+		return device, domain.Location{}
+	}
+
+	return device, domain.Location{Country: country, City: city}
+}
+
+func (s *sessionService) Get(ctx context.Context, token string) (domain.Session, error) {
 	const op = "sessionservice.get"
 
-	session, err := s.repo.FindByID(ctx, sid)
+	session, err := s.repo.FindByToken(ctx, token)
 	if err != nil {
 		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
 	}
@@ -49,37 +136,247 @@ func (s *sessionService) Get(ctx context.Context, sid string) (domain.Session, e
 	return session, nil
 }
 
-func (s *sessionService) GetAll(ctx context.Context, aid string) ([]domain.Session, error) {
-	const op = "sessionservice.getall"
+func (s *sessionService) GetByAccount(ctx context.Context, aid, handle string) (domain.Session, error) {
+	const op = "sessionservice.getByAccount"
 
-	sessions, err := s.repo.FindAll(ctx, aid)
+	session, err := s.repo.FindByHandle(ctx, aid, handle)
 	if err != nil {
-		return []domain.Session{}, fmt.Errorf("%s: %w", op, err)
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return sessions, nil
+	return session, nil
+}
+
+func (s *sessionService) List(ctx context.Context, aid string, p domain.Pagination) ([]domain.Session, int64, error) {
+	const op = "sessionservice.list"
+
+	sessions, total, err := s.repo.FindAll(ctx, aid, p)
+	if err != nil {
+		return []domain.Session{}, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, total, nil
 }
 
-func (s *sessionService) Terminate(ctx context.Context, curSid string, reqSid string) error {
+func (s *sessionService) Terminate(ctx context.Context, aid, curSid, handle string) error {
 	const op = "sessionservice.terminate"
 
-	if curSid == reqSid {
+	if curSid == handle {
 		return fmt.Errorf("%s: %w", op, apperrors.ErrorCurrentSessionTerminating)
 	}
 
-	if err := s.repo.Delete(ctx, reqSid); err != nil {
+	err := s.repo.Delete(ctx, aid, handle)
+	s.audit.recordAction(ctx, domain.AuditSessionTerminated, aid, err, map[string]any{"sessionId": handle})
+	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	e := domain.NewEvent(domain.EventSessionTerminated, aid)
+	e.SessionID = handle
+	s.publish(ctx, e)
+	s.writeOutbox(ctx, e)
+
+	return nil
+}
+
+func (s *sessionService) Delete(ctx context.Context, aid, sid string) error {
+	const op = "sessionservice.delete"
+
+	if err := s.repo.Delete(ctx, aid, sid); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	e := domain.NewEvent(domain.EventSessionTerminated, aid)
+	e.SessionID = sid
+	s.writeOutbox(ctx, e)
+
 	return nil
 }
 
 func (s *sessionService) TerminateAll(ctx context.Context, aid, sid string) error {
 	const op = "sessionservice.terminateAll"
 
-	if err := s.repo.DeleteAll(ctx, aid, sid); err != nil {
+	err := s.repo.DeleteAll(ctx, aid, sid)
+	if err == nil {
+		// persistent login tokens would mint the terminated sessions again
+		err = s.remember.DeleteAll(ctx, aid)
+	}
+	s.audit.recordAction(ctx, domain.AuditSessionsTerminated, aid, err, map[string]any{"exceptSessionId": sid})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	e := domain.NewEvent(domain.EventSessionTerminated, aid)
+	e.ExceptSessionID = sid
+	s.publish(ctx, e)
+	s.writeOutbox(ctx, e)
+
+	return nil
+}
+
+func (s *sessionService) Rotate(ctx context.Context, session domain.Session) (domain.Session, error) {
+	const op = "sessionservice.rotate"
+
+	rotated, err := session.Rotated(s.cfg.Session.HashKey)
+	if err != nil {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rotated, err = s.repo.Rotate(ctx, session.ID, rotated)
+	if err != nil {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.log.Debug("session rotated",
+		slog.String(utils.Operation, op),
+		slog.String("handle", rotated.Handle))
+
+	return rotated, nil
+}
+
+func (s *sessionService) Remember(ctx context.Context, aid string) (string, error) {
+	const op = "sessionservice.remember"
+
+	t, err := domain.NewRememberToken(s.cfg.Session.HashKey, aid, s.cfg.RememberMe.RememberTTL)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = s.remember.Create(ctx, t); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return t.String(), nil
+}
+
+func (s *sessionService) Restore(ctx context.Context, rememberToken string, d Device) (domain.Session, string, error) {
+	const op = "sessionservice.restore"
+	l := s.log.With(slog.String(utils.Operation, op))
+
+	selector, validator, err := domain.ParseRememberToken(rememberToken)
+	if err != nil {
+		return domain.Session{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	t, err := s.remember.FindBySelector(ctx, selector)
+	if err != nil {
+		return domain.Session{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	hash := utils.HMACSHA256(s.cfg.Session.HashKey, validator)
+	newToken := ""
+
+	if hmac.Equal([]byte(hash), []byte(t.ValidatorHash)) {
+		next := t
+		if err = next.Rotate(s.cfg.Session.HashKey); err != nil {
+			return domain.Session{}, "", fmt.Errorf("%s: %w", op, err)
+		}
+
+		err = s.remember.Rotate(ctx, next)
+		switch {
+		case err == nil:
+			newToken = next.String()
+		case errors.Is(err, apperrors.ErrorRememberTokenNotFound):
+			// concurrent request of the same client rotated the token first,
+			// the reloaded token is checked against the grace period below
+			if t, err = s.remember.FindBySelector(ctx, selector); err != nil {
+				return domain.Session{}, "", fmt.Errorf("%s: %w", op, err)
+			}
+		default:
+			return domain.Session{}, "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	// a concurrent request of the same client rotated the token a moment ago,
+	// the client gets the new token from that response
+	inGrace := hmac.Equal([]byte(hash), []byte(t.PrevValidatorHash)) &&
+		time.Since(t.RotatedAt) < s.cfg.RememberMe.RememberReuseGrace
+
+	if newToken == "" && !inGrace {
+		// stale token is replayed, it might be stolen, so the whole series is revoked
+		l.Warn("remember token reuse detected, revoking series",
+			slog.String("account id", t.AccountID))
+
+		s.audit.recordAction(ctx, domain.AuditRememberTokenReuse, t.AccountID, apperrors.ErrorRememberTokenReused, nil)
+
+		if err = s.remember.Delete(ctx, selector); err != nil {
+			return domain.Session{}, "", fmt.Errorf("%s: %w", op, err)
+		}
+		return domain.Session{}, "", fmt.Errorf("%s: %w", op, apperrors.ErrorRememberTokenReused)
+	}
+
+	session, err := s.Create(ctx, t.AccountID, domain.ProviderRememberMe, d)
+	s.audit.recordAction(ctx, domain.AuditSessionRestored, t.AccountID, err, map[string]any{"sessionId": session.Handle})
+	if err != nil {
+		return domain.Session{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return session, newToken, nil
+}
+
+func (s *sessionService) Forget(ctx context.Context, rememberToken string) error {
+	const op = "sessionservice.forget"
+
+	selector, _, err := domain.ParseRememberToken(rememberToken)
+	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	if err = s.remember.Delete(ctx, selector); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
 	return nil
 }
+
+func (s *sessionService) Subscribe(ctx context.Context, aid, sid string) (<-chan domain.Event, error) {
+	const op = "sessionservice.subscribe"
+
+	events, err := s.events.Subscribe(ctx, aid)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	out := make(chan domain.Event)
+
+	go func() {
+		defer close(out)
+
+		for e := range events {
+			if !e.Targets(aid, sid) {
+				continue
+			}
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// publish sends event to subscribers, the failure is only logged since the change is already made.
+func (s *sessionService) publish(ctx context.Context, e domain.Event) {
+	const op = "sessionservice.publish"
+
+	if err := s.events.Publish(ctx, e); err != nil {
+		s.log.Error("can't publish event",
+			slog.String(utils.Operation, op),
+			slog.String("type", e.Type),
+			slog.String("error", err.Error()))
+	}
+}
+
+// writeOutbox writes the event to the outbox right after the change, since sessions
+// live outside of postgres, it can't be written atomically and failure is only logged.
+func (s *sessionService) writeOutbox(ctx context.Context, e domain.Event) {
+	const op = "sessionservice.writeOutbox"
+
+	if err := s.outbox.Add(ctx, e); err != nil {
+		s.log.Error("can't write outbox",
+			slog.String(utils.Operation, op),
+			slog.String("type", e.Type),
+			slog.String("error", err.Error()))
+	}
+}
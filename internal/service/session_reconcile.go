@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-authentication/config"
+	"go-authentication/internal/apperrors"
+	"go-authentication/pkg/utils"
+	"log/slog"
+	"time"
+)
+
+// sessionReconciler removes orphaned sessions whose account no longer exists,
+// they are left if revoking sessions of a deleted account fails.
+type sessionReconciler struct {
+	cfg      config.AccountDeletion
+	log      *slog.Logger
+	accounts AccountRepo
+	sessions SessionRepo
+}
+
+func NewSessionReconciler(cfg *config.Config, log *slog.Logger, accounts AccountRepo, sessions SessionRepo) *sessionReconciler {
+	return &sessionReconciler{
+		cfg:      cfg.AccountDeletion,
+		log:      log,
+		accounts: accounts,
+		sessions: sessions,
+	}
+}
+
+// Run removes orphaned sessions every check interval until ctx is canceled.
+func (s *sessionReconciler) Run(ctx context.Context) {
+	const op = "sessionreconciler.run"
+	l := s.log.With(slog.String(utils.Operation, op))
+
+	if s.cfg.OrphanCheckInterval <= 0 {
+		l.Info("orphaned sessions cleanup is disabled")
+		return
+	}
+
+	// sessions orphaned before the start are removed without waiting for the first tick
+	if !s.reconcile(ctx, l) {
+		return
+	}
+
+	t := time.NewTicker(s.cfg.OrphanCheckInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if !s.reconcile(ctx, l) {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reconcile runs Reconcile and logs its result, it returns false if the session store can't be reconciled.
+func (s *sessionReconciler) reconcile(ctx context.Context, l *slog.Logger) bool {
+	n, err := s.Reconcile(ctx)
+	if errors.Is(err, apperrors.ErrorSessionStoreUnsupported) {
+		l.Info("session store can't list sessions, orphaned sessions cleanup is stopped")
+		return false
+	}
+	if err != nil {
+		l.Error("can't remove orphaned sessions", slog.String("error", err.Error()))
+	}
+	if n > 0 {
+		l.Info("orphaned sessions removed", slog.Int("accounts", n))
+	}
+	return true
+}
+
+// Reconcile revokes sessions of all missing accounts and returns the number of such accounts.
+func (s *sessionReconciler) Reconcile(ctx context.Context) (int, error) {
+	const op = "sessionreconciler.reconcile"
+
+	removed := 0
+	after := ""
+	for {
+		ids, err := s.sessions.AccountIDs(ctx, after, s.cfg.OrphanCheckBatchSize)
+		if err != nil {
+			return removed, fmt.Errorf("%s: %w", op, err)
+		}
+		if len(ids) == 0 {
+			return removed, nil
+		}
+		after = ids[len(ids)-1]
+
+		missing, err := s.accounts.FindMissing(ctx, ids)
+		if err != nil {
+			return removed, fmt.Errorf("%s: %w", op, err)
+		}
+
+		for _, aid := range missing {
+			if err = s.sessions.DeleteAll(ctx, aid, ""); err != nil {
+				return removed, fmt.Errorf("%s: %w", op, err)
+			}
+			removed++
+		}
+
+		if len(ids) < s.cfg.OrphanCheckBatchSize {
+			return removed, nil
+		}
+	}
+}
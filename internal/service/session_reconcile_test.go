@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"go-authentication/config"
+	"go-authentication/internal/apperrors"
+	"go-authentication/internal/domain"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errStoreDown = errors.New("session store is down")
+
+// fakeSessionRepo keeps numbers of sessions by account id, DeleteAll fails the first failDeletes calls.
+type fakeSessionRepo struct {
+	SessionRepo
+
+	mu          sync.Mutex
+	sessions    map[string]int
+	failDeletes int
+	deleteCalls int
+	unsupported bool
+}
+
+func newFakeSessionRepo(aids ...string) *fakeSessionRepo {
+	r := &fakeSessionRepo{sessions: make(map[string]int)}
+	for _, aid := range aids {
+		r.sessions[aid]++
+	}
+	return r
+}
+
+func (r *fakeSessionRepo) DeleteAll(_ context.Context, aid, _ string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deleteCalls++
+	if r.deleteCalls <= r.failDeletes {
+		return errStoreDown
+	}
+	delete(r.sessions, aid)
+	return nil
+}
+
+func (r *fakeSessionRepo) AccountIDs(_ context.Context, afterAID string, limit int) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.unsupported {
+		return nil, apperrors.ErrorSessionStoreUnsupported
+	}
+
+	var ids []string
+	for aid := range r.sessions {
+		if aid > afterAID {
+			ids = append(ids, aid)
+		}
+	}
+	sort.Strings(ids)
+	return ids[:min(limit, len(ids))], nil
+}
+
+func (r *fakeSessionRepo) accountIDs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]string, 0, len(r.sessions))
+	for aid := range r.sessions {
+		ids = append(ids, aid)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func newTestReconciler(accounts AccountRepo, sessions SessionRepo) *sessionReconciler {
+	cfg := &config.Config{}
+	cfg.AccountDeletion = config.AccountDeletion{OrphanCheckInterval: time.Hour, OrphanCheckBatchSize: 2}
+	return NewSessionReconciler(cfg, discardLogger(), accounts, sessions)
+}
+
+func TestReconcileRemovesSessionsOfMissingAccounts(t *testing.T) {
+	accounts := newFakeAccountRepo(domain.Account{ID: "a"}, domain.Account{ID: "c"}, domain.Account{ID: "e"})
+	sessions := newFakeSessionRepo("a", "a", "b", "c", "d", "e", "f")
+
+	n, err := newTestReconciler(accounts, sessions).Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if n != 3 {
+		t.Errorf("Reconcile() = %d, want 3", n)
+	}
+	if got := sessions.accountIDs(); !slices.Equal(got, []string{"a", "c", "e"}) {
+		t.Errorf("accounts with sessions = %v, want [a c e]", got)
+	}
+}
+
+func TestReconcileStopsAtDeleteFailure(t *testing.T) {
+	accounts := newFakeAccountRepo()
+	sessions := newFakeSessionRepo("a", "b")
+	sessions.failDeletes = 1
+
+	n, err := newTestReconciler(accounts, sessions).Reconcile(context.Background())
+	if !errors.Is(err, errStoreDown) || n != 0 {
+		t.Fatalf("Reconcile() = %d, %v, want 0, %v", n, err, errStoreDown)
+	}
+
+	// the next run picks up what is left
+	if n, err = newTestReconciler(accounts, sessions).Reconcile(context.Background()); err != nil || n != 2 {
+		t.Fatalf("Reconcile() = %d, %v, want 2, nil", n, err)
+	}
+}
+
+func TestReconcilerRunsAtStart(t *testing.T) {
+	accounts := newFakeAccountRepo()
+	sessions := newFakeSessionRepo("a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		newTestReconciler(accounts, sessions).Run(ctx)
+		close(done)
+	}()
+
+	// the interval is an hour, only the run at start can remove the session
+	deadline := time.Now().Add(time.Second)
+	for len(sessions.accountIDs()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("orphaned sessions aren't removed at start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	<-done
+}
+
+func TestReconcilerStopsIfStoreIsUnsupported(t *testing.T) {
+	sessions := newFakeSessionRepo()
+	sessions.unsupported = true
+
+	done := make(chan struct{})
+	go func() {
+		newTestReconciler(newFakeAccountRepo(), sessions).Run(context.Background())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run() doesn't stop for unsupported session store")
+	}
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"go-authentication/config"
+	"go-authentication/internal/apperrors"
+	"go-authentication/internal/domain"
+	"go-authentication/pkg/utils"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// webhookService manages webhook subscriptions and sends queued deliveries.
+type webhookService struct {
+	cfg    config.Webhooks
+	log    *slog.Logger
+	repo   WebhookRepo
+	sender WebhookSender
+	audit  auditor
+}
+
+func NewWebhookService(
+	cfg *config.Config,
+	log *slog.Logger,
+	repo WebhookRepo,
+	sender WebhookSender,
+	audit AuditRepo) *webhookService {
+
+	return &webhookService{
+		cfg:    cfg.Webhooks,
+		log:    log,
+		repo:   repo,
+		sender: sender,
+		audit:  newAuditor(log, audit),
+	}
+}
+
+func (s *webhookService) Create(ctx context.Context, url string, events []string) (domain.Webhook, error) {
+	const op = "webhookservice.create"
+
+	if err := s.sender.CheckURL(ctx, url); err != nil {
+		return domain.Webhook{}, fmt.Errorf("%s: %w: %w", op, apperrors.ErrorWebhookURLForbidden, err)
+	}
+
+	w, err := domain.NewWebhook(url, events)
+	if err != nil {
+		return domain.Webhook{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	w, err = s.repo.Create(ctx, w)
+	s.audit.recordAction(ctx, domain.AuditAdminWebhookCreated, "", err, map[string]any{
+		"webhookId": w.ID,
+		"url":       url,
+		"events":    events,
+	})
+	if err != nil {
+		return domain.Webhook{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return w, nil
+}
+
+func (s *webhookService) List(ctx context.Context) ([]domain.Webhook, error) {
+	const op = "webhookservice.list"
+
+	webhooks, err := s.repo.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return webhooks, nil
+}
+
+func (s *webhookService) Get(ctx context.Context, id string) (domain.Webhook, error) {
+	const op = "webhookservice.get"
+
+	w, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return domain.Webhook{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return w, nil
+}
+
+func (s *webhookService) Delete(ctx context.Context, id string) error {
+	const op = "webhookservice.delete"
+
+	err := s.repo.Delete(ctx, id)
+	s.audit.recordAction(ctx, domain.AuditAdminWebhookDeleted, "", err, map[string]any{"webhookId": id})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *webhookService) Deliveries(ctx context.Context, id string, p domain.Pagination) ([]domain.WebhookDelivery, int64, error) {
+	const op = "webhookservice.deliveries"
+
+	if _, err := s.repo.FindByID(ctx, id); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deliveries, total, err := s.repo.FindDeliveries(ctx, id, p)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return deliveries, total, nil
+}
+
+// Publish queues the event for webhooks subscribed to it, it makes webhooks a publisher of the outbox.
+func (s *webhookService) Publish(ctx context.Context, e domain.Event) error {
+	const op = "webhookservice.publish"
+
+	if err := s.repo.Enqueue(ctx, e); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Run sends due deliveries every poll interval until ctx is canceled.
+func (s *webhookService) Run(ctx context.Context) {
+	const op = "webhookservice.run"
+	l := s.log.With(slog.String(utils.Operation, op))
+
+	if s.cfg.WebhookPollInterval <= 0 {
+		l.Info("webhook delivery is disabled")
+		return
+	}
+
+	t := time.NewTicker(s.cfg.WebhookPollInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if err := s.SendDue(ctx); err != nil {
+				l.Error("can't send webhooks", slog.String("error", err.Error()))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// SendDue sends a batch of due deliveries concurrently.
+func (s *webhookService) SendDue(ctx context.Context) error {
+	const op = "webhookservice.sendDue"
+
+	// the lease covers the request, so the delivery isn't sent twice by other instances
+	deliveries, err := s.repo.ClaimDue(ctx, s.cfg.WebhookBatchSize, 2*s.cfg.WebhookTimeout)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var wg sync.WaitGroup
+	for _, d := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.send(ctx, d)
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// send makes an attempt of the delivery and records its result.
+func (s *webhookService) send(ctx context.Context, d domain.WebhookDelivery) {
+	const op = "webhookservice.send"
+	l := s.log.With(
+		slog.String(utils.Operation, op),
+		slog.Int64("delivery_id", d.ID),
+		slog.String("webhook_id", d.WebhookID))
+
+	err := s.sender.Send(ctx, d.URL, d.Secret, d.EventID, d.EventType, d.Payload)
+	if err == nil {
+		if err = s.repo.MarkDelivered(ctx, d.ID); err != nil {
+			l.Error("can't mark delivery delivered", slog.String("error", err.Error()))
+		}
+		return
+	}
+
+	if d.Attempts >= s.cfg.WebhookMaxAttempts {
+		l.Warn("webhook delivery failed, giving up",
+			slog.Int("attempts", d.Attempts),
+			slog.String("error", err.Error()))
+		if err = s.repo.MarkFailed(ctx, d.ID, err.Error()); err != nil {
+			l.Error("can't mark delivery failed", slog.String("error", err.Error()))
+		}
+		return
+	}
+
+	next := time.Now().Add(s.backoff(d.Attempts))
+	l.Info("webhook delivery failed, retrying",
+		slog.Int("attempts", d.Attempts),
+		slog.Time("next_attempt_at", next),
+		slog.String("error", err.Error()))
+	if err = s.repo.Retry(ctx, d.ID, next, err.Error()); err != nil {
+		l.Error("can't schedule delivery retry", slog.String("error", err.Error()))
+	}
+}
+
+// backoff returns delay after given number of failed attempts.
+func (s *webhookService) backoff(attempts int) time.Duration {
+	delay := s.cfg.WebhookBackoffBase
+	for i := 1; i < attempts && delay < s.cfg.WebhookBackoffMax; i++ {
+		delay *= 2
+	}
+	return min(delay, s.cfg.WebhookBackoffMax)
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"go-authentication/config"
+	"go-authentication/internal/apperrors"
+	"go-authentication/internal/domain"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errReceiverDown = errors.New("receiver is down")
+
+type fakeWebhookSender struct {
+	mu     sync.Mutex
+	sent   []string
+	fail   map[string]bool
+	forbid bool
+}
+
+func (f *fakeWebhookSender) Send(_ context.Context, url, _, _, _ string, _ []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sent = append(f.sent, url)
+	if f.fail[url] {
+		return errReceiverDown
+	}
+	return nil
+}
+
+func (f *fakeWebhookSender) CheckURL(context.Context, string) error {
+	if f.forbid {
+		return errors.New("private address")
+	}
+	return nil
+}
+
+type webhookRetry struct {
+	next    time.Time
+	lastErr string
+}
+
+// fakeWebhookRepo records results of the deliveries it hands out.
+type fakeWebhookRepo struct {
+	WebhookRepo
+
+	mu        sync.Mutex
+	due       []domain.WebhookDelivery
+	created   int
+	delivered []int64
+	failed    []int64
+	retries   map[int64]webhookRetry
+}
+
+func (f *fakeWebhookRepo) Create(_ context.Context, w domain.Webhook) (domain.Webhook, error) {
+	f.created++
+	w.ID = "webhook-id"
+	return w, nil
+}
+
+func (f *fakeWebhookRepo) ClaimDue(context.Context, int, time.Duration) ([]domain.WebhookDelivery, error) {
+	due := f.due
+	f.due = nil
+	return due, nil
+}
+
+func (f *fakeWebhookRepo) MarkDelivered(_ context.Context, id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.delivered = append(f.delivered, id)
+	return nil
+}
+
+func (f *fakeWebhookRepo) Retry(_ context.Context, id int64, next time.Time, lastErr string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.retries[id] = webhookRetry{next: next, lastErr: lastErr}
+	return nil
+}
+
+func (f *fakeWebhookRepo) MarkFailed(_ context.Context, id int64, _ string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.failed = append(f.failed, id)
+	return nil
+}
+
+func newTestWebhookService(repo WebhookRepo, sender WebhookSender) *webhookService {
+	cfg := &config.Config{}
+	cfg.Webhooks = config.Webhooks{
+		WebhookBatchSize:   10,
+		WebhookTimeout:     time.Second,
+		WebhookMaxAttempts: 3,
+		WebhookBackoffBase: time.Minute,
+		WebhookBackoffMax:  5 * time.Minute,
+	}
+	return NewWebhookService(cfg, discardLogger(), repo, sender, &fakeAuditRepo{})
+}
+
+func TestWebhookSendDue(t *testing.T) {
+	repo := &fakeWebhookRepo{
+		retries: make(map[int64]webhookRetry),
+		due: []domain.WebhookDelivery{
+			{ID: 1, URL: "https://ok.example.com", Attempts: 1},
+			{ID: 2, URL: "https://down.example.com", Attempts: 2},
+			{ID: 3, URL: "https://down.example.com", Attempts: 3},
+		},
+	}
+	sender := &fakeWebhookSender{fail: map[string]bool{"https://down.example.com": true}}
+	s := newTestWebhookService(repo, sender)
+
+	start := time.Now()
+	if err := s.SendDue(context.Background()); err != nil {
+		t.Fatalf("SendDue() error = %v", err)
+	}
+
+	if len(sender.sent) != 3 {
+		t.Fatalf("sent %d deliveries, want 3", len(sender.sent))
+	}
+	if len(repo.delivered) != 1 || repo.delivered[0] != 1 {
+		t.Errorf("delivered = %v, want [1]", repo.delivered)
+	}
+
+	r, ok := repo.retries[2]
+	if !ok || len(repo.retries) != 1 {
+		t.Fatalf("retries = %v, want delivery 2 retried", repo.retries)
+	}
+	if r.lastErr != errReceiverDown.Error() {
+		t.Errorf("last error = %q", r.lastErr)
+	}
+	// the second failure doubles the base delay
+	if d := r.next.Sub(start); d < 2*time.Minute || d > 2*time.Minute+time.Second {
+		t.Errorf("next attempt in %s, want 2m", d)
+	}
+
+	// the last allowed attempt failed, the delivery isn't retried
+	if len(repo.failed) != 1 || repo.failed[0] != 3 {
+		t.Errorf("failed = %v, want [3]", repo.failed)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	s := newTestWebhookService(nil, nil)
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 5 * time.Minute},
+		{50, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := s.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookCreateRejectsForbiddenURL(t *testing.T) {
+	repo := &fakeWebhookRepo{}
+	s := newTestWebhookService(repo, &fakeWebhookSender{forbid: true})
+
+	_, err := s.Create(context.Background(), "http://169.254.169.254/", []string{domain.WebhookAllEvents})
+	if !errors.Is(err, apperrors.ErrorWebhookURLForbidden) {
+		t.Fatalf("Create() = %v, want %v", err, apperrors.ErrorWebhookURLForbidden)
+	}
+	if repo.created != 0 {
+		t.Fatal("forbidden webhook is stored")
+	}
+}
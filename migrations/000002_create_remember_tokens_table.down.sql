@@ -0,0 +1 @@
+drop table if exists remember_tokens;
\ No newline at end of file
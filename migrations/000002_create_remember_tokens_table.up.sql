@@ -0,0 +1,12 @@
+create table if not exists remember_tokens
+(
+    selector            varchar(32) primary key,
+    account_id          uuid                                               not null references accounts (id) on delete cascade,
+    validator_hash      varchar(64)                                        not null,
+    prev_validator_hash varchar(64)                                        not null default '',
+    rotated_at          timestamp with time zone default current_timestamp not null,
+    expires_at          timestamp with time zone                           not null,
+    created_at          timestamp with time zone default current_timestamp not null
+);
+
+create index if not exists remember_tokens_account_id_idx on remember_tokens (account_id);
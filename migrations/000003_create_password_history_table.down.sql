@@ -0,0 +1 @@
+drop table if exists password_history;
\ No newline at end of file
@@ -0,0 +1,9 @@
+create table if not exists password_history
+(
+    id            bigserial primary key,
+    account_id    uuid                                               not null references accounts (id) on delete cascade,
+    password_hash varchar(255)                                       not null,
+    created_at    timestamp with time zone default current_timestamp not null
+);
+
+create index if not exists password_history_account_id_idx on password_history (account_id, id desc);
@@ -0,0 +1,46 @@
+create table if not exists roles
+(
+    name        varchar(64) primary key,
+    description varchar(255)                                       not null default '',
+    created_at  timestamp with time zone default current_timestamp not null
+);
+
+create table if not exists permissions
+(
+    name        varchar(64) primary key,
+    description varchar(255) not null default ''
+);
+
+create table if not exists role_permissions
+(
+    role       varchar(64) not null references roles (name) on delete cascade,
+    permission varchar(64) not null references permissions (name) on delete cascade,
+    primary key (role, permission)
+);
+
+create table if not exists account_roles
+(
+    account_id uuid                                               not null references accounts (id) on delete cascade,
+    role       varchar(64)                                        not null references roles (name) on delete cascade,
+    created_at timestamp with time zone default current_timestamp not null,
+    primary key (account_id, role)
+);
+
+create index if not exists account_roles_role_idx on account_roles (role);
+
+insert into roles (name, description)
+values ('user', 'regular account'),
+       ('admin', 'operator of the service')
+on conflict do nothing;
+
+insert into permissions (name, description)
+values ('sessions:admin', 'view and terminate sessions of any account'),
+       ('accounts:admin', 'manage any account'),
+       ('roles:admin', 'assign and revoke roles')
+on conflict do nothing;
+
+insert into role_permissions (role, permission)
+values ('admin', 'sessions:admin'),
+       ('admin', 'accounts:admin'),
+       ('admin', 'roles:admin')
+on conflict do nothing;
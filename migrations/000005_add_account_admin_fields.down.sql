@@ -0,0 +1,5 @@
+drop index if exists accounts_created_at_idx;
+
+alter table accounts
+    drop column if exists locked_at,
+    drop column if exists password_reset_required;
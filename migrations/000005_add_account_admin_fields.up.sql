@@ -0,0 +1,5 @@
+alter table accounts
+    add column if not exists locked_at               timestamp with time zone,
+    add column if not exists password_reset_required boolean default false not null;
+
+create index if not exists accounts_created_at_idx on accounts (created_at);
@@ -0,0 +1,28 @@
+create table if not exists audit_events
+(
+    id         bigserial primary key,
+    type       varchar(64)                                        not null,
+    actor_id   uuid,
+    target_id  uuid,
+    ip         varchar(64)                                        not null default '',
+    user_agent varchar(512)                                       not null default '',
+    result     varchar(16)                                        not null,
+    details    jsonb                                              not null default '{}',
+    created_at timestamp with time zone default current_timestamp not null
+);
+
+create index if not exists audit_events_target_id_idx on audit_events (target_id, id desc);
+create index if not exists audit_events_actor_id_idx on audit_events (actor_id, id desc);
+
+create or replace function audit_events_append_only() returns trigger as
+$$
+begin
+    raise exception 'audit_events is append-only';
+end;
+$$ language plpgsql;
+
+create trigger audit_events_append_only
+    before update or delete
+    on audit_events
+    for each row
+execute function audit_events_append_only();
@@ -0,0 +1,7 @@
+insert into permissions (name, description)
+values ('accounts:impersonate', 'open a session of any account')
+on conflict do nothing;
+
+insert into role_permissions (role, permission)
+values ('admin', 'accounts:impersonate')
+on conflict do nothing;
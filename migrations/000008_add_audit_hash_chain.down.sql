@@ -0,0 +1,5 @@
+drop table if exists audit_checkpoints;
+
+alter table audit_events
+    drop column if exists prev_hash,
+    drop column if exists hash;
@@ -0,0 +1,28 @@
+-- events written before the chain was introduced stay unchained
+alter table audit_events
+    add column if not exists prev_hash varchar(64),
+    add column if not exists hash      varchar(64);
+
+create table if not exists audit_checkpoints
+(
+    id         bigserial primary key,
+    event_id   bigint                                             not null,
+    hash       varchar(64)                                        not null,
+    signature  varchar(64)                                        not null,
+    created_at timestamp with time zone default current_timestamp not null
+);
+
+create index if not exists audit_checkpoints_event_id_idx on audit_checkpoints (event_id);
+
+create or replace function audit_events_append_only() returns trigger as
+$$
+begin
+    raise exception '% is append-only', tg_table_name;
+end;
+$$ language plpgsql;
+
+create trigger audit_checkpoints_append_only
+    before update or delete
+    on audit_checkpoints
+    for each row
+execute function audit_events_append_only();
@@ -0,0 +1,4 @@
+delete from permissions where name = 'webhooks:admin';
+
+drop table if exists webhook_deliveries;
+drop table if exists webhooks;
@@ -0,0 +1,37 @@
+create table if not exists webhooks
+(
+    id         uuid primary key         default gen_random_uuid(),
+    url        varchar(2048)                                      not null,
+    secret     varchar(128)                                       not null,
+    events     text[]                                             not null default '{}',
+    active     boolean                                            not null default true,
+    created_at timestamp with time zone default current_timestamp not null,
+    updated_at timestamp with time zone default current_timestamp not null
+);
+
+-- deliveries are written in the transaction of the change, so they also serve as the outbox
+create table if not exists webhook_deliveries
+(
+    id              bigserial primary key,
+    webhook_id      uuid                                               not null references webhooks (id) on delete cascade,
+    event_id        uuid                                               not null,
+    event_type      varchar(64)                                        not null,
+    payload         jsonb                                              not null,
+    status          varchar(16)                                        not null default 'pending',
+    attempts        integer                                            not null default 0,
+    next_attempt_at timestamp with time zone default current_timestamp not null,
+    last_error      text                                               not null default '',
+    created_at      timestamp with time zone default current_timestamp not null,
+    delivered_at    timestamp with time zone
+);
+
+create index if not exists webhook_deliveries_due_idx on webhook_deliveries (next_attempt_at) where status = 'pending';
+create index if not exists webhook_deliveries_webhook_id_idx on webhook_deliveries (webhook_id, id desc);
+
+insert into permissions (name, description)
+values ('webhooks:admin', 'manage webhook subscriptions')
+on conflict do nothing;
+
+insert into role_permissions (role, permission)
+values ('admin', 'webhooks:admin')
+on conflict do nothing;
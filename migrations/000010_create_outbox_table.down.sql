@@ -0,0 +1,3 @@
+drop index if exists webhook_deliveries_event_idx;
+
+drop table if exists outbox;
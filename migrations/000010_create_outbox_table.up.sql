@@ -0,0 +1,15 @@
+create table if not exists outbox
+(
+    id            bigserial primary key,
+    event_id      uuid                                               not null unique,
+    type          varchar(64)                                        not null,
+    payload       jsonb                                              not null,
+    created_at    timestamp with time zone default current_timestamp not null,
+    dispatched_at timestamp with time zone
+);
+
+create index if not exists outbox_pending_idx on outbox (id) where dispatched_at is null;
+create index if not exists outbox_dispatched_at_idx on outbox (dispatched_at) where dispatched_at is not null;
+
+-- the relay publishes at least once, a republished event must not be delivered to a webhook twice
+create unique index if not exists webhook_deliveries_event_idx on webhook_deliveries (webhook_id, event_id);
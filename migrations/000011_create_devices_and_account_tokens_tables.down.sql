@@ -0,0 +1,2 @@
+drop table if exists account_tokens;
+drop table if exists known_devices;
@@ -0,0 +1,26 @@
+create table if not exists known_devices
+(
+    account_id    uuid                                               not null references accounts (id) on delete cascade,
+    fingerprint   varchar(64)                                        not null,
+    browser       varchar(64)                                        not null default '',
+    os            varchar(64)                                        not null default '',
+    ip            varchar(64)                                        not null default '',
+    first_seen_at timestamp with time zone default current_timestamp not null,
+    last_seen_at  timestamp with time zone default current_timestamp not null,
+    primary key (account_id, fingerprint)
+);
+
+-- one-time tokens sent to the account owner, e.g. in password reset links
+create table if not exists account_tokens
+(
+    token_hash  varchar(64) primary key,
+    purpose     varchar(32)                                        not null,
+    account_id  uuid                                               not null references accounts (id) on delete cascade,
+    session_id  varchar(64)                                        not null default '',
+    device_id   varchar(64)                                        not null default '',
+    expires_at  timestamp with time zone                           not null,
+    used_at     timestamp with time zone,
+    created_at  timestamp with time zone default current_timestamp not null
+);
+
+create index if not exists account_tokens_account_id_idx on account_tokens (account_id, purpose);
@@ -0,0 +1,2 @@
+drop trigger if exists audit_checkpoints_no_truncate on audit_checkpoints;
+drop trigger if exists audit_events_no_truncate on audit_events;
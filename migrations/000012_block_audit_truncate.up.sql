@@ -0,0 +1,12 @@
+-- row triggers don't fire on truncate, it is blocked by statement triggers
+create trigger audit_events_no_truncate
+    before truncate
+    on audit_events
+    for each statement
+execute function audit_events_append_only();
+
+create trigger audit_checkpoints_no_truncate
+    before truncate
+    on audit_checkpoints
+    for each statement
+execute function audit_events_append_only();
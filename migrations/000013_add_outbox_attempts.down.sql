@@ -0,0 +1,8 @@
+drop index if exists outbox_pending_idx;
+create index if not exists outbox_pending_idx on outbox (id) where dispatched_at is null;
+
+alter table outbox
+    drop column if exists attempts,
+    drop column if exists last_error,
+    drop column if exists locked_until,
+    drop column if exists parked_at;
@@ -0,0 +1,9 @@
+-- events failing max attempts are parked, they are kept for inspection and aren't published anymore
+alter table outbox
+    add column if not exists attempts     integer default 0  not null,
+    add column if not exists last_error   text    default '' not null,
+    add column if not exists locked_until timestamp with time zone,
+    add column if not exists parked_at    timestamp with time zone;
+
+drop index if exists outbox_pending_idx;
+create index if not exists outbox_pending_idx on outbox (id) where dispatched_at is null and parked_at is null;
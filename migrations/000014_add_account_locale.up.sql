@@ -0,0 +1,3 @@
+-- locale of emails to the account, empty for the default locale
+alter table accounts
+    add column if not exists locale varchar(35) default '' not null;
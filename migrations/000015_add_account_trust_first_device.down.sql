@@ -0,0 +1,2 @@
+alter table accounts
+    drop column if exists trust_first_device;
@@ -0,0 +1,7 @@
+-- the first device of an account is where it signed up and isn't alerted, accounts which existed
+-- before devices were remembered have logged in from elsewhere, so their first remembered login is alerted
+alter table accounts
+    add column if not exists trust_first_device boolean default false not null;
+
+alter table accounts
+    alter column trust_first_device set default true;
@@ -3,6 +3,7 @@ package JWT
 import (
 	"github.com/golang-jwt/jwt"
 	"go-authentication/internal/apperrors"
+	"go-authentication/internal/domain"
 	"time"
 )
 
@@ -19,33 +20,46 @@ func New(signingKey string, ttl time.Duration) (jwtToken, error) {
 	return jwtToken{signingKey: signingKey, ttl: ttl}, nil
 }
 
+// claims are registered claims and the roles of the subject
+type claims struct {
+	jwt.StandardClaims
+	Roles []string `json:"roles,omitempty"`
+	// Impersonator is an id of the admin acting on behalf of the subject
+	Impersonator string `json:"imp,omitempty"`
+}
+
 // New creates new JWT token with claims and subject in payload
-func (j jwtToken) New(sub string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
-		Subject:   sub,
-		ExpiresAt: time.Now().Add(j.ttl).Unix(),
+func (j jwtToken) New(c domain.AccessClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   c.Subject,
+			ExpiresAt: time.Now().Add(j.ttl).Unix(),
+		},
+		Roles:        c.Roles,
+		Impersonator: c.Impersonator,
 	})
 
 	return token.SignedString([]byte(j.signingKey))
 }
 
-// Parse parses and validating JWT token, returns subject
-func (j jwtToken) Parse(token string) (string, error) {
-	t, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
+// Parse parses and validating JWT token, returns its claims
+func (j jwtToken) Parse(token string) (domain.AccessClaims, error) {
+	var c claims
+
+	t, err := jwt.ParseWithClaims(token, &c, func(t *jwt.Token) (interface{}, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, apperrors.ErrUnexpectedSignMethod
 		}
 		return []byte(j.signingKey), nil
 	})
 	if err != nil {
-		return "", err
+		return domain.AccessClaims{}, err
 	}
 
-	claims, ok := t.Claims.(jwt.MapClaims)
-	if !ok && !t.Valid {
-		return "", apperrors.ErrNoClaims
+	if !t.Valid || c.Subject == "" {
+		return domain.AccessClaims{}, apperrors.ErrNoClaims
 	}
-	return claims["sub"].(string), nil
+	return domain.AccessClaims{Subject: c.Subject, Roles: c.Roles, Impersonator: c.Impersonator}, nil
 }
 
 //func (maker *JWTMaker) VerifyToken(token string) (*Payload, error) {
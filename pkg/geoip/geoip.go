@@ -0,0 +1,48 @@
+package geoip
+
+import (
+	"fmt"
+	"github.com/oschwald/geoip2-golang"
+	"net"
+)
+
+const _lang = "en"
+
+// Resolver resolves ip addresses to location using local MaxMind-format database.
+type Resolver struct {
+	db *geoip2.Reader
+}
+
+// New opens .mmdb database file located by path.
+func New(path string) (*Resolver, error) {
+	const op = "geoip.new"
+
+	db, err := geoip2.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &Resolver{db: db}, nil
+}
+
+// Lookup returns english names of country and city of given ip address,
+// empty strings are returned if location is unknown.
+func (r *Resolver) Lookup(ip string) (country string, city string, err error) {
+	const op = "geoip.lookup"
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", "", fmt.Errorf("%s: invalid ip address %q", op, ip)
+	}
+
+	rec, err := r.db.City(parsed)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return rec.Country.Names[_lang], rec.City.Names[_lang], nil
+}
+
+// Close -.
+func (r *Resolver) Close() error {
+	return r.db.Close()
+}
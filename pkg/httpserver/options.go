@@ -15,6 +15,13 @@ func Port(port string) Option {
 	}
 }
 
+// Addr -.
+func Addr(addr string) Option {
+	return func(s *Server) {
+		s.server.Addr = addr
+	}
+}
+
 // ReadTimeout -.
 func ReadTimeout(timeout time.Duration) Option {
 	return func(s *Server) {
@@ -0,0 +1,127 @@
+// Package mail builds MIME messages and sends them over SMTP.
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message is an email with plaintext and optional HTML alternative.
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+	// Headers are additional headers of the message.
+	Headers map[string]string
+}
+
+// Bytes encodes the message in RFC 5322 format with quoted-printable UTF-8 parts.
+func (m Message) Bytes() ([]byte, error) {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return nil, fmt.Errorf("mail: from: %w", err)
+	}
+
+	to := make([]string, 0, len(m.To))
+	for _, rcpt := range m.To {
+		a, err := mail.ParseAddress(rcpt)
+		if err != nil {
+			return nil, fmt.Errorf("mail: to: %w", err)
+		}
+		to = append(to, a.String())
+	}
+
+	var b bytes.Buffer
+
+	h := textproto.MIMEHeader{}
+	h.Set("From", from.String())
+	h.Set("To", strings.Join(to, ", "))
+	h.Set("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	h.Set("Date", time.Now().Format(time.RFC1123Z))
+	h.Set("Message-Id", messageID(from.Address))
+	h.Set("MIME-Version", "1.0")
+	for k, v := range m.Headers {
+		h.Set(k, mime.QEncoding.Encode("utf-8", v))
+	}
+
+	if m.HTML == "" {
+		h.Set("Content-Type", "text/plain; charset=utf-8")
+		h.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeHeader(&b, h)
+		if err = writeQP(&b, m.Text); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&b)
+	h.Set("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	writeHeader(&b, h)
+
+	// the last part is the preferred one
+	for _, p := range []struct{ typ, body string }{{"text/plain", m.Text}, {"text/html", m.HTML}} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.typ + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("mail: %w", err)
+		}
+		if err = writeQP(pw, p.body); err != nil {
+			return nil, err
+		}
+	}
+	if err = mw.Close(); err != nil {
+		return nil, fmt.Errorf("mail: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+func writeHeader(b *bytes.Buffer, h textproto.MIMEHeader) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		for _, v := range h[k] {
+			b.WriteString(k + ": " + v + "\r\n")
+		}
+	}
+	b.WriteString("\r\n")
+}
+
+func writeQP(w interface{ Write([]byte) (int, error) }, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(s)); err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	if err := qp.Close(); err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	return nil
+}
+
+func messageID(from string) string {
+	_, domain, _ := strings.Cut(from, "@")
+	if domain == "" {
+		domain = "localhost"
+	}
+
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
@@ -0,0 +1,141 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// Connection security modes.
+const (
+	SecurityNone     = "none"
+	SecurityStartTLS = "starttls"
+	// SecurityTLS is an implicit TLS, usually on port 465.
+	SecurityTLS = "tls"
+)
+
+// SMTP sends messages through an SMTP server, a connection is opened per message.
+type SMTP struct {
+	addr     string
+	host     string
+	username string
+	password string
+	security string
+	timeout  time.Duration
+}
+
+// NewSMTP creates SMTP client, authentication is skipped if username is empty.
+// Plain authentication is refused over unencrypted connection to hosts other than localhost.
+func NewSMTP(host string, port int, username, password, security string, timeout time.Duration) *SMTP {
+	return &SMTP{
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		host:     host,
+		username: username,
+		password: password,
+		security: security,
+		timeout:  timeout,
+	}
+}
+
+// Send sends the message to its recipients.
+func (s *SMTP) Send(ctx context.Context, m Message) error {
+	body, err := m.Bytes()
+	if err != nil {
+		return err
+	}
+
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("mail: from: %w", err)
+	}
+	rcpts := make([]string, 0, len(m.To))
+	for _, to := range m.To {
+		a, err := mail.ParseAddress(to)
+		if err != nil {
+			return fmt.Errorf("mail: to: %w", err)
+		}
+		rcpts = append(rcpts, a.Address)
+	}
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	// the deadline covers the whole session
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err = conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return fmt.Errorf("mail: %w", err)
+	}
+
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("mail: %w", err)
+	}
+	defer c.Close()
+
+	if err = s.send(c, from.Address, rcpts, body); err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	return nil
+}
+
+func (s *SMTP) dial(ctx context.Context) (net.Conn, error) {
+	d := &net.Dialer{Timeout: s.timeout}
+	if s.security == SecurityTLS {
+		td := &tls.Dialer{NetDialer: d, Config: s.tlsConfig()}
+		return td.DialContext(ctx, "tcp", s.addr)
+	}
+	return d.DialContext(ctx, "tcp", s.addr)
+}
+
+func (s *SMTP) tlsConfig() *tls.Config {
+	return &tls.Config{ServerName: s.host, MinVersion: tls.VersionTLS12}
+}
+
+func (s *SMTP) send(c *smtp.Client, from string, rcpts []string, body []byte) error {
+	if s.security == SecurityStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("server %s doesn't support STARTTLS", s.addr)
+		}
+		if err := c.StartTLS(s.tlsConfig()); err != nil {
+			return err
+		}
+	}
+
+	if s.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range rcpts {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(body); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
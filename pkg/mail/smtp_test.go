@@ -0,0 +1,195 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer is a minimal SMTP server which records received envelopes.
+type fakeSMTPServer struct {
+	ln net.Listener
+	// rejectRcpt makes the server reject RCPT TO commands.
+	rejectRcpt bool
+
+	mu    sync.Mutex
+	auth  string
+	from  string
+	rcpts []string
+	data  string
+}
+
+func newFakeSMTPServer(t *testing.T, rejectRcpt bool) *fakeSMTPServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &fakeSMTPServer{ln: ln, rejectRcpt: rejectRcpt}
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 localhost ESMTP")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+
+		s.mu.Lock()
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			_ = tp.PrintfLine("250-localhost")
+			_ = tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			s.auth = arg
+			_ = tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			s.from = arg
+			_ = tp.PrintfLine("250 ok")
+		case "RCPT":
+			if s.rejectRcpt {
+				_ = tp.PrintfLine("550 no such user")
+				break
+			}
+			s.rcpts = append(s.rcpts, arg)
+			_ = tp.PrintfLine("250 ok")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			b, err := tp.ReadDotBytes()
+			if err != nil {
+				s.mu.Unlock()
+				return
+			}
+			s.data = string(b)
+			_ = tp.PrintfLine("250 queued")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			s.mu.Unlock()
+			return
+		default:
+			_ = tp.PrintfLine("502 not implemented")
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *fakeSMTPServer) received() (auth, from string, rcpts []string, data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.auth, s.from, s.rcpts, s.data
+}
+
+func testMessage() Message {
+	return Message{
+		From:    "App <noreply@example.com>",
+		To:      []string{"Bob <bob@example.com>"},
+		Subject: "Hello",
+		Text:    "Hello, Bob",
+	}
+}
+
+func TestSMTPSend(t *testing.T) {
+	srv := newFakeSMTPServer(t, false)
+	c := NewSMTP("127.0.0.1", srv.port(), "user", "pass", SecurityNone, time.Second)
+
+	if err := c.Send(context.Background(), testMessage()); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	auth, from, rcpts, data := srv.received()
+	if auth == "" {
+		t.Error("client didn't authenticate")
+	}
+	if from != "FROM:<noreply@example.com>" {
+		t.Errorf("MAIL %s, want FROM:<noreply@example.com>", from)
+	}
+	if len(rcpts) != 1 || rcpts[0] != "TO:<bob@example.com>" {
+		t.Errorf("RCPT %v, want [TO:<bob@example.com>]", rcpts)
+	}
+	if !strings.Contains(data, "Subject: Hello") || !strings.Contains(data, "Hello, Bob") {
+		t.Errorf("message is not delivered:\n%s", data)
+	}
+}
+
+func TestSMTPSendWithoutAuth(t *testing.T) {
+	srv := newFakeSMTPServer(t, false)
+	c := NewSMTP("127.0.0.1", srv.port(), "", "", SecurityNone, time.Second)
+
+	if err := c.Send(context.Background(), testMessage()); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	if auth, _, _, _ := srv.received(); auth != "" {
+		t.Errorf("client authenticated with %q, want no authentication", auth)
+	}
+}
+
+func TestSMTPSendRejected(t *testing.T) {
+	srv := newFakeSMTPServer(t, true)
+	c := NewSMTP("127.0.0.1", srv.port(), "", "", SecurityNone, time.Second)
+
+	if err := c.Send(context.Background(), testMessage()); err == nil {
+		t.Fatal("Send() error = nil, want rejected recipient")
+	}
+
+	if _, _, _, data := srv.received(); data != "" {
+		t.Errorf("message is delivered to rejected recipient:\n%s", data)
+	}
+}
+
+func TestSMTPSendStartTLSUnsupported(t *testing.T) {
+	srv := newFakeSMTPServer(t, false)
+	c := NewSMTP("127.0.0.1", srv.port(), "user", "pass", SecurityStartTLS, time.Second)
+
+	if err := c.Send(context.Background(), testMessage()); err == nil {
+		t.Fatal("Send() error = nil, want STARTTLS error")
+	}
+
+	if auth, _, _, _ := srv.received(); auth != "" {
+		t.Error("credentials are sent without STARTTLS")
+	}
+}
+
+func TestSMTPSendUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	c := NewSMTP("127.0.0.1", port, "", "", SecurityNone, time.Second)
+	if err = c.Send(context.Background(), testMessage()); err == nil {
+		t.Fatal("Send() error = nil, want connection error")
+	}
+}
@@ -0,0 +1,81 @@
+package passpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// BreachedList is an offline list of SHA-1 hashes of breached passwords.
+// Entries may be truncated to a prefix to keep the list small,
+// a password is breached if its hash starts with any entry.
+type BreachedList struct {
+	// prefixes are entries grouped by length
+	prefixes map[int]map[string]struct{}
+}
+
+// LoadBreachedList reads the list from a file with one hex encoded hash or hash prefix per line,
+// the rest of the line after ':' is ignored, so files in "HASH:COUNT" format can be used as is.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	const op = "passpolicy.LoadBreachedList"
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer f.Close()
+
+	l := &BreachedList{prefixes: make(map[int]map[string]struct{})}
+
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			line = line[:i]
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.ToUpper(line)
+		if len(line) > sha1.Size*2 {
+			return nil, fmt.Errorf("%s: line %d: hash is too long", op, n)
+		}
+		if _, err = hex.DecodeString(line + strings.Repeat("0", len(line)%2)); err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", op, n, err)
+		}
+
+		if l.prefixes[len(line)] == nil {
+			l.prefixes[len(line)] = make(map[string]struct{})
+		}
+		l.prefixes[len(line)][line] = struct{}{}
+	}
+	if err = s.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return l, nil
+}
+
+func (l *BreachedList) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	h := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	for n, set := range l.prefixes {
+		if _, ok := set[h[:n]]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns number of entries in the list.
+func (l *BreachedList) Len() int {
+	n := 0
+	for _, set := range l.prefixes {
+		n += len(set)
+	}
+	return n
+}
@@ -0,0 +1,106 @@
+package passpolicy
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Violation codes.
+const (
+	CodeTooShort          = "too_short"
+	CodeTooLong           = "too_long"
+	CodeTooWeak           = "too_weak"
+	CodeContainsUserInput = "contains_user_input"
+	CodeBreached          = "breached"
+	// CodeReused is reported by callers which keep password history.
+	CodeReused = "reused"
+)
+
+// _minUserInputLen is a min length of user input which is looked for in the password.
+const _minUserInputLen = 3
+
+// Violation is a failed rule of the policy.
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Policy checks passwords, zero value of a field disables its rule.
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// MinScore is a min strength score from 0 to 4, see Score.
+	MinScore int
+	// RejectUserInputs rejects passwords containing any of the user inputs.
+	RejectUserInputs bool
+	Breached         *BreachedList
+}
+
+// Check returns all violated rules, userInputs are user data like email or username.
+// Too long password is reported alone, scoring of it would take too long.
+func (p Policy) Check(password string, userInputs ...string) []Violation {
+	var v []Violation
+
+	n := utf8.RuneCountInString(password)
+	if p.MaxLength > 0 && n > p.MaxLength {
+		return []Violation{{
+			Code:    CodeTooLong,
+			Message: fmt.Sprintf("password must be at most %d characters long", p.MaxLength),
+		}}
+	}
+	if p.MinLength > 0 && n < p.MinLength {
+		v = append(v, Violation{
+			Code:    CodeTooShort,
+			Message: fmt.Sprintf("password must be at least %d characters long", p.MinLength),
+		})
+	}
+
+	inputs := splitUserInputs(userInputs)
+
+	if p.RejectUserInputs && containsAny(strings.ToLower(password), inputs) {
+		v = append(v, Violation{
+			Code:    CodeContainsUserInput,
+			Message: "password must not contain your email or username",
+		})
+	}
+	if p.MinScore > 0 && Score(password, inputs...) < p.MinScore {
+		v = append(v, Violation{
+			Code:    CodeTooWeak,
+			Message: "password is too easy to guess",
+		})
+	}
+	if p.Breached != nil && p.Breached.Contains(password) {
+		v = append(v, Violation{
+			Code:    CodeBreached,
+			Message: "password has appeared in a data breach",
+		})
+	}
+	return v
+}
+
+// splitUserInputs returns lowercased inputs, emails are added with their local part.
+func splitUserInputs(inputs []string) []string {
+	res := make([]string, 0, len(inputs)*2)
+	for _, in := range inputs {
+		in = strings.ToLower(in)
+		if in == "" {
+			continue
+		}
+		res = append(res, in)
+
+		if local, _, ok := strings.Cut(in, "@"); ok {
+			res = append(res, local)
+		}
+	}
+	return res
+}
+
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if utf8.RuneCountInString(sub) >= _minUserInputLen && strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package passpolicy
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckReportsTooLongWithoutScoring(t *testing.T) {
+	p := Policy{MinLength: 8, MaxLength: 64, MinScore: 2, RejectUserInputs: true}
+
+	start := time.Now()
+	v := p.Check(strings.Repeat("Ab1!", 500), "user@example.com")
+
+	if len(v) != 1 || v[0].Code != CodeTooLong {
+		t.Fatalf("Check() = %v, want only %s", v, CodeTooLong)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Fatalf("Check() took %s", d)
+	}
+}
+
+func TestScoreBoundsWork(t *testing.T) {
+	start := time.Now()
+	Score(strings.Repeat("x9#", 1000))
+
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Score() took %s", d)
+	}
+}
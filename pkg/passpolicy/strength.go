@@ -0,0 +1,281 @@
+package passpolicy
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"unicode"
+)
+
+//go:embed common.txt
+var _commonList string
+
+// _common maps common passwords and words to their rank, the most common first.
+var _common = func() map[string]int {
+	m := make(map[string]int)
+	for i, w := range strings.Fields(_commonList) {
+		if _, ok := m[w]; !ok {
+			m[w] = i + 1
+		}
+	}
+	return m
+}()
+
+var _leet = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i',
+	'|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+var _keyboardRows = []string{
+	"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./",
+}
+
+const (
+	// _maxDictLen is a max length of a dictionary match.
+	_maxDictLen = 24
+	// _userInputRank is a rank of user inputs in the dictionary, they are guessed first.
+	_userInputRank = 1
+	// _maxScoredLen bounds the work of scoring which grows as cube of the length,
+	// only the prefix of longer passwords is scored, so their score is underestimated.
+	_maxScoredLen = 128
+)
+
+// Score estimates password strength from 0 (too guessable) to 4 (very unguessable) like zxcvbn does:
+// the password is split into patterns (common words, user inputs, repeats, sequences, keyboard runs, years)
+// so that the total number of guesses is minimal, the score is derived from the number of guesses.
+func Score(password string, userInputs ...string) int {
+	pw := []rune(password)
+	if len(pw) > _maxScoredLen {
+		pw = pw[:_maxScoredLen]
+	}
+
+	g := log10Guesses(pw, userDict(userInputs))
+
+	switch {
+	case g < 3:
+		return 0
+	case g < 6:
+		return 1
+	case g < 8:
+		return 2
+	case g < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func userDict(inputs []string) map[string]int {
+	d := make(map[string]int, len(inputs))
+	for _, in := range inputs {
+		in = strings.ToLower(in)
+		if len(in) >= 3 {
+			d[in] = _userInputRank
+		}
+	}
+	return d
+}
+
+// log10Guesses returns log10 of the minimal number of guesses needed to find the password.
+func log10Guesses(pw []rune, user map[string]int) float64 {
+	n := len(pw)
+	if n == 0 {
+		return 0
+	}
+
+	// best[i] is the minimal log10 guesses of pw[:i]
+	best := make([]float64, n+1)
+	for i := 1; i <= n; i++ {
+		best[i] = math.Inf(1)
+		for j := 0; j < i; j++ {
+			if g := best[j] + segmentGuesses(pw[j:i], user); g < best[i] {
+				best[i] = g
+			}
+		}
+	}
+	return best[n]
+}
+
+// segmentGuesses returns log10 of guesses of the segment as the cheapest matching pattern.
+func segmentGuesses(s []rune, user map[string]int) float64 {
+	g := bruteforceGuesses(s)
+
+	if len(s) < 3 {
+		return g
+	}
+	if d, ok := dictGuesses(s, user); ok {
+		g = math.Min(g, d)
+	}
+	if isRepeat(s) {
+		g = math.Min(g, math.Log10(float64(cardinality(s[:1])*len(s))))
+	}
+	if isSequence(s) {
+		g = math.Min(g, math.Log10(float64(cardinality(s[:1])*len(s))))
+	}
+	if len(s) >= 4 && isKeyboardRun(s) {
+		g = math.Min(g, math.Log10(float64(len(_keyboardRows)*2*len(s)*10)))
+	}
+	if isYear(s) {
+		g = math.Min(g, math.Log10(150))
+	}
+	return g
+}
+
+func bruteforceGuesses(s []rune) float64 {
+	return float64(len(s)) * math.Log10(float64(cardinality(s)))
+}
+
+// dictGuesses matches the segment against common words and user inputs
+// taking into account capitalization, l33t substitutions and reversal.
+func dictGuesses(s []rune, user map[string]int) (float64, bool) {
+	if len(s) > _maxDictLen {
+		return 0, false
+	}
+
+	lower := strings.ToLower(string(s))
+	variants := []struct {
+		word  string
+		extra float64
+	}{
+		{lower, 0},
+		{unleet(lower), 1},
+		{reverse(lower), math.Log10(2)},
+	}
+
+	found := false
+	g := math.Inf(1)
+	for _, v := range variants {
+		rank, ok := user[v.word]
+		if !ok {
+			rank, ok = _common[v.word]
+		}
+		if !ok {
+			continue
+		}
+		found = true
+		g = math.Min(g, math.Log10(float64(rank))+v.extra+caseVariations(s))
+	}
+	return g, found
+}
+
+// caseVariations returns log10 of guesses added by capitalization of the word.
+func caseVariations(s []rune) float64 {
+	var upper, lower int
+	for _, r := range s {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 0
+	case lower == 0 || (upper == 1 && unicode.IsUpper(s[0])):
+		// all caps or capitalized first letter
+		return math.Log10(2)
+	default:
+		return float64(min(upper, lower)) * math.Log10(2)
+	}
+}
+
+func isRepeat(s []rune) bool {
+	for _, r := range s[1:] {
+		if r != s[0] {
+			return false
+		}
+	}
+	return true
+}
+
+func isSequence(s []rune) bool {
+	d := s[1] - s[0]
+	if d != 1 && d != -1 {
+		return false
+	}
+	for i := 2; i < len(s); i++ {
+		if s[i]-s[i-1] != d {
+			return false
+		}
+	}
+	return true
+}
+
+func isKeyboardRun(s []rune) bool {
+	lower := strings.ToLower(string(s))
+	for _, row := range _keyboardRows {
+		if strings.Contains(row, lower) || strings.Contains(row, reverse(lower)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isYear(s []rune) bool {
+	if len(s) != 4 {
+		return false
+	}
+	y := 0
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+		y = y*10 + int(r-'0')
+	}
+	return y >= 1900 && y <= 2049
+}
+
+// cardinality returns size of the alphabet the characters belong to.
+func cardinality(s []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	c := 0
+	if lower {
+		c += 26
+	}
+	if upper {
+		c += 26
+	}
+	if digit {
+		c += 10
+	}
+	if symbol {
+		c += 33
+	}
+	if other {
+		c += 100
+	}
+	return c
+}
+
+func unleet(s string) string {
+	return strings.Map(func(r rune) rune {
+		if l, ok := _leet[r]; ok {
+			return l
+		}
+		return r
+	}, s)
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
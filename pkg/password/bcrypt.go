@@ -0,0 +1,57 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// _bcryptMaxLen is a max password length in bytes, bcrypt ignores the rest.
+const _bcryptMaxLen = 72
+
+// Bcrypt hashes passwords as $2a$<cost>$<salt and hash>.
+type Bcrypt struct {
+	Cost int
+}
+
+func (b Bcrypt) IDs() []string {
+	return []string{"2a", "2b", "2y"}
+}
+
+func (b Bcrypt) Hash(password string) (string, error) {
+	const op = "bcrypt.Hash"
+
+	// refuse to hash instead of silent truncation
+	if len(password) > _bcryptMaxLen {
+		return "", fmt.Errorf("%s: %w", op, ErrTooLong)
+	}
+
+	h, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return string(h), nil
+}
+
+func (b Bcrypt) Verify(password, hash string) error {
+	const op = "bcrypt.Verify"
+
+	// longer passwords are refused to be hashed, bcrypt would compare only their prefix
+	if len(password) > _bcryptMaxLen {
+		return fmt.Errorf("%s: %w", op, ErrMismatch)
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return fmt.Errorf("%s: %w", op, ErrMismatch)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (b Bcrypt) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < b.Cost
+}
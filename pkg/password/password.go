@@ -0,0 +1,147 @@
+package password
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrMismatch         = errors.New("password does not match the hash")
+	ErrMalformedHash    = errors.New("hash is malformed")
+	ErrUnknownAlgorithm = errors.New("hash is made by unknown algorithm")
+	ErrTooLong          = errors.New("password is too long for the hashing algorithm")
+)
+
+// Algorithm hashes passwords into strings of PHC format: $<id>[$<params>]$<salt and hash>.
+type Algorithm interface {
+	// IDs returns identifiers of the algorithm used in the hash strings.
+	IDs() []string
+	Hash(password string) (string, error)
+	// Verify returns ErrMismatch if the password does not match the hash.
+	Verify(password, hash string) error
+	// NeedsRehash reports whether the hash parameters differ from the configured ones.
+	NeedsRehash(hash string) bool
+}
+
+// Hasher makes new hashes with the preferred algorithm and verifies hashes of all known algorithms,
+// hashes of not preferred algorithms or with outdated parameters should be rehashed.
+type Hasher struct {
+	preferred Algorithm
+	algs      map[string]Algorithm
+	// all lists every algorithm once, the preferred one first.
+	all []Algorithm
+
+	dummyOnce sync.Once
+	// dummies are hashes of a random password made by algorithms of all.
+	dummies []string
+}
+
+func New(preferred Algorithm, others ...Algorithm) *Hasher {
+	h := &Hasher{preferred: preferred, algs: make(map[string]Algorithm)}
+
+	for _, a := range append([]Algorithm{preferred}, others...) {
+		added := false
+		for _, id := range a.IDs() {
+			if _, ok := h.algs[id]; !ok {
+				h.algs[id] = a
+				added = true
+			}
+		}
+		if added {
+			h.all = append(h.all, a)
+		}
+	}
+	return h
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	return h.preferred.Hash(password)
+}
+
+func (h *Hasher) Verify(password, hash string) error {
+	const op = "password.Verify"
+
+	a, err := h.algorithm(hash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err = a.Verify(password, hash); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (h *Hasher) NeedsRehash(hash string) bool {
+	a, err := h.algorithm(hash)
+	if err != nil || a != h.preferred {
+		return true
+	}
+	return a.NeedsRehash(hash)
+}
+
+// VerifyPadded verifies the password like Verify and also compares it with dummy hashes of the other
+// algorithms, so it takes as long as VerifyDummy whatever algorithm the hash is made by. It is used
+// for logins to not reveal accounts with hashes of not preferred algorithms.
+func (h *Hasher) VerifyPadded(password, hash string) error {
+	const op = "password.VerifyPadded"
+
+	a, err := h.algorithm(hash)
+	if err != nil {
+		h.VerifyDummy(password)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	id := strings.SplitN(hash, "$", 3)[1]
+	dummies := h.dummyHashes()
+	for i, other := range h.all {
+		if !slices.Contains(other.IDs(), id) {
+			_ = other.Verify(password, dummies[i])
+		}
+	}
+
+	if err = a.Verify(password, hash); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// VerifyDummy takes as long as VerifyPadded of a real hash,
+// it is used when there is no hash to compare with to not reveal that.
+func (h *Hasher) VerifyDummy(password string) {
+	dummies := h.dummyHashes()
+	for i, a := range h.all {
+		_ = a.Verify(password, dummies[i])
+	}
+}
+
+// dummyHashes returns hashes of a random password made by algorithms of all.
+func (h *Hasher) dummyHashes() []string {
+	h.dummyOnce.Do(func() {
+		h.dummies = make([]string, len(h.all))
+
+		b := make([]byte, 16)
+		_, _ = rand.Read(b)
+		for i, a := range h.all {
+			h.dummies[i], _ = a.Hash(hex.EncodeToString(b))
+		}
+	})
+	return h.dummies
+}
+
+func (h *Hasher) algorithm(hash string) (Algorithm, error) {
+	parts := strings.SplitN(hash, "$", 3)
+	if len(parts) < 3 || parts[0] != "" {
+		return nil, ErrMalformedHash
+	}
+
+	a, ok := h.algs[parts[1]]
+	if !ok {
+		return nil, ErrUnknownAlgorithm
+	}
+	return a, nil
+}
@@ -0,0 +1,67 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// countingAlg wraps an algorithm and counts verifications.
+type countingAlg struct {
+	Algorithm
+	verified *int
+}
+
+func (c countingAlg) Verify(password, hash string) error {
+	*c.verified++
+	return c.Algorithm.Verify(password, hash)
+}
+
+func TestVerifyPaddedRunsEveryAlgorithm(t *testing.T) {
+	var argonN, bcryptN int
+	argon := countingAlg{Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1}, &argonN}
+	bc := countingAlg{Bcrypt{Cost: 4}, &bcryptN}
+
+	h := New(argon, bc)
+
+	legacy, err := bc.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	argonN, bcryptN = 0, 0
+
+	if err = h.VerifyPadded("secret", legacy); err != nil {
+		t.Fatalf("VerifyPadded() = %v", err)
+	}
+	if argonN != 1 || bcryptN != 1 {
+		t.Fatalf("verified argon2id %d, bcrypt %d times, want 1 and 1", argonN, bcryptN)
+	}
+
+	if err = h.VerifyPadded("wrong", legacy); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("VerifyPadded() = %v, want ErrMismatch", err)
+	}
+
+	argonN, bcryptN = 0, 0
+	h.VerifyDummy("secret")
+	if argonN != 1 || bcryptN != 1 {
+		t.Fatalf("dummy verified argon2id %d, bcrypt %d times, want 1 and 1", argonN, bcryptN)
+	}
+}
+
+func TestBcryptRefusesLongPasswords(t *testing.T) {
+	b := Bcrypt{Cost: 4}
+
+	long := strings.Repeat("a", _bcryptMaxLen+1)
+	if _, err := b.Hash(long); !errors.Is(err, ErrTooLong) {
+		t.Fatalf("Hash() = %v, want ErrTooLong", err)
+	}
+
+	hash, err := b.Hash(long[:_bcryptMaxLen])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// bcrypt would compare only the first 72 bytes
+	if err = b.Verify(long, hash); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("Verify() = %v, want ErrMismatch", err)
+	}
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// _sweepEvery is a number of calls between sweeps of full buckets.
+const _sweepEvery = 1024
+
+type bucket struct {
+	tokens float64
+	ts     time.Time
+	full   time.Time
+}
+
+// Memory keeps buckets in memory of the current process.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket)}
+}
+
+func (m *Memory) Allow(_ context.Context, key string, limit int, period time.Duration) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	rate := float64(limit) / period.Seconds()
+
+	m.calls++
+	if m.calls%_sweepEvery == 0 {
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit), ts: now}
+		m.buckets[key] = b
+	}
+
+	b.tokens = min(float64(limit), b.tokens+now.Sub(b.ts).Seconds()*rate)
+	b.ts = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = now.Add(secondsToDuration((float64(limit) - b.tokens) / rate))
+
+	return newResult(allowed, b.tokens, limit, rate), nil
+}
+
+// sweep drops buckets which are full again, they are equal to the new ones.
+func (m *Memory) sweep(now time.Time) {
+	for k, b := range m.buckets {
+		if now.After(b.full) {
+			delete(m.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limiter is a token bucket rate limiter, each key has its own bucket of limit tokens
+// which is refilled completely during period.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit int, period time.Duration) (Result, error)
+}
+
+// Result -.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is a time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is a time until the next request is allowed, zero if the request is allowed.
+	RetryAfter time.Duration
+}
+
+// newResult builds result from the number of tokens left in the bucket and refill rate in tokens per second.
+func newResult(allowed bool, tokens float64, limit int, rate float64) Result {
+	r := Result{
+		Allowed:   allowed,
+		Limit:     limit,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     secondsToDuration((float64(limit) - tokens) / rate),
+	}
+	if !allowed {
+		r.RetryAfter = secondsToDuration((1 - tokens) / rate)
+	}
+	return r
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+// _tokenBucket refills and takes a token from the bucket atomically using redis clock,
+// so all instances share the same buckets.
+var _tokenBucket = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil then
+	tokens = limit
+	ts = now
+end
+
+tokens = math.min(limit, tokens + (now - ts) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((limit - tokens) / rate * 1000) + 1000)
+
+return {allowed, tostring(tokens)}
+`)
+
+// Redis keeps buckets in redis shared by all instances.
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedis(client *redis.Client, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix}
+}
+
+func (r *Redis) Allow(ctx context.Context, key string, limit int, period time.Duration) (Result, error) {
+	const op = "ratelimit.redis.allow"
+
+	rate := float64(limit) / period.Seconds()
+
+	res, err := _tokenBucket.Run(ctx, r.client, []string{r.prefix + key}, limit, rate).Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(res) != 2 {
+		return Result{}, fmt.Errorf("%s: unexpected script result %v", op, res)
+	}
+
+	allowed, _ := res[0].(int64)
+	s, _ := res[1].(string)
+	tokens, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return newResult(allowed == 1, tokens, limit, rate), nil
+}
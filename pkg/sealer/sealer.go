@@ -0,0 +1,121 @@
+package sealer
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+const (
+	_keySize   = 32 // AES-256
+	_keyIDSize = 4
+)
+
+var (
+	ErrNoKeys       = errors.New("no keys provided")
+	ErrInvalidKey   = errors.New("key must be 32 bytes long")
+	ErrUnknownKey   = errors.New("token is sealed with unknown key")
+	ErrInvalidToken = errors.New("token is malformed or tampered")
+)
+
+type key struct {
+	id   []byte
+	aead cipher.AEAD
+}
+
+// Sealer encrypts and authenticates data with AES-256-GCM.
+// The first key is used to seal, all keys are used to open, which allows key rotation:
+// a new key is put first and the old one is kept until all tokens sealed with it expire.
+type Sealer struct {
+	keys []key
+}
+
+// New creates sealer from base64 encoded 32-byte keys.
+func New(keys ...string) (*Sealer, error) {
+	const op = "sealer.new"
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, ErrNoKeys)
+	}
+
+	s := &Sealer{keys: make([]key, 0, len(keys))}
+
+	for _, k := range keys {
+		raw, err := base64.StdEncoding.DecodeString(k)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if len(raw) != _keySize {
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidKey)
+		}
+
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		sum := sha256.Sum256(raw)
+		s.keys = append(s.keys, key{id: sum[:_keyIDSize], aead: aead})
+	}
+
+	return s, nil
+}
+
+// Seal encrypts plaintext, aad is authenticated but not encrypted and must be passed to Open.
+// The result is URL safe and has the form base64(key id | nonce | ciphertext).
+func (s *Sealer) Seal(plaintext, aad []byte) (string, error) {
+	const op = "sealer.seal"
+
+	k := s.keys[0]
+
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	out := make([]byte, 0, _keyIDSize+len(nonce)+len(plaintext)+k.aead.Overhead())
+	out = append(out, k.id...)
+	out = append(out, nonce...)
+	out = k.aead.Seal(out, nonce, plaintext, aad)
+
+	return base64.RawURLEncoding.EncodeToString(out), nil
+}
+
+// Open decrypts and verifies token produced by Seal.
+func (s *Sealer) Open(token string, aad []byte) ([]byte, error) {
+	const op = "sealer.open"
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) < _keyIDSize {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	for _, k := range s.keys {
+		if !bytes.Equal(k.id, raw[:_keyIDSize]) {
+			continue
+		}
+
+		ns := k.aead.NonceSize()
+		if len(raw) < _keyIDSize+ns {
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+
+		nonce := raw[_keyIDSize : _keyIDSize+ns]
+		plaintext, err := k.aead.Open(nil, nonce, raw[_keyIDSize+ns:], aad)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+		return plaintext, nil
+	}
+
+	return nil, fmt.Errorf("%s: %w", op, ErrUnknownKey)
+}
@@ -0,0 +1,67 @@
+package useragent
+
+import (
+	"github.com/mssola/useragent"
+	"strings"
+)
+
+// Device types.
+const (
+	Desktop = "desktop"
+	Mobile  = "mobile"
+	Tablet  = "tablet"
+	Bot     = "bot"
+	Unknown = "unknown"
+)
+
+// Info is a human-readable description of a client parsed from User-Agent header.
+type Info struct {
+	Browser    string
+	OS         string
+	DeviceType string
+}
+
+// Parse parses User-Agent header value.
+func Parse(ua string) Info {
+	if strings.TrimSpace(ua) == "" {
+		return Info{DeviceType: Unknown}
+	}
+
+	p := useragent.New(ua)
+
+	os := p.OSInfo()
+	info := Info{OS: strings.TrimSpace(os.Name + " " + majorVersion(strings.ReplaceAll(os.Version, "_", ".")))}
+
+	name, version := p.Browser()
+	info.Browser = strings.TrimSpace(name + " " + majorVersion(version))
+
+	switch {
+	case p.Bot():
+		info.DeviceType = Bot
+	case isTablet(ua):
+		info.DeviceType = Tablet
+	case p.Mobile():
+		info.DeviceType = Mobile
+	case info.OS == "":
+		info.DeviceType = Unknown
+	default:
+		info.DeviceType = Desktop
+	}
+
+	return info
+}
+
+// isTablet reports whether ua looks like a tablet, useragent package does not distinguish them from phones.
+func isTablet(ua string) bool {
+	ua = strings.ToLower(ua)
+	return strings.Contains(ua, "ipad") ||
+		strings.Contains(ua, "tablet") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile"))
+}
+
+func majorVersion(v string) string {
+	if i := strings.IndexByte(v, '.'); i > 0 {
+		return v[:i]
+	}
+	return v
+}
@@ -46,3 +46,19 @@ func RandomSpecialString(length int) string {
 
 	return string(bytes)
 }
+
+// Truncate returns s cut to at most n runes.
+func Truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	i := 0
+	for pos := range s {
+		if i == n {
+			return s[:pos]
+		}
+		i++
+	}
+	return s
+}
@@ -0,0 +1,63 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"syscall"
+)
+
+// ErrForbiddenURL is returned for urls which aren't http(s) or point to loopback, private
+// or link-local addresses, so webhooks can't be used to reach internal services.
+var ErrForbiddenURL = errors.New("webhook url must be http(s) and resolve to public addresses")
+
+// CheckURL returns ErrForbiddenURL if the url isn't http(s) or any address of its host isn't public.
+// The addresses are checked again when the request is sent, since DNS records may change.
+func (c *Client) CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrForbiddenURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrForbiddenURL
+	}
+	if c.allowPrivate {
+		return nil
+	}
+
+	addrs, err := c.resolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrForbiddenURL, err)
+	}
+	for _, a := range addrs {
+		if !public(a) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrForbiddenURL, u.Hostname(), a)
+		}
+	}
+	return nil
+}
+
+// dialControl refuses connections to addresses which aren't public, it is called with
+// the resolved address, so hosts re-pointed after registration are refused too.
+func dialControl(_, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !public(ap.Addr()) {
+		return fmt.Errorf("%w: %s", ErrForbiddenURL, ap.Addr())
+	}
+	return nil
+}
+
+// public reports whether a is a global unicast address outside of private ranges,
+// loopback, link-local (including cloud metadata 169.254.169.254) and unspecified addresses aren't.
+func public(a netip.Addr) bool {
+	a = a.Unmap()
+	return a.IsGlobalUnicast() && !a.IsPrivate() && !_sharedRange.Contains(a)
+}
+
+// _sharedRange is the carrier-grade NAT range, it isn't routable on the internet.
+var _sharedRange = netip.MustParsePrefix("100.64.0.0/10")
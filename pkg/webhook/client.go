@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Request headers.
+const (
+	HeaderID        = "Webhook-Id"
+	HeaderEvent     = "Webhook-Event"
+	HeaderSignature = "Webhook-Signature"
+)
+
+// _maxErrorBody limits the part of the response body kept in the error.
+const _maxErrorBody = 512
+
+// StatusError is returned if the receiver responds with non-2xx status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("webhook receiver responded %d: %s", e.StatusCode, e.Body)
+}
+
+// Client sends signed webhook requests.
+type Client struct {
+	http         *http.Client
+	resolver     *net.Resolver
+	allowPrivate bool
+}
+
+// NewClient creates client with request timeout, redirects are not followed,
+// since the receiver is expected to respond at the registered url.
+// Unless allowPrivate is set, connections are made only to public addresses and proxies aren't used,
+// so requests can't reach internal services.
+func NewClient(timeout time.Duration, allowPrivate bool) *Client {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		dialer.Control = dialControl
+		transport.Proxy = nil
+	}
+	transport.DialContext = dialer.DialContext
+
+	return &Client{
+		http: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		resolver:     net.DefaultResolver,
+		allowPrivate: allowPrivate,
+	}
+}
+
+// Send posts JSON body to url, id and event are passed in headers, the body is signed with secret.
+func (c *Client) Send(ctx context.Context, url, secret, id, event string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, id)
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderSignature, Sign(secret, time.Now(), body))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, _maxErrorBody))
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(b)}
+	}
+	// drain, so the connection is reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, _maxErrorBody))
+	return nil
+}
@@ -0,0 +1,132 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientSend(t *testing.T) {
+	body := []byte(`{"type":"account.created"}`)
+
+	var got *http.Request
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c := NewClient(time.Second, true)
+	if err := c.Send(context.Background(), srv.URL, "secret", "event-id", "account.created", body); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	if got.Method != http.MethodPost {
+		t.Errorf("method = %s, want POST", got.Method)
+	}
+	if got.Header.Get(HeaderID) != "event-id" || got.Header.Get(HeaderEvent) != "account.created" {
+		t.Errorf("headers = %v", got.Header)
+	}
+	if string(gotBody) != string(body) {
+		t.Errorf("body = %s, want %s", gotBody, body)
+	}
+	if err := Verify("secret", got.Header.Get(HeaderSignature), gotBody, time.Minute); err != nil {
+		t.Errorf("signature can't be verified: %v", err)
+	}
+}
+
+func TestClientSendStatusError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+	}{
+		{"server error", http.StatusInternalServerError},
+		// redirects aren't followed
+		{"redirect", http.StatusFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Location", "http://example.com")
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte("nope"))
+			}))
+			defer srv.Close()
+
+			err := NewClient(time.Second, true).Send(context.Background(), srv.URL, "secret", "id", "event", nil)
+
+			var se *StatusError
+			if !errors.As(err, &se) || se.StatusCode != tt.status || se.Body != "nope" {
+				t.Fatalf("Send() = %v, want status error %d", err, tt.status)
+			}
+		})
+	}
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	var called bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	err := NewClient(time.Second, false).Send(context.Background(), srv.URL, "secret", "id", "event", nil)
+	if !errors.Is(err, ErrForbiddenURL) {
+		t.Fatalf("Send() = %v, want %v", err, ErrForbiddenURL)
+	}
+	if called {
+		t.Fatal("request reached loopback server")
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://93.184.216.34/hook", true},
+		{"http://[2606:4700::1111]/hook", true},
+		{"ftp://93.184.216.34/hook", false},
+		{"http://127.0.0.1:8080/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://[::ffff:127.0.0.1]/hook", false},
+		{"http://10.1.2.3/hook", false},
+		{"http://172.16.0.1/hook", false},
+		{"http://192.168.1.1/hook", false},
+		{"http://100.64.0.1/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://0.0.0.0/hook", false},
+		{"http://localhost/hook", false},
+	}
+
+	c := NewClient(time.Second, false)
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := c.CheckURL(context.Background(), tt.url)
+			if tt.allowed && err != nil {
+				t.Fatalf("CheckURL() = %v, want nil", err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrForbiddenURL) {
+				t.Fatalf("CheckURL() = %v, want %v", err, ErrForbiddenURL)
+			}
+		})
+	}
+}
+
+func TestCheckURLAllowPrivate(t *testing.T) {
+	c := NewClient(time.Second, true)
+
+	if err := c.CheckURL(context.Background(), "http://127.0.0.1/hook"); err != nil {
+		t.Fatalf("CheckURL() = %v, want nil", err)
+	}
+	if err := c.CheckURL(context.Background(), "file:///etc/passwd"); !errors.Is(err, ErrForbiddenURL) {
+		t.Fatalf("CheckURL() = %v, want %v", err, ErrForbiddenURL)
+	}
+}
@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"type":"account.created"}`)
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		secret    string
+		header    string
+		body      []byte
+		tolerance time.Duration
+		want      error
+	}{
+		{"valid", "secret", Sign("secret", now, body), body, time.Minute, nil},
+		{"wrong secret", "other", Sign("secret", now, body), body, time.Minute, ErrInvalidSignature},
+		{"tampered body", "secret", Sign("secret", now, body), []byte(`{}`), time.Minute, ErrInvalidSignature},
+		{"expired", "secret", Sign("secret", now.Add(-time.Hour), body), body, time.Minute, ErrExpiredSignature},
+		{"expired without tolerance", "secret", Sign("secret", now.Add(-time.Hour), body), body, 0, nil},
+		{"no timestamp", "secret", strings.Split(Sign("secret", now, body), ",")[1], body, 0, ErrInvalidSignature},
+		{"empty", "secret", "", body, 0, ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(tt.secret, tt.header, tt.body, tt.tolerance); !errors.Is(err, tt.want) {
+				t.Fatalf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignedTimestampCantBeReplaced(t *testing.T) {
+	body := []byte(`{}`)
+	old := Sign("secret", time.Now().Add(-time.Hour), body)
+
+	_, sig, _ := strings.Cut(old, ",")
+	forged := "t=" + strconv.FormatInt(time.Now().Unix(), 10) + "," + sig
+
+	if err := Verify("secret", forged, body, time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Verify() = %v, want %v", err, ErrInvalidSignature)
+	}
+}